@@ -1,12 +1,13 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 
-	"github.com/rnorth/ha-client/internal/client"
 	"github.com/rnorth/ha-client/internal/output"
 	"github.com/spf13/cobra"
 )
@@ -19,13 +20,12 @@ var actionCmd = &cobra.Command{
 var actionListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List available actions",
-	RunE: func(cmd *cobra.Command, args []string) error {
-		cfg, err := resolveConfig()
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		c, err := newRESTClient(ctx)
 		if err != nil {
 			return err
 		}
-		c := client.NewRESTClient(cfg.Server, cfg.Token)
-		domains, err := c.ListActions()
+		domains, err := c.ListActions(ctx)
 		if err != nil {
 			return err
 		}
@@ -43,15 +43,15 @@ var actionListCmd = &cobra.Command{
 				})
 			}
 		}
-		return output.Render(os.Stdout, resolveFormat(), rows, nil, renderOpts()...)
-	},
+		return render(ctx, os.Stdout, resolveFormat(), rows, nil, renderOpts()...)
+	}),
 }
 
 var (
-	actionDataJSONRaw  string
-	actionDataFields   []string
-	actionEntityID     string
+	actionDataJSONRaw    string
+	actionDataFields     []string
 	actionReturnResponse bool
+	actionNoValidate     bool
 )
 
 var actionCallCmd = &cobra.Command{
@@ -59,43 +59,114 @@ var actionCallCmd = &cobra.Command{
 	Short: "Call a Home Assistant action",
 	Long: `Call a Home Assistant action.
 
+The action's fields are fetched first, so that -d values are sent with the type
+their field expects (numbers, booleans, RGB colors, objects) and unknown fields
+or out-of-range numbers are rejected before the call. Use -d key:=<json> to give
+a value as raw JSON, and --no-validate to skip the check.
+
+Target entities with --entity_id, or everything in an area, device, label or
+floor with --area, --device, --label and --floor. These take a name or an ID and
+can be repeated. --entity_id - reads entity IDs from stdin, one per line, as
+printed by -o name.
+
+Calls that affect more than --confirm-threshold entities, or any lock, alarm
+control panel or garage door, ask for confirmation first; without a terminal
+they are refused unless --yes is given. --dry-run prints the entities a call
+would affect and the payload it would send, without calling the action.
+
 Examples:
   ha-client action call light.turn_on --entity_id=light.desk
+  ha-client action call light.turn_off --area kitchen
+  ha-client action call light.turn_off --entity_id=light.desk --entity_id=light.hall
+  ha-client state list --domain light -o name | ha-client action call light.turn_off --entity_id -
+  ha-client action call light.turn_on --floor Upstairs --label "Night lights"
+  ha-client action call light.turn_off --area kitchen --dry-run
+  ha-client action call lock.unlock --entity_id=lock.front_door --yes
   ha-client action call light.turn_on --entity_id=light.desk -d transition=5 -d brightness_pct=80
+  ha-client action call light.turn_on --entity_id=light.desk -d rgb_color=[255,0,0]
+  ha-client action call notify.mobile_app_phone -d message=Hi -d 'data:={"ttl":0}'
   ha-client action call light.turn_on --data-json '{"entity_id":"light.desk","effect":"rainbow"}'
   ha-client action call light.turn_on --data-json '{"transition":5}' -d brightness_pct=80 --entity_id=light.desk`,
 	Args: cobra.ExactArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
 		// Validate inputs before making any network calls.
 		parts := splitDomainAction(args[0])
 		if parts == nil {
 			return fmt.Errorf("invalid action format %q: expected domain.action (e.g. light.turn_on)", args[0])
 		}
 
-		data, err := buildActionData(actionDataJSONRaw, actionDataFields, actionEntityID)
+		fields, err := parseDataFields(actionDataFields)
+		if err != nil {
+			return err
+		}
+		ps, err := policies(ctx)
+		if err != nil {
+			return err
+		}
+		if err := ps.CheckAction(args[0]); err != nil {
+			return err
+		}
+		targets := actionTargets
+		if targets.entities, err = expandStdinIDs(targets.entities); err != nil {
+			return err
+		}
+		// "all" and "none" are checked once the plan has expanded them.
+		if err := ps.CheckEntities(slices.DeleteFunc(slices.Clone(targets.entities), isEntityKeyword)...); err != nil {
+			return err
+		}
+
+		c, err := newRESTClient(ctx)
 		if err != nil {
 			return err
 		}
 
-		cfg, err := resolveConfig()
+		var schema *actionSchema
+		if !actionNoValidate {
+			if schema, err = fetchActionSchema(ctx, c, parts[0], parts[1]); err != nil {
+				return err
+			}
+		}
+		target, err := resolveTarget(ctx, targets)
+		if err != nil {
+			return err
+		}
+		data, err := buildActionData(actionDataJSONRaw, fields, target, schema)
 		if err != nil {
 			return err
 		}
-		c := client.NewRESTClient(cfg.Server, cfg.Token)
+		auditPayload(ctx, data)
+
+		// Entities named in -d or --data-json, or reached through an area,
+		// device, label or floor, are only known now.
+		if actionDryRun || !actionYes || ps.HasEntityRules() {
+			plan, err := planAction(ctx, c, parts[0], parts[1], data, schema)
+			if err != nil {
+				return err
+			}
+			if err := ps.CheckEntities(plan.Entities...); err != nil {
+				return err
+			}
+			if actionDryRun {
+				return render(ctx, cmd.OutOrStdout(), resolveDescribeFormat(), plan, nil, renderOpts()...)
+			}
+			if err := confirmAction(ctx, plan); err != nil {
+				return err
+			}
+		}
 
-		resp, err := c.CallAction(parts[0], parts[1], data, actionReturnResponse)
+		resp, err := c.CallAction(ctx, parts[0], parts[1], data, actionReturnResponse)
 		if err != nil {
 			return err
 		}
 		if actionReturnResponse && resp.ServiceResponse != nil {
-			return output.Render(cmd.OutOrStdout(), resolveFormat(), resp.ServiceResponse, nil, renderOpts()...)
+			return render(ctx, cmd.OutOrStdout(), resolveFormat(), resp.ServiceResponse, nil, renderOpts()...)
 		}
 		if len(resp.ChangedStates) > 0 {
-			return output.Render(cmd.OutOrStdout(), resolveFormat(), resp.ChangedStates, []string{"EntityID", "State"}, renderOpts()...)
+			return render(ctx, cmd.OutOrStdout(), resolveFormat(), resp.ChangedStates, []string{"EntityID", "State"}, renderOpts(output.WithWideColumns(stateWideColumns...))...)
 		}
 		info("Action called successfully.")
 		return nil
-	},
+	}),
 }
 
 // splitDomainAction splits "domain.action" at the first dot, returning
@@ -110,8 +181,11 @@ func splitDomainAction(s string) []string {
 }
 
 // buildActionData merges the three flag sources into a single data map.
-// Merge order (later wins): --data-json < -d fields < --entity_id.
-func buildActionData(dataJSON string, fields []string, entityID string) (map[string]interface{}, error) {
+// Merge order (later wins): --data-json < -d fields < target flags. The REST
+// API takes the target keys (entity_id, area_id, ...) alongside the fields.
+// With a schema, -d values are typed by their field's selector and the result
+// is validated; without one, they stay strings.
+func buildActionData(dataJSON string, fields []dataField, target map[string]interface{}, schema *actionSchema) (map[string]interface{}, error) {
 	data := map[string]interface{}{}
 
 	if dataJSON != "" {
@@ -121,17 +195,33 @@ func buildActionData(dataJSON string, fields []string, entityID string) (map[str
 	}
 
 	for _, f := range fields {
-		k, v, ok := strings.Cut(f, "=")
-		if !ok {
-			return nil, fmt.Errorf("invalid -d flag %q: expected key=value", f)
+		switch {
+		case f.raw:
+			var v interface{}
+			if err := json.Unmarshal([]byte(f.value), &v); err != nil {
+				return nil, usageError("invalid -d %s:=: %v", f.key, err)
+			}
+			data[f.key] = v
+		case schema != nil:
+			v, err := schema.coerce(f.key, f.value)
+			if err != nil {
+				return nil, err
+			}
+			data[f.key] = v
+		default:
+			data[f.key] = f.value
 		}
-		data[k] = v
 	}
 
-	if entityID != "" {
-		data["entity_id"] = entityID
+	for k, v := range target {
+		data[k] = v
 	}
 
+	if schema != nil {
+		if err := schema.validate(data); err != nil {
+			return nil, err
+		}
+	}
 	if len(data) == 0 {
 		return nil, nil
 	}
@@ -140,9 +230,17 @@ func buildActionData(dataJSON string, fields []string, entityID string) (map[str
 
 func init() {
 	actionCallCmd.Flags().StringVar(&actionDataJSONRaw, "data-json", "", "raw JSON data payload")
-	actionCallCmd.Flags().StringArrayVarP(&actionDataFields, "data", "d", nil, "data field as key=value (repeatable)")
-	actionCallCmd.Flags().StringVar(&actionEntityID, "entity_id", "", "entity ID to target (shorthand for -d entity_id=...)")
+	actionCallCmd.Flags().StringArrayVarP(&actionDataFields, "data", "d", nil, "data field as key=value, or key:=<json> for a raw JSON value (repeatable)")
+	actionCallCmd.Flags().StringArrayVar(&actionTargets.entities, "entity_id", nil, "entity ID to target (repeatable)")
+	actionCallCmd.Flags().StringArrayVar(&actionTargets.areas, "area", nil, "area to target, by name or ID (repeatable)")
+	actionCallCmd.Flags().StringArrayVar(&actionTargets.devices, "device", nil, "device to target, by name or ID (repeatable)")
+	actionCallCmd.Flags().StringArrayVar(&actionTargets.labels, "label", nil, "label to target, by name or ID (repeatable)")
+	actionCallCmd.Flags().StringArrayVar(&actionTargets.floors, "floor", nil, "floor to target, by name or ID (repeatable)")
 	actionCallCmd.Flags().BoolVar(&actionReturnResponse, "return-response", false, "return service response data (for actions that support it)")
+	actionCallCmd.Flags().BoolVar(&actionDryRun, "dry-run", false, "print the entities that would be affected and the payload, without calling the action")
+	actionCallCmd.Flags().BoolVarP(&actionYes, "yes", "y", false, "do not ask for confirmation")
+	actionCallCmd.Flags().IntVar(&actionConfirmThreshold, "confirm-threshold", 10, "ask for confirmation when more than this many entities are affected (0 to never ask)")
+	actionCallCmd.Flags().BoolVar(&actionNoValidate, "no-validate", false, "do not fetch the action's fields to type and check -d values")
 	actionCmd.AddCommand(actionListCmd, actionCallCmd)
 	rootCmd.AddCommand(actionCmd)
 }
@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rnorth/ha-client/internal/output"
+	"github.com/spf13/cobra"
+)
+
+// actionExplanation is what action explain prints with -o json or -o yaml.
+type actionExplanation struct {
+	Action      string                 `json:"action" yaml:"action"`
+	Name        string                 `json:"name,omitempty" yaml:"name,omitempty"`
+	Description string                 `json:"description,omitempty" yaml:"description,omitempty"`
+	Target      map[string]interface{} `json:"target,omitempty" yaml:"target,omitempty"`
+	Fields      []fieldExplanation     `json:"fields" yaml:"fields"`
+}
+
+// fieldExplanation describes one field. Selector is the selector type and
+// Constraints its configuration, e.g. {"min": 0, "max": 100} for a number.
+type fieldExplanation struct {
+	Field       string                 `json:"field" yaml:"field"`
+	Name        string                 `json:"name,omitempty" yaml:"name,omitempty"`
+	Description string                 `json:"description,omitempty" yaml:"description,omitempty"`
+	Required    bool                   `json:"required" yaml:"required"`
+	Example     interface{}            `json:"example,omitempty" yaml:"example,omitempty"`
+	Section     string                 `json:"section,omitempty" yaml:"section,omitempty"`
+	Selector    string                 `json:"selector,omitempty" yaml:"selector,omitempty"`
+	Constraints map[string]interface{} `json:"constraints,omitempty" yaml:"constraints,omitempty"`
+}
+
+var actionExplainCmd = &cobra.Command{
+	Use:   "explain <domain.action>",
+	Short: "Show the fields and targets an action accepts",
+	Long: `Show the fields and targets an action accepts.
+
+Each field is listed with whether it is required, its selector type and the
+selector's constraints (range, unit, options), an example value and its
+description. Fields that Home Assistant groups into a section, such as
+light.turn_on's advanced fields, are listed with the rest. The target line
+shows which entities and devices the action can be pointed at.
+
+Use -o json or -o yaml for the full schema.
+
+Examples:
+  ha-client action explain light.turn_on
+  ha-client action explain weather.get_forecasts -o json`,
+	Args: cobra.ExactArgs(1),
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		parts := splitDomainAction(args[0])
+		if parts == nil {
+			return fmt.Errorf("invalid action format %q: expected domain.action (e.g. light.turn_on)", args[0])
+		}
+
+		c, err := newRESTClient(ctx)
+		if err != nil {
+			return err
+		}
+		domains, err := c.ListActions(ctx)
+		if err != nil {
+			return err
+		}
+		schema, err := findActionSchema(domains, parts[0], parts[1])
+		if err != nil {
+			return fmt.Errorf("%w (see 'ha-client action list')", err)
+		}
+
+		e := explainAction(schema)
+		format := resolveFormat()
+		if format != output.FormatTable && format != output.FormatWide {
+			return render(ctx, os.Stdout, format, e, nil, renderOpts()...)
+		}
+		return writeExplanation(commandOutput(ctx, os.Stdout), e)
+	}),
+}
+
+func explainAction(s *actionSchema) actionExplanation {
+	e := actionExplanation{
+		Action:      s.name,
+		Name:        s.detail.Name,
+		Description: s.detail.Description,
+		Target:      s.detail.Target,
+		Fields:      []fieldExplanation{},
+	}
+	for key, f := range s.fields {
+		typ, cfg := f.selector()
+		var constraints map[string]interface{}
+		_ = json.Unmarshal(cfg, &constraints)
+		if len(constraints) == 0 {
+			constraints = nil
+		}
+		e.Fields = append(e.Fields, fieldExplanation{
+			Field:       key,
+			Name:        f.Name,
+			Description: f.Description,
+			Required:    f.Required,
+			Example:     f.Example,
+			Section:     f.section,
+			Selector:    typ,
+			Constraints: constraints,
+		})
+	}
+	// Required fields first, then top-level fields before those in sections.
+	sort.Slice(e.Fields, func(i, j int) bool {
+		a, b := e.Fields[i], e.Fields[j]
+		if a.Required != b.Required {
+			return a.Required
+		}
+		if (a.Section == "") != (b.Section == "") {
+			return a.Section == ""
+		}
+		return a.Field < b.Field
+	})
+	return e
+}
+
+// writeExplanation prints e as a header followed by a table of its fields.
+func writeExplanation(w io.Writer, e actionExplanation) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "ACTION:\t%s\n", e.Action)
+	if e.Name != "" {
+		fmt.Fprintf(tw, "NAME:\t%s\n", e.Name)
+	}
+	if e.Description != "" {
+		fmt.Fprintf(tw, "DESCRIPTION:\t%s\n", e.Description)
+	}
+	target := "none"
+	if e.Target != nil {
+		target = formatTarget(e.Target)
+	}
+	fmt.Fprintf(tw, "TARGET:\t%s\n", target)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(e.Fields) == 0 {
+		_, err := fmt.Fprintln(w, "\nThis action has no fields.")
+		return err
+	}
+
+	type row struct {
+		Field       string `json:"field"`
+		Required    string `json:"required"`
+		Selector    string `json:"selector"`
+		Constraints string `json:"constraints"`
+		Example     string `json:"example"`
+		Description string `json:"description"`
+	}
+	rows := make([]row, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		r := row{
+			Field:       f.Field,
+			Selector:    f.Selector,
+			Constraints: formatConstraints(f.Constraints),
+			Description: f.Description,
+		}
+		if f.Required {
+			r.Required = "yes"
+		}
+		if f.Example != nil {
+			r.Example = formatValue(f.Example)
+		}
+		rows = append(rows, r)
+	}
+	fmt.Fprintln(w)
+	return output.Render(w, output.FormatTable, rows, nil, renderOpts()...)
+}
+
+// formatTarget summarises an action's target, e.g.
+// "entity (domain: light), device (integration: hue)". Each kind holds a list
+// of filters, any one of which a target may match.
+func formatTarget(target map[string]interface{}) string {
+	kinds := make([]string, 0, len(target))
+	for k := range target {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	var parts []string
+	for _, kind := range kinds {
+		filters, ok := target[kind].([]interface{})
+		if !ok {
+			filters = []interface{}{target[kind]}
+		}
+		var alts []string
+		for _, f := range filters {
+			if m, ok := f.(map[string]interface{}); ok && len(m) > 0 {
+				alts = append(alts, formatConstraints(m))
+			}
+		}
+		if len(alts) == 0 {
+			parts = append(parts, kind)
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s (%s)", kind, strings.Join(alts, " or ")))
+	}
+	if len(parts) == 0 {
+		return "any"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatConstraints prints a selector configuration or target filter as
+// "key: value" pairs in key order. Select options are shown by value.
+func formatConstraints(m map[string]interface{}) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := m[k]
+		if k == "options" {
+			var raw []json.RawMessage
+			data, _ := json.Marshal(v)
+			if json.Unmarshal(data, &raw) == nil {
+				v = strings.Join(selectOptions(raw), "|")
+			}
+		}
+		parts = append(parts, k+": "+formatValue(v))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatValue prints scalars and lists of scalars plainly and anything else
+// as JSON.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				data, _ := json.Marshal(v)
+				return string(data)
+			}
+			items = append(items, formatValue(item))
+		}
+		return strings.Join(items, ",")
+	case map[string]interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return fmt.Sprint(v)
+}
+
+func init() {
+	actionCmd.AddCommand(actionExplainCmd)
+}
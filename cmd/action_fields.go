@@ -0,0 +1,304 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rnorth/ha-client/internal/client"
+)
+
+// dataField is one -d flag: key=value, or key:=<json> for a raw JSON value.
+type dataField struct {
+	key   string
+	value string
+	raw   bool
+}
+
+func parseDataFields(fields []string) ([]dataField, error) {
+	var out []dataField
+	for _, f := range fields {
+		k, v, ok := strings.Cut(f, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid -d flag %q: expected key=value", f)
+		}
+		d := dataField{key: k, value: v}
+		if strings.HasSuffix(k, ":") {
+			d.key, d.raw = strings.TrimSuffix(k, ":"), true
+		}
+		if d.key == "" {
+			return nil, fmt.Errorf("invalid -d flag %q: missing key", f)
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// targetKeys are accepted by every action that has a target.
+var targetKeys = []string{"entity_id", "device_id", "area_id", "floor_id", "label_id"}
+
+// actionSchema is what an action accepts, from the fields and target in
+// GET /api/services.
+type actionSchema struct {
+	name      string
+	detail    client.ActionDetail
+	fields    map[string]fieldSchema
+	hasTarget bool
+}
+
+// fieldSchema describes one field of an action. Selector has a single key
+// naming the selector type (number, boolean, color_rgb, entity, object, ...)
+// whose value configures it.
+type fieldSchema struct {
+	Name        string                     `json:"name"`
+	Description string                     `json:"description"`
+	Required    bool                       `json:"required"`
+	Example     interface{}                `json:"example"`
+	Selector    map[string]json.RawMessage `json:"selector"`
+	// Fields is set instead of Selector for a section, which groups fields
+	// (such as light.turn_on's "advanced_fields") without nesting their data.
+	Fields map[string]json.RawMessage `json:"fields"`
+
+	section string // the section the field was listed in, if any
+}
+
+func (f fieldSchema) selector() (string, json.RawMessage) {
+	for k, v := range f.Selector {
+		return k, v
+	}
+	return "", nil
+}
+
+// fetchActionSchema looks up an action's fields.
+func fetchActionSchema(ctx context.Context, c *client.RESTClient, domain, action string) (*actionSchema, error) {
+	domains, err := c.ListActions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetching action fields (use --no-validate to skip): %w", err)
+	}
+	s, err := findActionSchema(domains, domain, action)
+	if err != nil {
+		return nil, fmt.Errorf("%w (see 'ha-client action list', or use --no-validate)", err)
+	}
+	return s, nil
+}
+
+// findActionSchema picks one action out of GET /api/services. An action that
+// does not exist is reported as client.ErrNotFound.
+func findActionSchema(domains []client.ActionDomain, domain, action string) (*actionSchema, error) {
+	for _, d := range domains {
+		if d.Domain != domain {
+			continue
+		}
+		detail, ok := d.Services[action]
+		if !ok {
+			break
+		}
+		s := &actionSchema{name: domain + "." + action, detail: detail, fields: map[string]fieldSchema{}, hasTarget: detail.Target != nil}
+		for name, v := range detail.Fields {
+			raw, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			if err := s.addField(name, raw, ""); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("action %s.%s: %w", domain, action, client.ErrNotFound)
+}
+
+func (s *actionSchema) addField(name string, raw json.RawMessage, section string) error {
+	var f fieldSchema
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return fmt.Errorf("action %s: field %s: %w", s.name, name, err)
+	}
+	if f.Selector == nil && f.Fields != nil {
+		for sub, raw := range f.Fields {
+			if err := s.addField(sub, raw, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	f.section = section
+	s.fields[name] = f
+	return nil
+}
+
+// coerce converts a -d value to the JSON type its field's selector expects.
+// Values for fields without a known selector stay strings.
+func (s *actionSchema) coerce(key, value string) (interface{}, error) {
+	f, ok := s.fields[key]
+	if !ok {
+		return value, nil
+	}
+	typ, cfg := f.selector()
+	switch typ {
+	case "number", "color_temp":
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, usageError("field %s: %q is not a number", key, value)
+		}
+		return n, nil
+	case "boolean":
+		switch strings.ToLower(value) {
+		case "true", "on", "yes", "1":
+			return true, nil
+		case "false", "off", "no", "0":
+			return false, nil
+		}
+		return nil, usageError("field %s: %q is not a boolean (use true or false)", key, value)
+	case "color_rgb":
+		return parseRGB(key, value)
+	case "object":
+		var v interface{}
+		if err := json.Unmarshal([]byte(value), &v); err != nil {
+			return nil, usageError("field %s: value is not valid JSON: %v", key, err)
+		}
+		return v, nil
+	case "select", "entity":
+		var c struct {
+			Multiple bool `json:"multiple"`
+		}
+		_ = json.Unmarshal(cfg, &c)
+		if c.Multiple {
+			return strings.Split(value, ","), nil
+		}
+	}
+	return value, nil
+}
+
+// parseRGB accepts "[255,0,0]" or "255,0,0".
+func parseRGB(key, value string) ([]int, error) {
+	var rgb []int
+	if err := json.Unmarshal([]byte(value), &rgb); err != nil {
+		rgb = nil
+		for _, p := range strings.Split(value, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(p))
+			if err != nil {
+				return nil, usageError("field %s: %q is not an RGB color (e.g. [255,0,0])", key, value)
+			}
+			rgb = append(rgb, n)
+		}
+	}
+	if len(rgb) != 3 {
+		return nil, usageError("field %s: an RGB color needs 3 components, got %d", key, len(rgb))
+	}
+	for _, n := range rgb {
+		if n < 0 || n > 255 {
+			return nil, usageError("field %s: color component %d is out of range 0-255", key, n)
+		}
+	}
+	return rgb, nil
+}
+
+// validate rejects fields the action does not have, numbers outside their
+// selector's range and values a select does not offer. Many integration and
+// script actions declare no fields at all; any key is accepted for those.
+func (s *actionSchema) validate(data map[string]interface{}) error {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		f, ok := s.fields[k]
+		if !ok {
+			if len(s.fields) == 0 || (s.hasTarget && slices.Contains(targetKeys, k)) {
+				continue
+			}
+			return usageError("unknown field %q for %s (valid: %s)", k, s.name, strings.Join(s.validKeys(), ", "))
+		}
+		if err := checkValue(k, data[k], f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkValue(key string, v interface{}, f fieldSchema) error {
+	typ, cfg := f.selector()
+	switch typ {
+	case "number", "color_temp":
+		n, ok := v.(float64)
+		if !ok {
+			return nil
+		}
+		var r struct {
+			Min *float64 `json:"min"`
+			Max *float64 `json:"max"`
+		}
+		_ = json.Unmarshal(cfg, &r)
+		if (r.Min != nil && n < *r.Min) || (r.Max != nil && n > *r.Max) {
+			return usageError("field %s: %v is out of range %s-%s", key, n, formatBound(r.Min), formatBound(r.Max))
+		}
+	case "select":
+		var c struct {
+			Options     []json.RawMessage `json:"options"`
+			CustomValue bool              `json:"custom_value"`
+		}
+		_ = json.Unmarshal(cfg, &c)
+		if c.CustomValue || len(c.Options) == 0 {
+			return nil
+		}
+		options := selectOptions(c.Options)
+		values, ok := v.([]string)
+		if !ok {
+			s, isString := v.(string)
+			if !isString {
+				return nil
+			}
+			values = []string{s}
+		}
+		for _, s := range values {
+			if !slices.Contains(options, s) {
+				return usageError("field %s: %q is not one of %s", key, s, strings.Join(options, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// selectOptions returns the values of a select selector's options, which are
+// either plain strings or {"value": ..., "label": ...} objects.
+func selectOptions(raw []json.RawMessage) []string {
+	var out []string
+	for _, r := range raw {
+		var s string
+		if json.Unmarshal(r, &s) == nil {
+			out = append(out, s)
+			continue
+		}
+		var o struct {
+			Value string `json:"value"`
+		}
+		if json.Unmarshal(r, &o) == nil {
+			out = append(out, o.Value)
+		}
+	}
+	return out
+}
+
+func formatBound(b *float64) string {
+	if b == nil {
+		return "…"
+	}
+	return strconv.FormatFloat(*b, 'f', -1, 64)
+}
+
+func (s *actionSchema) validKeys() []string {
+	var keys []string
+	for k := range s.fields {
+		keys = append(keys, k)
+	}
+	if s.hasTarget {
+		keys = append(keys, targetKeys...)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/rnorth/ha-client/internal/client"
+	clierrors "github.com/rnorth/ha-client/internal/errors"
+	"golang.org/x/term"
+)
+
+// actionPlan is what action call would do: printed by --dry-run, and checked
+// before a real call to decide whether to ask for confirmation.
+type actionPlan struct {
+	Action string `json:"action" yaml:"action"`
+	// Entities are those the call would affect, with area, device, label and
+	// floor targets expanded through the registries.
+	Entities []string               `json:"entities" yaml:"entities"`
+	Data     map[string]interface{} `json:"data" yaml:"data"`
+	// Confirm gives the reasons a call would need --yes or a confirmation.
+	Confirm []string `json:"confirm,omitempty" yaml:"confirm,omitempty"`
+}
+
+var (
+	actionDryRun           bool
+	actionYes              bool
+	actionConfirmThreshold int
+)
+
+// sensitiveDomains are those whose entities always need confirmation: a
+// mistaken call can open a door or disarm an alarm.
+var sensitiveDomains = map[string]string{"lock": "a lock", "alarm_control_panel": "an alarm control panel"}
+
+func planAction(ctx context.Context, c *client.RESTClient, domain, action string, data map[string]interface{}, schema *actionSchema) (*actionPlan, error) {
+	entities, err := affectedEntities(ctx, c, data, schema)
+	if err != nil {
+		return nil, err
+	}
+	p := &actionPlan{Action: domain + "." + action, Entities: entities, Data: data}
+	if actionConfirmThreshold > 0 && len(entities) > actionConfirmThreshold {
+		p.Confirm = append(p.Confirm, fmt.Sprintf("affects %d entities (more than %d)", len(entities), actionConfirmThreshold))
+	}
+	if what, ok := sensitiveDomains[domain]; ok && len(entities) == 0 {
+		p.Confirm = append(p.Confirm, fmt.Sprintf("%s targets %s", p.Action, what))
+	}
+	var covers []string
+	for _, id := range entities {
+		d, _, _ := strings.Cut(id, ".")
+		if what, ok := sensitiveDomains[d]; ok {
+			p.Confirm = append(p.Confirm, fmt.Sprintf("%s is %s", id, what))
+		} else if d == "cover" {
+			covers = append(covers, id)
+		}
+	}
+	if len(covers) > 0 {
+		states, err := c.ListStates(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range states {
+			if slices.Contains(covers, s.EntityID) && s.Attributes["device_class"] == "garage" {
+				p.Confirm = append(p.Confirm, s.EntityID+" is a garage door")
+			}
+		}
+	}
+	return p, nil
+}
+
+// confirmAction asks before a call the plan says needs it. Without a terminal
+// there is no one to ask, so the call is refused unless --yes was given. So is
+// a call fanned out to several contexts: they run at once, and their prompts
+// would share stdin.
+func confirmAction(ctx context.Context, p *actionPlan) error {
+	if len(p.Confirm) == 0 || actionYes {
+		return nil
+	}
+	reasons := strings.Join(p.Confirm, "; ")
+	if !stdinIsTerminal() || fanOutFrom(ctx) != nil {
+		return &clierrors.CLIError{
+			Err:      fmt.Errorf("%s needs confirmation: %s (pass --yes to proceed, or --dry-run to check first)", p.Action, reasons),
+			ExitCode: clierrors.ExitUsage,
+			Code:     "confirmation_required",
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%s: %s.\nContinue? [y/N] ", p.Action, reasons)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return &clierrors.CLIError{Err: fmt.Errorf("%s: not confirmed", p.Action), ExitCode: clierrors.ExitGeneral, Code: "not_confirmed"}
+}
+
+// stdinIsTerminal is a variable so tests can stand in for a user at a TTY.
+var stdinIsTerminal = func() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// affectedEntities lists the entities a call's target keys refer to. Area,
+// device, label and floor targets are expanded the way Home Assistant does:
+// devices' entities follow their device's area unless they have their own,
+// hidden and config/diagnostic entities are skipped, and only entities in the
+// domains the action targets are kept. entity_id "all" is expanded to every
+// entity in those domains, or to every entity if they are not known, so that
+// entity policies see what it reaches.
+func affectedEntities(ctx context.Context, c *client.RESTClient, data map[string]interface{}, schema *actionSchema) ([]string, error) {
+	seen := map[string]bool{}
+	all := false
+	for _, id := range targetIDs(data["entity_id"]) {
+		switch {
+		case id == "all":
+			all = true
+		case !isEntityKeyword(id):
+			seen[id] = true
+		}
+	}
+	if all {
+		states, err := c.ListStates(ctx)
+		if err != nil {
+			return nil, err
+		}
+		domains := schema.targetDomains()
+		for _, s := range states {
+			if domains == nil || slices.Contains(domains, strings.SplitN(s.EntityID, ".", 2)[0]) {
+				seen[s.EntityID] = true
+			}
+		}
+	}
+	areaIDs := targetIDs(data["area_id"])
+	deviceIDs := targetIDs(data["device_id"])
+	labelIDs := targetIDs(data["label_id"])
+	floorIDs := targetIDs(data["floor_id"])
+	if len(areaIDs)+len(deviceIDs)+len(labelIDs)+len(floorIDs) > 0 {
+		wsc, err := newWSClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer wsc.Close()
+		areas, err := wsc.ListAreas(ctx)
+		if err != nil {
+			return nil, err
+		}
+		devices, err := wsc.ListDevices(ctx)
+		if err != nil {
+			return nil, err
+		}
+		entities, err := wsc.ListEntities(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, a := range areas {
+			if slices.Contains(floorIDs, a.FloorID) || hasLabel(a.Labels, labelIDs) {
+				areaIDs = append(areaIDs, a.AreaID)
+			}
+		}
+		var areaDevices []string
+		for _, d := range devices {
+			if hasLabel(d.Labels, labelIDs) {
+				deviceIDs = append(deviceIDs, d.ID)
+			}
+			if slices.Contains(areaIDs, d.AreaID) {
+				areaDevices = append(areaDevices, d.ID)
+			}
+		}
+		domains := schema.targetDomains()
+		for _, e := range entities {
+			if e.DisabledBy != nil || e.HiddenBy != nil || e.EntityCategory != "" {
+				continue
+			}
+			if domains != nil && !slices.Contains(domains, strings.SplitN(e.EntityID, ".", 2)[0]) {
+				continue
+			}
+			if hasLabel(e.Labels, labelIDs) ||
+				(e.DeviceID != "" && slices.Contains(deviceIDs, e.DeviceID)) ||
+				(e.AreaID != "" && slices.Contains(areaIDs, e.AreaID)) ||
+				(e.AreaID == "" && e.DeviceID != "" && slices.Contains(areaDevices, e.DeviceID)) {
+				seen[e.EntityID] = true
+			}
+		}
+	}
+	out := make([]string, 0, len(seen))
+	for id := range seen {
+		out = append(out, id)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// isEntityKeyword reports whether an entity_id value is "all" or "none", which
+// Home Assistant reads as every entity the action targets, or none of them.
+func isEntityKeyword(id string) bool {
+	return id == "all" || id == "none"
+}
+
+// targetIDs reads a target key's value, which may be one ID, a comma-separated
+// string of IDs or a list.
+func targetIDs(v interface{}) []string {
+	var out []string
+	switch v := v.(type) {
+	case string:
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				out = append(out, id)
+			}
+		}
+	case []string:
+		out = append(out, v...)
+	case []interface{}:
+		for _, id := range v {
+			if s, ok := id.(string); ok {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+func hasLabel(labels, want []string) bool {
+	for _, l := range labels {
+		if slices.Contains(want, l) {
+			return true
+		}
+	}
+	return false
+}
+
+// targetDomains returns the entity domains the action's target accepts, or nil
+// if it accepts entities of any domain (or the schema is unknown).
+func (s *actionSchema) targetDomains() []string {
+	if s == nil {
+		return nil
+	}
+	filters, ok := s.detail.Target["entity"].([]interface{})
+	if !ok {
+		filters = []interface{}{s.detail.Target["entity"]}
+	}
+	var domains []string
+	for _, f := range filters {
+		m, ok := f.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		d := targetIDs(m["domain"])
+		if len(d) == 0 {
+			return nil
+		}
+		domains = append(domains, d...)
+	}
+	return domains
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rnorth/ha-client/internal/client"
+)
+
+// actionTargetFlags are action call's --entity_id, --area, --device, --label
+// and --floor values.
+type actionTargetFlags struct {
+	entities []string
+	areas    []string
+	devices  []string
+	labels   []string
+	floors   []string
+}
+
+var actionTargets actionTargetFlags
+
+// registryEntry is an area, device, label or floor: the ID a target takes, and
+// the name a user is more likely to type.
+type registryEntry struct{ id, name string }
+
+// resolveTarget turns the target flags into the target keys of an action
+// call. Areas, devices, labels and floors may be given by ID or by name; names
+// are looked up in the registries, which are only fetched when needed.
+func resolveTarget(ctx context.Context, f actionTargetFlags) (map[string]interface{}, error) {
+	target := map[string]interface{}{}
+	if len(f.entities) > 0 {
+		target["entity_id"] = targetValue(f.entities)
+	}
+	if len(f.areas)+len(f.devices)+len(f.labels)+len(f.floors) == 0 {
+		return target, nil
+	}
+
+	wsc, err := newWSClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer wsc.Close()
+
+	kinds := []struct {
+		key, kind string
+		values    []string
+		list      func() ([]registryEntry, error)
+	}{
+		{"area_id", "area", f.areas, func() ([]registryEntry, error) {
+			areas, err := wsc.ListAreas(ctx)
+			out := make([]registryEntry, 0, len(areas))
+			for _, a := range areas {
+				out = append(out, registryEntry{a.AreaID, a.Name})
+			}
+			return out, err
+		}},
+		{"device_id", "device", f.devices, func() ([]registryEntry, error) {
+			devices, err := wsc.ListDevices(ctx)
+			out := make([]registryEntry, 0, len(devices))
+			for _, d := range devices {
+				out = append(out, registryEntry{d.ID, d.Name})
+			}
+			return out, err
+		}},
+		{"label_id", "label", f.labels, func() ([]registryEntry, error) {
+			labels, err := wsc.ListLabels(ctx)
+			out := make([]registryEntry, 0, len(labels))
+			for _, l := range labels {
+				out = append(out, registryEntry{l.LabelID, l.Name})
+			}
+			return out, err
+		}},
+		{"floor_id", "floor", f.floors, func() ([]registryEntry, error) {
+			floors, err := wsc.ListFloors(ctx)
+			out := make([]registryEntry, 0, len(floors))
+			for _, fl := range floors {
+				out = append(out, registryEntry{fl.FloorID, fl.Name})
+			}
+			return out, err
+		}},
+	}
+	for _, k := range kinds {
+		if len(k.values) == 0 {
+			continue
+		}
+		entries, err := k.list()
+		if err != nil {
+			return nil, fmt.Errorf("listing %ss: %w", k.kind, err)
+		}
+		ids := make([]string, 0, len(k.values))
+		for _, v := range k.values {
+			id, err := resolveRegistryID(k.kind, v, entries)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+		target[k.key] = targetValue(ids)
+	}
+	return target, nil
+}
+
+// resolveRegistryID matches value against IDs first, then against names
+// ignoring case. A name shared by several entries must be given by ID.
+func resolveRegistryID(kind, value string, entries []registryEntry) (string, error) {
+	for _, e := range entries {
+		if e.id == value {
+			return e.id, nil
+		}
+	}
+	var ids []string
+	for _, e := range entries {
+		if strings.EqualFold(e.name, value) {
+			ids = append(ids, e.id)
+		}
+	}
+	switch len(ids) {
+	case 0:
+		return "", fmt.Errorf("%s %q: %w", kind, value, client.ErrNotFound)
+	case 1:
+		return ids[0], nil
+	}
+	return "", usageError("%s name %q is ambiguous; use one of the IDs: %s", kind, value, strings.Join(ids, ", "))
+}
+
+// targetValue sends a single ID as a string and several as a list, as Home
+// Assistant's own UI does.
+func targetValue(ids []string) interface{} {
+	if len(ids) == 1 {
+		return ids[0]
+	}
+	return ids
+}
@@ -7,10 +7,40 @@ import (
 	"testing"
 
 	"github.com/rnorth/ha-client/internal/client"
+	clierrors "github.com/rnorth/ha-client/internal/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// actionSchemaHandler serves /api/services with the fields of a few actions,
+// as fetched by action call to type and check -d values and by action explain.
+func actionSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte(`[
+	  {"domain": "light", "services": {"turn_on": {
+	    "name": "Turn on",
+	    "description": "Turns on one or more lights.",
+	    "target": {"entity": [{"domain": ["light"]}], "device": [{"integration": "hue"}]},
+	    "fields": {
+	      "transition": {"selector": {"number": {"min": 0, "max": 300}}},
+	      "brightness_pct": {"name": "Brightness", "description": "Brightness in percent.", "example": 47,
+	        "selector": {"number": {"min": 0, "max": 100, "unit_of_measurement": "%"}}},
+	      "rgb_color": {"selector": {"color_rgb": {}}},
+	      "advanced_fields": {"collapsed": true, "fields": {
+	        "flash": {"selector": {"select": {"options": [{"label": "Short", "value": "short"}, {"label": "Long", "value": "long"}]}}},
+	        "effect": {"selector": {"text": {}}}
+	      }}
+	    }},
+	    "turn_off": {"target": {"entity": [{"domain": ["light"]}]}, "fields": {}}}},
+	  {"domain": "lock", "services": {"unlock": {"target": {"entity": [{"domain": ["lock"]}]}, "fields": {"code": {"selector": {"text": {}}}}}}},
+	  {"domain": "cover", "services": {"open_cover": {"target": {"entity": [{"domain": ["cover"]}]}, "fields": {}}}},
+	  {"domain": "weather", "services": {"get_forecasts": {
+	    "target": {"entity": [{"domain": ["weather"]}]},
+	    "fields": {"type": {"required": true, "selector": {"select": {"options": ["daily", "hourly", "twice_daily"]}}}}}}},
+	  {"domain": "notify", "services": {"send_message": {
+	    "fields": {"message": {"selector": {"text": {}}}, "data": {"selector": {"object": {}}}, "urgent": {"selector": {"boolean": {}}}}}}}
+	]`))
+}
+
 func TestActionList(t *testing.T) {
 	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
 		"/api/services": func(w http.ResponseWriter, r *http.Request) {
@@ -34,6 +64,7 @@ func TestActionList(t *testing.T) {
 func TestActionCall_EntityID(t *testing.T) {
 	var gotBody map[string]interface{}
 	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/services": actionSchemaHandler,
 		"/api/services/light/turn_on": func(w http.ResponseWriter, r *http.Request) {
 			assert.Equal(t, http.MethodPost, r.Method)
 			require.NoError(t, json.NewDecoder(r.Body).Decode(&gotBody))
@@ -46,7 +77,7 @@ func TestActionCall_EntityID(t *testing.T) {
 	t.Setenv("HASS_SERVER", srv.URL)
 	t.Setenv("HASS_TOKEN", "test-token")
 	t.Cleanup(func() {
-		actionEntityID = ""
+		actionTargets = actionTargetFlags{}
 		actionReturnResponse = false
 	})
 
@@ -58,6 +89,7 @@ func TestActionCall_EntityID(t *testing.T) {
 func TestActionCall_DataFields(t *testing.T) {
 	var gotBody map[string]interface{}
 	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/services": actionSchemaHandler,
 		"/api/services/light/turn_on": func(w http.ResponseWriter, r *http.Request) {
 			require.NoError(t, json.NewDecoder(r.Body).Decode(&gotBody))
 			w.WriteHeader(http.StatusOK)
@@ -79,13 +111,14 @@ func TestActionCall_DataFields(t *testing.T) {
 		"-d", "brightness_pct=80",
 	})
 	require.NoError(t, rootCmd.Execute())
-	assert.Equal(t, "5", gotBody["transition"])
-	assert.Equal(t, "80", gotBody["brightness_pct"])
+	assert.Equal(t, float64(5), gotBody["transition"])
+	assert.Equal(t, float64(80), gotBody["brightness_pct"])
 }
 
 func TestActionCall_DataJSON(t *testing.T) {
 	var gotBody map[string]interface{}
 	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/services": actionSchemaHandler,
 		"/api/services/light/turn_on": func(w http.ResponseWriter, r *http.Request) {
 			require.NoError(t, json.NewDecoder(r.Body).Decode(&gotBody))
 			w.WriteHeader(http.StatusOK)
@@ -113,6 +146,7 @@ func TestActionCall_DataJSON(t *testing.T) {
 func TestActionCall_MergeOrder(t *testing.T) {
 	var gotBody map[string]interface{}
 	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/services": actionSchemaHandler,
 		"/api/services/light/turn_on": func(w http.ResponseWriter, r *http.Request) {
 			require.NoError(t, json.NewDecoder(r.Body).Decode(&gotBody))
 			w.WriteHeader(http.StatusOK)
@@ -126,7 +160,7 @@ func TestActionCall_MergeOrder(t *testing.T) {
 	t.Cleanup(func() {
 		actionDataJSONRaw = ""
 		actionDataFields = nil
-		actionEntityID = ""
+		actionTargets = actionTargetFlags{}
 		actionReturnResponse = false
 	})
 
@@ -139,7 +173,7 @@ func TestActionCall_MergeOrder(t *testing.T) {
 	})
 	require.NoError(t, rootCmd.Execute())
 	assert.Equal(t, float64(50), gotBody["brightness_pct"]) // from --data-json, not overridden
-	assert.Equal(t, "5", gotBody["transition"])              // -d overrides data-json
+	assert.Equal(t, float64(5), gotBody["transition"])       // -d overrides data-json
 	assert.Equal(t, "light.desk", gotBody["entity_id"])      // --entity_id wins
 }
 
@@ -159,6 +193,7 @@ func TestActionCall_InvalidDataField(t *testing.T) {
 
 func TestActionCall_ChangedStates(t *testing.T) {
 	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/services": actionSchemaHandler,
 		"/api/services/light/turn_on": func(w http.ResponseWriter, r *http.Request) {
 			assert.Equal(t, http.MethodPost, r.Method)
 			assert.Empty(t, r.URL.RawQuery)
@@ -172,7 +207,7 @@ func TestActionCall_ChangedStates(t *testing.T) {
 	t.Setenv("HASS_SERVER", srv.URL)
 	t.Setenv("HASS_TOKEN", "test-token")
 	t.Cleanup(func() {
-		actionEntityID = ""
+		actionTargets = actionTargetFlags{}
 		actionReturnResponse = false
 	})
 
@@ -190,6 +225,7 @@ func TestActionCall_ChangedStates(t *testing.T) {
 
 func TestActionCall_QuietMode(t *testing.T) {
 	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/services": actionSchemaHandler,
 		"/api/services/light/turn_on": func(w http.ResponseWriter, r *http.Request) {
 			_ = json.NewEncoder(w).Encode([]client.State{})
 		},
@@ -198,7 +234,7 @@ func TestActionCall_QuietMode(t *testing.T) {
 
 	t.Setenv("HASS_SERVER", srv.URL)
 	t.Setenv("HASS_TOKEN", "test-token")
-	t.Cleanup(func() { quietMode = false; actionEntityID = "" })
+	t.Cleanup(func() { quietMode = false; actionTargets = actionTargetFlags{} })
 
 	rootCmd.SetArgs([]string{"action", "call", "light.turn_on", "--entity_id=light.desk", "-q"})
 	require.NoError(t, rootCmd.Execute())
@@ -206,6 +242,7 @@ func TestActionCall_QuietMode(t *testing.T) {
 
 func TestActionCall_ReturnResponse(t *testing.T) {
 	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/services": actionSchemaHandler,
 		"/api/services/weather/get_forecasts": func(w http.ResponseWriter, r *http.Request) {
 			assert.Equal(t, http.MethodPost, r.Method)
 			assert.Equal(t, "return_response", r.URL.RawQuery)
@@ -220,7 +257,7 @@ func TestActionCall_ReturnResponse(t *testing.T) {
 	t.Setenv("HASS_SERVER", srv.URL)
 	t.Setenv("HASS_TOKEN", "test-token")
 	t.Cleanup(func() {
-		actionEntityID = ""
+		actionTargets = actionTargetFlags{}
 		actionReturnResponse = false
 	})
 
@@ -238,3 +275,295 @@ func TestActionCall_ReturnResponse(t *testing.T) {
 	require.NoError(t, json.Unmarshal(buf.Bytes(), &respData))
 	assert.Contains(t, respData, "weather.home")
 }
+
+func TestActionCall_SchemaTyping(t *testing.T) {
+	var gotBody map[string]interface{}
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/services": actionSchemaHandler,
+		"/api/services/notify/send_message": func(w http.ResponseWriter, r *http.Request) {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&gotBody))
+			_, _ = w.Write([]byte("[]"))
+		},
+		"/api/services/light/turn_on": func(w http.ResponseWriter, r *http.Request) {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&gotBody))
+			_, _ = w.Write([]byte("[]"))
+		},
+		"/api/services/light/turn_off": func(w http.ResponseWriter, r *http.Request) {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&gotBody))
+			_, _ = w.Write([]byte("[]"))
+		},
+	})
+	defer srv.Close()
+
+	t.Setenv("HASS_SERVER", srv.URL)
+	t.Setenv("HASS_TOKEN", "test-token")
+	t.Cleanup(func() { actionDataFields, actionTargets = nil, actionTargetFlags{} })
+
+	run := func(args ...string) error {
+		actionDataFields, actionTargets = nil, actionTargetFlags{}
+		return runCLI(t, append([]string{"action", "call"}, args...)...)
+	}
+
+	require.NoError(t, run("light.turn_on", "--entity_id=light.desk", "-d", "rgb_color=[255,0,0]", "-d", "flash=short", "-d", "effect=80"))
+	assert.Equal(t, []interface{}{float64(255), float64(0), float64(0)}, gotBody["rgb_color"])
+	assert.Equal(t, "short", gotBody["flash"], "fields inside sections are known")
+	assert.Equal(t, "80", gotBody["effect"], "text fields stay strings")
+
+	require.NoError(t, run("notify.send_message", "-d", "message=Hi", "-d", `data={"ttl":0}`, "-d", "urgent=true"))
+	assert.Equal(t, map[string]interface{}{"ttl": float64(0)}, gotBody["data"])
+	assert.Equal(t, true, gotBody["urgent"])
+
+	require.NoError(t, run("notify.send_message", "-d", "message:=42"))
+	assert.Equal(t, float64(42), gotBody["message"], "key:= sends raw JSON")
+
+	require.NoError(t, run("light.turn_off", "--entity_id=light.desk", "-d", "transition=2"))
+	assert.Equal(t, "2", gotBody["transition"], "an action that declares no fields accepts any, untyped")
+
+	for _, tc := range []struct {
+		args []string
+		msg  string
+	}{
+		{[]string{"light.turn_on", "-d", "brightness=50"}, `unknown field "brightness" for light.turn_on`},
+		{[]string{"light.turn_on", "-d", "brightness_pct=150"}, "field brightness_pct: 150 is out of range 0-100"},
+		{[]string{"light.turn_on", "--data-json", `{"transition":-1}`}, "field transition: -1 is out of range 0-300"},
+		{[]string{"light.turn_on", "-d", "brightness_pct=bright"}, `field brightness_pct: "bright" is not a number`},
+		{[]string{"light.turn_on", "-d", "rgb_color=255,0"}, "an RGB color needs 3 components"},
+		{[]string{"light.turn_on", "-d", "flash=medium"}, `"medium" is not one of short, long`},
+		{[]string{"notify.send_message", "--entity_id=light.desk"}, `unknown field "entity_id"`},
+	} {
+		err := run(tc.args...)
+		require.Error(t, err, tc.args)
+		assert.Contains(t, err.Error(), tc.msg)
+		assert.Equal(t, clierrors.ExitUsage, clierrors.Classify(err).ExitCode)
+	}
+
+	err := run("light.turn_sideways")
+	assert.Equal(t, clierrors.ExitNotFound, clierrors.Classify(err).ExitCode)
+}
+
+func TestActionCall_NoValidate(t *testing.T) {
+	var gotBody map[string]interface{}
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/services": func(w http.ResponseWriter, r *http.Request) {
+			t.Error("--no-validate must not fetch the action's fields")
+		},
+		"/api/services/light/turn_on": func(w http.ResponseWriter, r *http.Request) {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&gotBody))
+			_, _ = w.Write([]byte("[]"))
+		},
+	})
+	defer srv.Close()
+
+	t.Setenv("HASS_SERVER", srv.URL)
+	t.Setenv("HASS_TOKEN", "test-token")
+	t.Cleanup(func() { actionDataFields, actionNoValidate = nil, false })
+
+	require.NoError(t, runCLI(t, "action", "call", "light.turn_on", "--no-validate", "-d", "brightness=50", "-d", "rgb_color:=[1,2,3]"))
+	assert.Equal(t, "50", gotBody["brightness"])
+	assert.Equal(t, []interface{}{float64(1), float64(2), float64(3)}, gotBody["rgb_color"])
+}
+
+func TestActionExplain(t *testing.T) {
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{"/api/services": actionSchemaHandler})
+	defer srv.Close()
+
+	t.Setenv("HASS_SERVER", srv.URL)
+	t.Setenv("HASS_TOKEN", "test-token")
+
+	out, err := captureStdout(t, func() error {
+		return runCLI(t, "action", "explain", "light.turn_on", "-o", "table")
+	})
+	require.NoError(t, err)
+	assert.Contains(t, out, "Turns on one or more lights.")
+	assert.Contains(t, out, "device (integration: hue), entity (domain: light)")
+	assert.Contains(t, out, "max: 100, min: 0, unit_of_measurement: %")
+	assert.Contains(t, out, "Brightness in percent.")
+	assert.Contains(t, out, "options: short|long")
+
+	out, err = captureStdout(t, func() error {
+		return runCLI(t, "action", "explain", "weather.get_forecasts", "-o", "json")
+	})
+	require.NoError(t, err)
+	var got actionExplanation
+	require.NoError(t, json.Unmarshal([]byte(out), &got))
+	assert.Equal(t, "weather.get_forecasts", got.Action)
+	require.Len(t, got.Fields, 1)
+	assert.Equal(t, "type", got.Fields[0].Field)
+	assert.True(t, got.Fields[0].Required)
+	assert.Equal(t, "select", got.Fields[0].Selector)
+	assert.Equal(t, []interface{}{"daily", "hourly", "twice_daily"}, got.Fields[0].Constraints["options"])
+
+	out, err = captureStdout(t, func() error {
+		return runCLI(t, "action", "explain", "light.turn_on", "-o", "json")
+	})
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(out), &got))
+	var fields []string
+	for _, f := range got.Fields {
+		fields = append(fields, f.Field)
+		if f.Field == "flash" {
+			assert.Equal(t, "advanced_fields", f.Section)
+		}
+	}
+	assert.Equal(t, []string{"brightness_pct", "rgb_color", "transition", "effect", "flash"}, fields)
+
+	err = runCLI(t, "action", "explain", "light.turn_sideways")
+	assert.Equal(t, clierrors.ExitNotFound, clierrors.Classify(err).ExitCode)
+}
+
+func TestActionCall_Targets(t *testing.T) {
+	var gotBody map[string]interface{}
+	// serve answers REST calls and the WebSocket registry lookups, in order.
+	serve := func(registries ...interface{}) {
+		ws := newMockWSServer(t, registries)
+		t.Cleanup(ws.Close)
+		srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+			"/api/websocket": ws.Config.Handler.ServeHTTP,
+			"/api/services":  actionSchemaHandler,
+			"/api/services/light/turn_off": func(w http.ResponseWriter, r *http.Request) {
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&gotBody))
+				_, _ = w.Write([]byte("[]"))
+			},
+		})
+		t.Cleanup(srv.Close)
+		t.Setenv("HASS_SERVER", srv.URL)
+	}
+	t.Setenv("HASS_TOKEN", "test-token")
+	actionDataJSONRaw, actionDataFields = "", nil
+	t.Cleanup(func() { actionTargets = actionTargetFlags{} })
+
+	serve(
+		[]client.Area{{AreaID: "kitchen", Name: "Kitchen"}, {AreaID: "living_room", Name: "Living Room"}},
+		[]client.Device{{ID: "abc123", Name: "Desk Lamp"}},
+		[]client.Label{{LabelID: "night", Name: "Night lights"}, {LabelID: "night_2", Name: "night lights"}},
+	)
+	require.NoError(t, runCLI(t, "action", "call", "light.turn_off",
+		"--entity_id=light.desk", "--entity_id=light.hall",
+		"--area", "kitchen", "--area", "living room", "--device", "Desk Lamp", "--label", "night"))
+	assert.Equal(t, map[string]interface{}{
+		"entity_id": []interface{}{"light.desk", "light.hall"},
+		"area_id":   []interface{}{"kitchen", "living_room"},
+		"device_id": "abc123",
+		"label_id":  "night",
+	}, gotBody)
+
+	actionTargets = actionTargetFlags{}
+	serve([]client.Label{{LabelID: "night", Name: "Night lights"}, {LabelID: "night_2", Name: "night lights"}})
+	err := runCLI(t, "action", "call", "light.turn_off", "--label", "Night Lights")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ambiguous; use one of the IDs: night, night_2")
+	assert.Equal(t, clierrors.ExitUsage, clierrors.Classify(err).ExitCode)
+
+	actionTargets = actionTargetFlags{}
+	serve([]client.Floor{{FloorID: "upstairs", Name: "Upstairs"}})
+	err = runCLI(t, "action", "call", "light.turn_off", "--floor", "Attic")
+	assert.Equal(t, clierrors.ExitNotFound, clierrors.Classify(err).ExitCode)
+}
+
+func TestActionCall_DryRun(t *testing.T) {
+	hidden := "user"
+	ws := newMockWSServer(t, []interface{}{
+		[]client.Area{{AreaID: "kitchen", Name: "Kitchen"}, {AreaID: "office", Name: "Office"}},
+		[]client.Device{{ID: "strip", Name: "Light strip", AreaID: "kitchen"}},
+		[]client.EntityEntry{
+			{EntityID: "light.ceiling", AreaID: "kitchen"},
+			{EntityID: "light.strip", DeviceID: "strip"},
+			{EntityID: "switch.fan", AreaID: "kitchen"},
+			{EntityID: "light.hidden", AreaID: "kitchen", HiddenBy: &hidden},
+			{EntityID: "light.desk", AreaID: "office"},
+		},
+	})
+	defer ws.Close()
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/websocket": ws.Config.Handler.ServeHTTP,
+		"/api/services":  actionSchemaHandler,
+		"/api/services/light/turn_off": func(w http.ResponseWriter, r *http.Request) {
+			t.Error("--dry-run must not call the action")
+		},
+	})
+	defer srv.Close()
+
+	t.Setenv("HASS_SERVER", srv.URL)
+	t.Setenv("HASS_TOKEN", "test-token")
+	actionDataJSONRaw, actionDataFields = "", nil
+	t.Cleanup(func() { actionTargets, actionDryRun = actionTargetFlags{}, false })
+
+	var buf bytes.Buffer
+	rootCmd.SetOut(&buf)
+	t.Cleanup(func() { rootCmd.SetOut(nil) })
+	require.NoError(t, runCLI(t, "action", "call", "light.turn_off", "--area", "Kitchen", "--dry-run", "-o", "json"))
+	var plan actionPlan
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &plan))
+	assert.Equal(t, actionPlan{
+		Action:   "light.turn_off",
+		Entities: []string{"light.ceiling", "light.strip"},
+		Data:     map[string]interface{}{"area_id": "kitchen"},
+	}, plan)
+}
+
+func TestActionCall_Confirmation(t *testing.T) {
+	var calls int
+	call := func(w http.ResponseWriter, r *http.Request) { calls++; _, _ = w.Write([]byte("[]")) }
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/services": actionSchemaHandler,
+		"/api/states": func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewEncoder(w).Encode([]client.State{
+				{EntityID: "cover.garage", Attributes: map[string]interface{}{"device_class": "garage"}},
+				{EntityID: "cover.blinds", Attributes: map[string]interface{}{"device_class": "blind"}},
+			})
+		},
+		"/api/services/lock/unlock":      call,
+		"/api/services/light/turn_off":   call,
+		"/api/services/cover/open_cover": call,
+	})
+	defer srv.Close()
+
+	t.Setenv("HASS_SERVER", srv.URL)
+	t.Setenv("HASS_TOKEN", "test-token")
+	actionDataJSONRaw, actionDataFields = "", nil
+	run := func(args ...string) error {
+		t.Helper()
+		actionTargets, actionYes, actionConfirmThreshold = actionTargetFlags{}, false, 10
+		return runCLI(t, append([]string{"action", "call"}, args...)...)
+	}
+	t.Cleanup(func() { actionTargets, actionYes, actionConfirmThreshold = actionTargetFlags{}, false, 10 })
+
+	for _, args := range [][]string{
+		{"lock.unlock", "--entity_id=lock.front_door"},
+		{"light.turn_off", "--entity_id=light.a", "--entity_id=light.b", "--confirm-threshold=1"},
+		{"cover.open_cover", "--entity_id=cover.garage"},
+	} {
+		err := run(args...)
+		require.Error(t, err, args)
+		assert.Contains(t, err.Error(), "needs confirmation")
+		assert.Equal(t, "confirmation_required", clierrors.Classify(err).Code)
+		assert.Equal(t, clierrors.ExitUsage, clierrors.Classify(err).ExitCode)
+	}
+	assert.Equal(t, 0, calls)
+
+	require.NoError(t, run("cover.open_cover", "--entity_id=cover.blinds"))
+	require.NoError(t, run("lock.unlock", "--entity_id=lock.front_door", "--yes"))
+	assert.Equal(t, 2, calls)
+
+	stdinIsTerminal = func() bool { return true }
+	t.Cleanup(func() { stdinIsTerminal = func() bool { return false } })
+	withStdin(t, "n\n")
+	err := run("lock.unlock", "--entity_id=lock.front_door")
+	assert.Equal(t, "not_confirmed", clierrors.Classify(err).Code)
+	withStdin(t, "y\n")
+	require.NoError(t, run("lock.unlock", "--entity_id=lock.front_door"))
+	assert.Equal(t, 3, calls)
+
+	// Fanned-out calls run at once, so they cannot share a prompt.
+	setupConfigHome(t)
+	require.NoError(t, runCLI(t, "config", "set-context", "home", "--server", srv.URL, "--token", "t1"))
+	require.NoError(t, runCLI(t, "config", "set-context", "cabin", "--server", srv.URL, "--token", "t2"))
+	withStdin(t, "y\n")
+	err = run("lock.unlock", "--entity_id=lock.front_door", "--all-contexts")
+	require.Error(t, err)
+	assert.Equal(t, "2 of 2 contexts failed", err.Error())
+	assert.Equal(t, clierrors.ExitUsage, clierrors.Classify(err).ExitCode)
+	assert.Equal(t, 3, calls)
+	require.NoError(t, run("lock.unlock", "--entity_id=lock.front_door", "--all-contexts", "--yes"))
+	assert.Equal(t, 5, calls)
+}
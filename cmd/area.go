@@ -1,9 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 
+	"github.com/rnorth/ha-client/internal/client"
 	"github.com/rnorth/ha-client/internal/output"
 	"github.com/spf13/cobra"
 )
@@ -18,18 +20,18 @@ var areaListCmd = &cobra.Command{
 Examples:
   ha-client area list
   ha-client area list -o json`,
-	RunE: func(cmd *cobra.Command, args []string) error {
-		wsc, err := newWSClient()
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		wsc, err := newWSClient(ctx)
 		if err != nil {
 			return err
 		}
 		defer wsc.Close()
-		areas, err := wsc.ListAreas()
+		areas, err := wsc.ListAreas(ctx)
 		if err != nil {
 			return err
 		}
-		return output.Render(os.Stdout, resolveFormat(), areas, nil, renderOpts()...)
-	},
+		return render(ctx, os.Stdout, resolveFormat(), areas, []string{"AreaID", "Name", "FloorID"}, renderOpts(output.WithWideColumns("LABELS:.labels"))...)
+	}),
 }
 
 var areaGetCmd = &cobra.Command{
@@ -41,23 +43,23 @@ Examples:
   ha-client area get living_room
   ha-client area get "Living Room"`,
 	Args:  cobra.ExactArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		wsc, err := newWSClient()
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		wsc, err := newWSClient(ctx)
 		if err != nil {
 			return err
 		}
 		defer wsc.Close()
-		areas, err := wsc.ListAreas()
+		areas, err := wsc.ListAreas(ctx)
 		if err != nil {
 			return err
 		}
 		for _, a := range areas {
 			if a.AreaID == args[0] || a.Name == args[0] {
-				return output.Render(os.Stdout, resolveFormat(), a, nil, renderOpts()...)
+				return render(ctx, os.Stdout, resolveFormat(), a, nil, renderOpts()...)
 			}
 		}
-		return fmt.Errorf("area %q not found", args[0])
-	},
+		return fmt.Errorf("area %q: %w", args[0], client.ErrNotFound)
+	}),
 }
 
 var areaCreateCmd = &cobra.Command{
@@ -68,18 +70,19 @@ var areaCreateCmd = &cobra.Command{
 Examples:
   ha-client area create "Guest Room"`,
 	Args:  cobra.ExactArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		wsc, err := newWSClient()
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		wsc, err := newWSClient(ctx)
 		if err != nil {
 			return err
 		}
 		defer wsc.Close()
-		area, err := wsc.CreateArea(args[0])
+		auditPayload(ctx, map[string]interface{}{"name": args[0]})
+		area, err := wsc.CreateArea(ctx, args[0])
 		if err != nil {
 			return err
 		}
-		return output.Render(os.Stdout, resolveFormat(), area, nil, renderOpts()...)
-	},
+		return render(ctx, os.Stdout, resolveFormat(), area, nil, renderOpts()...)
+	}),
 }
 
 var areaDeleteCmd = &cobra.Command{
@@ -90,18 +93,19 @@ var areaDeleteCmd = &cobra.Command{
 Examples:
   ha-client area delete guest_room`,
 	Args:  cobra.ExactArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		wsc, err := newWSClient()
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		wsc, err := newWSClient(ctx)
 		if err != nil {
 			return err
 		}
 		defer wsc.Close()
-		if err := wsc.DeleteArea(args[0]); err != nil {
+		auditPayload(ctx, map[string]interface{}{"area_id": args[0]})
+		if err := wsc.DeleteArea(ctx, args[0]); err != nil {
 			return err
 		}
 		info("Area deleted.")
 		return nil
-	},
+	}),
 }
 
 func init() {
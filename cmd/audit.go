@@ -0,0 +1,334 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rnorth/ha-client/internal/client"
+	"github.com/rnorth/ha-client/internal/config"
+	clierrors "github.com/rnorth/ha-client/internal/errors"
+	"github.com/rnorth/ha-client/internal/output"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// auditEntry is one line of the audit log: a command that changed (or tried
+// to change) Home Assistant.
+type auditEntry struct {
+	Time        time.Time   `json:"time" yaml:"time"`
+	Context     string      `json:"context" yaml:"context"`
+	Server      string      `json:"server,omitempty" yaml:"server,omitempty"`
+	User        string      `json:"user" yaml:"user"`
+	Command     string      `json:"command" yaml:"command"`
+	CommandLine string      `json:"command_line" yaml:"command_line"`
+	Payload     interface{} `json:"payload,omitempty" yaml:"payload,omitempty"`
+	Result      string      `json:"result" yaml:"result"` // "ok" or "error"
+	Error       string      `json:"error,omitempty" yaml:"error,omitempty"`
+	ErrorCode   string      `json:"error_code,omitempty" yaml:"error_code,omitempty"`
+}
+
+type auditKey struct{}
+
+func auditFrom(ctx context.Context) *auditEntry {
+	e, _ := ctx.Value(auditKey{}).(*auditEntry)
+	return e
+}
+
+// auditPayload records what a mutating command sent, e.g. an action's data.
+func auditPayload(ctx context.Context, v interface{}) {
+	if e := auditFrom(ctx); e != nil {
+		e.Payload = v
+	}
+}
+
+// audited logs run to the audit log if this invocation of cmd mutates Home
+// Assistant, whether it succeeds, fails or is denied by a policy.
+func audited(run runFunc) runFunc {
+	return func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		if !mutates(cmd) {
+			return run(ctx, cmd, args)
+		}
+		e := &auditEntry{
+			Time:        time.Now(),
+			User:        osUser(),
+			Command:     commandName(cmd),
+			CommandLine: commandLine(cmd, args),
+		}
+		if fo := fanOutFrom(ctx); fo != nil {
+			e.Context = fo.context
+		} else if name, err := selectedContext(); err == nil {
+			e.Context = name
+		}
+		err := run(context.WithValue(ctx, auditKey{}, e), cmd, args)
+		e.Result = "ok"
+		if err != nil {
+			ce := clierrors.Classify(err)
+			e.Result, e.Error, e.ErrorCode = "error", ce.Error(), ce.Code
+		}
+		if werr := writeAudit(e); werr != nil {
+			fmt.Fprintf(os.Stderr, "audit log: %v\n", werr)
+		}
+		return err
+	}
+}
+
+func osUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// secretFlags are flags whose values are kept out of the audit log.
+var secretFlags = map[string]bool{"token": true, "header": true}
+
+// flagsMu serialises commandLine: a fanned-out command is audited once per
+// context, concurrently, and visiting a flag set sorts it in place.
+var flagsMu sync.Mutex
+
+// commandLine reconstructs the command as typed, from its arguments and the
+// flags that were set to something other than their default.
+func commandLine(cmd *cobra.Command, args []string) string {
+	flagsMu.Lock()
+	defer flagsMu.Unlock()
+	parts := append([]string{cmd.CommandPath()}, args...)
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if f.Value.String() == f.DefValue {
+			return
+		}
+		values := []string{f.Value.String()}
+		if s, ok := f.Value.(pflag.SliceValue); ok {
+			values = s.GetSlice()
+		}
+		for _, v := range values {
+			switch {
+			case secretFlags[f.Name]:
+				v = "[REDACTED]"
+			case f.Value.Type() == "bool" && v == "true":
+				parts = append(parts, "--"+f.Name)
+				continue
+			}
+			parts = append(parts, "--"+f.Name+"="+redactFlagValue(v))
+		}
+	})
+	return strings.Join(parts, " ")
+}
+
+// redactFlagValue masks secrets given as -d key=value or inside a JSON flag.
+func redactFlagValue(v string) string {
+	if k, _, ok := strings.Cut(v, "="); ok && auditSecret(strings.TrimSuffix(k, ":")) {
+		return k + "=[REDACTED]"
+	}
+	var obj map[string]interface{}
+	if json.Unmarshal([]byte(v), &obj) == nil {
+		if data, err := json.Marshal(redactPayload(obj)); err == nil {
+			return string(data)
+		}
+	}
+	return v
+}
+
+// auditSecret reports whether a payload field is masked in the audit log: the
+// credentials a trace masks (see client.IsSecretField), and the code given to
+// actions such as lock.unlock.
+func auditSecret(name string) bool {
+	return client.IsSecretField(name) || name == "code"
+}
+
+// redactPayload masks secret fields (see auditSecret) before a payload is
+// written to the audit log.
+func redactPayload(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			if auditSecret(k) {
+				out[k] = "[REDACTED]"
+			} else {
+				out[k] = redactPayload(val)
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i := range v {
+			out[i] = redactPayload(v[i])
+		}
+		return out
+	}
+	return v
+}
+
+// auditMu serialises writes: fanned-out commands finish concurrently.
+var auditMu sync.Mutex
+
+func writeAudit(e *auditEntry) error {
+	if e.Payload != nil {
+		// Round-trip through JSON so that typed payloads are redacted too.
+		data, err := json.Marshal(e.Payload)
+		if err != nil {
+			return err
+		}
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		e.Payload = redactPayload(v)
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	path, err := auditLogPath()
+	if err != nil {
+		return err
+	}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func auditLogPath() (string, error) {
+	file, err := config.LoadFile(config.DefaultConfigPath())
+	if err != nil {
+		return "", err
+	}
+	return file.AuditLogPath(), nil
+}
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Inspect the log of changes made to Home Assistant",
+	Long: `Every command that changes Home Assistant (action call, state set, automation
+apply/enable/disable/trigger, area create/delete, ...) appends a line to the
+audit log: when, which context and server, which OS user, the command line, the
+payload sent and whether it succeeded. Commands denied by a policy are logged
+too. Secrets (tokens, lock codes) are redacted.
+
+The log is audit.log in the config directory unless audit_log is set in the
+config file.`,
+}
+
+var auditSince string
+
+var auditListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List audit log entries",
+	Long: `List audit log entries, oldest first.
+
+Examples:
+  ha-client audit list
+  ha-client audit list --since 1h
+  ha-client audit list --since 2024-06-01T22:00:00Z -o json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var since time.Time
+		if auditSince != "" {
+			t, err := parseSince(auditSince)
+			if err != nil {
+				return err
+			}
+			since = t
+		}
+		path, err := auditLogPath()
+		if err != nil {
+			return err
+		}
+		entries, err := readAudit(path, since)
+		if err != nil {
+			return err
+		}
+		format := resolveFormat()
+		switch format {
+		case output.FormatTable, output.FormatWide, output.FormatCSV, output.FormatTSV, output.FormatMarkdown:
+		default:
+			return output.Render(os.Stdout, format, entries, nil, renderOpts()...)
+		}
+		type row struct {
+			Time        string `json:"time"`
+			Context     string `json:"context"`
+			Server      string `json:"server"`
+			User        string `json:"user"`
+			CommandLine string `json:"command_line"`
+			Result      string `json:"result"`
+			Error       string `json:"error"`
+		}
+		rows := make([]row, 0, len(entries))
+		for _, e := range entries {
+			result := e.Result
+			if e.ErrorCode != "" {
+				result += " (" + e.ErrorCode + ")"
+			}
+			rows = append(rows, row{e.Time.Local().Format(time.DateTime), e.Context, e.Server, e.User, e.CommandLine, result, e.Error})
+		}
+		return output.Render(os.Stdout, format, rows, []string{"Time", "Context", "User", "CommandLine", "Result"},
+			renderOpts(output.WithWideColumns("Server", "Error"))...)
+	},
+}
+
+// parseSince accepts a duration back from now ("1h", "30m") or a timestamp.
+func parseSince(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateTime, time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, usageError("invalid --since %q: expected a duration (e.g. 1h) or a time (e.g. 2024-06-01T22:00:00Z)", s)
+}
+
+// readAudit returns the entries logged at or after since. A missing log has
+// no entries; lines that cannot be parsed (e.g. cut short by a full disk) are
+// skipped.
+func readAudit(path string, since time.Time) ([]auditEntry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []auditEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries := []auditEntry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		var e auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			verbosef("audit log line %d: %v", n, err)
+			continue
+		}
+		if !e.Time.Before(since) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+func init() {
+	auditListCmd.Flags().StringVar(&auditSince, "since", "", "only show entries newer than a duration (e.g. 1h) or a time")
+	auditCmd.AddCommand(auditListCmd)
+	rootCmd.AddCommand(auditCmd)
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog(t *testing.T) {
+	path := setupConfigHome(t)
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/services":             actionSchemaHandler,
+		"/api/services/lock/unlock": func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("[]")) },
+		"/api/states/input_boolean.guest_mode": func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"entity_id":"input_boolean.guest_mode","state":"on"}`))
+		},
+	})
+	defer srv.Close()
+	t.Setenv("HASS_SERVER", srv.URL)
+	t.Setenv("HASS_TOKEN", "test-token")
+	readOnly := filepath.Join(t.TempDir(), "read-only.yaml")
+	require.NoError(t, os.WriteFile(readOnly, []byte("read_only: true\n"), 0600))
+	actionDataJSONRaw = ""
+	t.Cleanup(func() { actionTargets, actionDataFields, actionYes = actionTargetFlags{}, nil, false })
+
+	_, err := captureStdout(t, func() error {
+		require.NoError(t, runCLI(t, "action", "call", "lock.unlock", "--entity_id=lock.front_door", "-d", "code=1234", "--yes"))
+		require.NoError(t, runCLI(t, "state", "get", "input_boolean.guest_mode"), "reads are not logged")
+		require.NoError(t, runCLI(t, "state", "set", "input_boolean.guest_mode", "on"))
+		return runCLI(t, "state", "set", "input_boolean.guest_mode", "off", "--policy", readOnly)
+	})
+	require.Error(t, err)
+
+	out, err := captureStdout(t, func() error {
+		return runCLI(t, "audit", "list", "--since", "1h", "-o", "json")
+	})
+	require.NoError(t, err)
+	var entries []auditEntry
+	require.NoError(t, json.Unmarshal([]byte(out), &entries))
+	require.Len(t, entries, 3)
+
+	unlock := entries[0]
+	assert.Equal(t, "default", unlock.Context)
+	assert.Equal(t, srv.URL, unlock.Server)
+	assert.Equal(t, "action call", unlock.Command)
+	assert.Equal(t, "ha-client action call lock.unlock --data=code=[REDACTED] --entity_id=lock.front_door --yes", unlock.CommandLine)
+	assert.Equal(t, map[string]interface{}{"entity_id": "lock.front_door", "code": "[REDACTED]"}, unlock.Payload)
+	assert.Equal(t, "ok", unlock.Result)
+	assert.NotEmpty(t, unlock.User)
+
+	assert.Equal(t, map[string]interface{}{"entity_id": "input_boolean.guest_mode", "state": "on", "attributes": nil}, entries[1].Payload)
+	assert.Equal(t, "error", entries[2].Result)
+	assert.Equal(t, "policy_denied", entries[2].ErrorCode)
+
+	out, err = captureStdout(t, func() error {
+		return runCLI(t, "audit", "list", "--since", time.Now().Add(time.Hour).Format(time.RFC3339), "-o", "json")
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, "[]", out)
+
+	// audit_log in the config file moves the log.
+	custom := filepath.Join(t.TempDir(), "ha-audit.log")
+	require.NoError(t, os.WriteFile(path, []byte("audit_log: "+custom+"\n"), 0600))
+	_, err = captureStdout(t, func() error {
+		return runCLI(t, "state", "set", "input_boolean.guest_mode", "on")
+	})
+	require.NoError(t, err)
+	data, err := os.ReadFile(custom)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"command":"state set"`)
+
+	err = runCLI(t, "audit", "list", "--since", "yesterday")
+	assert.ErrorContains(t, err, `invalid --since "yesterday"`)
+}
+
+func TestAuditLog_CachedServerDown(t *testing.T) {
+	path := setupConfigHome(t)
+	actionServer := func() *httptest.Server {
+		return newMockRESTServer(t, map[string]http.HandlerFunc{
+			"/api/":                       func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte(`{"message":"API running."}`)) },
+			"/api/services":               actionSchemaHandler,
+			"/api/services/light/turn_on": func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("[]")) },
+		})
+	}
+	local, remote := actionServer(), actionServer()
+	defer remote.Close()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	require.NoError(t, os.WriteFile(path, []byte(`contexts:
+  - name: default
+    token: test-token
+    servers: [`+local.URL+`, `+remote.URL+`]
+`), 0600))
+	actionDataJSONRaw = ""
+	t.Cleanup(func() { actionTargets, actionDataFields, actionYes = actionTargetFlags{}, nil, false })
+
+	_, err := captureStdout(t, func() error {
+		return runCLI(t, "action", "call", "light.turn_on", "--entity_id=light.desk")
+	})
+	require.NoError(t, err)
+	actionTargets = actionTargetFlags{}
+	local.Close()
+	_, err = captureStdout(t, func() error {
+		return runCLI(t, "action", "call", "light.turn_on", "--entity_id=light.desk")
+	})
+	require.NoError(t, err)
+
+	out, err := captureStdout(t, func() error {
+		return runCLI(t, "audit", "list", "--since", "1h", "-o", "json")
+	})
+	require.NoError(t, err)
+	var entries []auditEntry
+	require.NoError(t, json.Unmarshal([]byte(out), &entries))
+	require.Len(t, entries, 2, "a run retried on another server is logged once")
+	assert.Equal(t, "ok", entries[1].Result)
+	assert.Equal(t, remote.URL, entries[1].Server)
+}
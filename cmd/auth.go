@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/rnorth/ha-client/internal/output"
+	"github.com/spf13/cobra"
+)
+
+var authCmd = &cobra.Command{Use: "auth", Short: "Inspect the current user and manage access tokens"}
+
+// whoami is the current user as shown by 'auth whoami'. Groups are only known
+// to admins, who may list all users.
+type whoami struct {
+	Name    string   `json:"name" yaml:"name"`
+	ID      string   `json:"id" yaml:"id"`
+	IsOwner bool     `json:"is_owner" yaml:"is_owner"`
+	IsAdmin bool     `json:"is_admin" yaml:"is_admin"`
+	Groups  []string `json:"groups" yaml:"groups"`
+}
+
+var authWhoamiCmd = &cobra.Command{
+	Use:   "whoami",
+	Short: "Show the user the credentials belong to",
+	Long: `Show the name, admin flag and groups of the user the configured credentials
+belong to.
+
+Examples:
+  ha-client auth whoami
+  ha-client --context cabin auth whoami -o json`,
+	Args: cobra.NoArgs,
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		wsc, err := newWSClient(ctx)
+		if err != nil {
+			return err
+		}
+		defer wsc.Close()
+		user, err := wsc.CurrentUser(ctx)
+		if err != nil {
+			return err
+		}
+		out := whoami{Name: user.Name, ID: user.ID, IsOwner: user.IsOwner, IsAdmin: user.IsAdmin, Groups: []string{}}
+		if user.IsAdmin {
+			users, err := wsc.ListUsers(ctx)
+			if err != nil {
+				return err
+			}
+			for _, u := range users {
+				if u.ID == user.ID {
+					out.Groups = append(out.Groups, u.GroupIDs...)
+				}
+			}
+		}
+		return render(ctx, os.Stdout, resolveFormat(), out, nil, renderOpts()...)
+	}),
+}
+
+var authTokenCmd = &cobra.Command{Use: "token", Short: "Manage the current user's refresh and long-lived access tokens"}
+
+var authTokenListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the current user's tokens",
+	Long: `List the current user's refresh tokens: one per login session, plus every
+long-lived access token. The tokens themselves are not shown.
+
+Examples:
+  ha-client auth token list
+  ha-client auth token list -o json`,
+	Args: cobra.NoArgs,
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		wsc, err := newWSClient(ctx)
+		if err != nil {
+			return err
+		}
+		defer wsc.Close()
+		tokens, err := wsc.ListRefreshTokens(ctx)
+		if err != nil {
+			return err
+		}
+		return render(ctx, os.Stdout, resolveFormat(), tokens, []string{"ID", "ClientName", "Type", "CreatedAt", "LastUsedAt", "IsCurrent"},
+			renderOpts(output.WithWideColumns("ClientID", "LastUsedIP"))...)
+	}),
+}
+
+var (
+	authTokenName     string
+	authTokenLifespan int
+)
+
+var authTokenCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a long-lived access token",
+	Long: `Create a long-lived access token for the current user and print it. Home
+Assistant never shows the token again, so store it straight away.
+
+Examples:
+  ha-client auth token create --name ci --lifespan 365
+  ha-client auth token create --name ci | gh secret set HASS_TOKEN`,
+	Args: cobra.NoArgs,
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		if authTokenName == "" {
+			return usageError("--name is required")
+		}
+		if authTokenLifespan <= 0 {
+			return usageError("--lifespan must be a positive number of days")
+		}
+		wsc, err := newWSClient(ctx)
+		if err != nil {
+			return err
+		}
+		defer wsc.Close()
+		token, err := wsc.CreateLongLivedToken(ctx, authTokenName, authTokenLifespan)
+		if err != nil {
+			return err
+		}
+		info("Token %q created, valid for %d days.", authTokenName, authTokenLifespan)
+		fmt.Fprintln(commandOutput(ctx, os.Stdout), token)
+		return nil
+	}),
+}
+
+var authTokenRevokeCmd = &cobra.Command{
+	Use:   "revoke <id>",
+	Short: "Revoke a refresh or long-lived access token",
+	Long: `Revoke a token by the ID shown by 'auth token list'. Revoking a login
+session's refresh token also ends that session.
+
+Examples:
+  ha-client auth token revoke 1b2c3d4e5f`,
+	Args: cobra.ExactArgs(1),
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		wsc, err := newWSClient(ctx)
+		if err != nil {
+			return err
+		}
+		defer wsc.Close()
+		if err := wsc.DeleteRefreshToken(ctx, args[0]); err != nil {
+			return err
+		}
+		info("Token revoked.")
+		return nil
+	}),
+}
+
+func init() {
+	authTokenCreateCmd.Flags().StringVar(&authTokenName, "name", "", "name shown for the token in Home Assistant (required)")
+	authTokenCreateCmd.Flags().IntVar(&authTokenLifespan, "lifespan", 3650, "days until the token expires")
+	authTokenCmd.AddCommand(authTokenListCmd, authTokenCreateCmd, authTokenRevokeCmd)
+	authCmd.AddCommand(authWhoamiCmd, authTokenCmd)
+	rootCmd.AddCommand(authCmd)
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/rnorth/ha-client/internal/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthWhoami(t *testing.T) {
+	user := client.User{ID: "u1", Name: "Alice", IsAdmin: true}
+	users := []client.User{{ID: "u0", GroupIDs: []string{"system-users"}}, {ID: "u1", GroupIDs: []string{"system-admin"}}}
+	srv := newMockWSServer(t, []interface{}{user, users})
+	defer srv.Close()
+
+	t.Setenv("HASS_SERVER", srv.URL)
+	t.Setenv("HASS_TOKEN", "test-token")
+
+	out, err := captureStdout(t, func() error {
+		return runCLI(t, "auth", "whoami", "-o", "json")
+	})
+	require.NoError(t, err)
+	var got whoami
+	require.NoError(t, json.Unmarshal([]byte(out), &got))
+	assert.Equal(t, whoami{Name: "Alice", ID: "u1", IsAdmin: true, Groups: []string{"system-admin"}}, got)
+
+	out, err = captureStdout(t, func() error {
+		return runCLI(t, "auth", "whoami", "-o", "yaml")
+	})
+	require.NoError(t, err)
+	assert.Contains(t, out, "is_admin: true")
+}
+
+func TestAuthTokenCreate(t *testing.T) {
+	srv := newMockWSServer(t, []interface{}{"new-long-lived-token"})
+	defer srv.Close()
+
+	t.Setenv("HASS_SERVER", srv.URL)
+	t.Setenv("HASS_TOKEN", "test-token")
+	t.Cleanup(func() { authTokenName = "" })
+
+	out, err := captureStdout(t, func() error {
+		return runCLI(t, "auth", "token", "create", "--name", "ci", "--lifespan", "365")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "new-long-lived-token\n", out)
+
+	authTokenName = ""
+	err = runCLI(t, "auth", "token", "create")
+	assert.ErrorContains(t, err, "--name is required")
+}
+
+func TestAuthTokenList(t *testing.T) {
+	tokens := []client.RefreshToken{
+		{ID: "t1", ClientName: "ci", Type: "long_lived_access_token", CreatedAt: "2024-01-01T00:00:00+00:00"},
+		{ID: "t2", ClientID: "http://localhost:8123/", Type: "normal", IsCurrent: true},
+	}
+	srv := newMockWSServer(t, []interface{}{tokens})
+	defer srv.Close()
+
+	t.Setenv("HASS_SERVER", srv.URL)
+	t.Setenv("HASS_TOKEN", "test-token")
+
+	out, err := captureStdout(t, func() error {
+		return runCLI(t, "auth", "token", "list", "-o", "table")
+	})
+	require.NoError(t, err)
+	assert.Contains(t, out, "CLIENT_NAME")
+	assert.Contains(t, out, "long_lived_access_token")
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -22,68 +23,85 @@ var automationListCmd = &cobra.Command{
 
 Examples:
   ha-client automation list
-  ha-client automation list -o json`,
-	RunE: func(cmd *cobra.Command, args []string) error {
-		cfg, err := resolveConfig()
+  ha-client automation list -o json
+  ha-client automation list --field-selector state=off
+  ha-client automation list -l area=kitchen
+
+The field selector matches the automation's state, e.g. attributes.mode=queued.`,
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		sel, err := parseSelectors()
 		if err != nil {
 			return err
 		}
-		c := client.NewRESTClient(cfg.Server, cfg.Token)
-		states, err := c.ListStates()
+		c, err := newRESTClient(ctx)
 		if err != nil {
 			return err
 		}
-		type row struct {
-			EntityID     string `json:"entity_id" yaml:"entity_id"`
-			FriendlyName string `json:"friendly_name" yaml:"friendly_name"`
-			State        string `json:"state" yaml:"state"`
+		states, err := c.ListStates(ctx)
+		if err != nil {
+			return err
 		}
-		var rows []row
+		automations := states[:0]
 		for _, s := range states {
-			if !strings.HasPrefix(s.EntityID, "automation.") {
-				continue
+			if strings.HasPrefix(s.EntityID, "automation.") {
+				automations = append(automations, s)
 			}
+		}
+		automations, err = selectItems(ctx, sel, automations, func(s client.State) selectorRef { return selectorRef{entityID: s.EntityID} })
+		if err != nil {
+			return err
+		}
+		type row struct {
+			EntityID      string `json:"entity_id" yaml:"entity_id"`
+			FriendlyName  string `json:"friendly_name" yaml:"friendly_name"`
+			State         string `json:"state" yaml:"state"`
+			LastTriggered string `json:"last_triggered,omitempty" yaml:"last_triggered,omitempty"`
+			Mode          string `json:"mode,omitempty" yaml:"mode,omitempty"`
+		}
+		var rows []row
+		for _, s := range automations {
 			name, _ := s.Attributes["friendly_name"].(string)
-			rows = append(rows, row{EntityID: s.EntityID, FriendlyName: name, State: s.State})
+			lastTriggered, _ := s.Attributes["last_triggered"].(string)
+			mode, _ := s.Attributes["mode"].(string)
+			rows = append(rows, row{EntityID: s.EntityID, FriendlyName: name, State: s.State, LastTriggered: lastTriggered, Mode: mode})
 		}
-		return output.Render(os.Stdout, resolveFormat(), rows, nil, renderOpts()...)
-	},
+		return render(ctx, os.Stdout, resolveFormat(), rows, []string{"EntityID", "FriendlyName", "State"},
+			renderOpts(output.WithWideColumns("LastTriggered", "Mode"))...)
+	}),
 }
 
 var automationGetCmd = &cobra.Command{
 	Use:   "get <entity_id>",
 	Short: "Get automation state",
 	Args:  cobra.ExactArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		cfg, err := resolveConfig()
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		c, err := newRESTClient(ctx)
 		if err != nil {
 			return err
 		}
-		c := client.NewRESTClient(cfg.Server, cfg.Token)
-		state, err := c.GetState(automationID(args[0]))
+		state, err := c.GetState(ctx, automationID(args[0]))
 		if err != nil {
 			return err
 		}
-		return output.Render(os.Stdout, resolveFormat(), state, nil, renderOpts()...)
-	},
+		return render(ctx, os.Stdout, resolveFormat(), state, nil, renderOpts()...)
+	}),
 }
 
 var automationDescribeCmd = &cobra.Command{
 	Use:   "describe <entity_id>",
 	Short: "Show full automation details including attributes",
 	Args:  cobra.ExactArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		cfg, err := resolveConfig()
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		c, err := newRESTClient(ctx)
 		if err != nil {
 			return err
 		}
-		c := client.NewRESTClient(cfg.Server, cfg.Token)
-		state, err := c.GetState(automationID(args[0]))
+		state, err := c.GetState(ctx, automationID(args[0]))
 		if err != nil {
 			return err
 		}
-		return output.Render(os.Stdout, resolveDescribeFormat(), state, nil, renderOpts()...)
-	},
+		return render(ctx, os.Stdout, resolveDescribeFormat(), state, nil, renderOpts()...)
+	}),
 }
 
 var automationExportCmd = &cobra.Command{
@@ -96,21 +114,21 @@ Examples:
   ha-client automation export morning_routine -o json
   ha-client automation export automation.morning_routine > morning.yaml`,
 	Args:  cobra.ExactArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		wsc, err := newWSClient()
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		wsc, err := newWSClient(ctx)
 		if err != nil {
 			return err
 		}
 		defer wsc.Close()
 
 		entityID := automationID(args[0])
-		cfg, err := wsc.GetAutomationConfig(entityID)
+		cfg, err := wsc.GetAutomationConfig(ctx, entityID)
 		if err != nil {
 			return err
 		}
 
-		return output.Render(cmd.OutOrStdout(), resolveDescribeFormat(), cfg, nil, renderOpts()...)
-	},
+		return render(ctx, cmd.OutOrStdout(), resolveDescribeFormat(), cfg, nil, renderOpts()...)
+	}),
 }
 
 // automationID ensures the entity ID has the "automation." prefix.
@@ -122,19 +140,36 @@ func automationID(s string) string {
 }
 
 func automationAction(action string) func(cmd *cobra.Command, args []string) error {
-	return func(cmd *cobra.Command, args []string) error {
-		cfg, err := resolveConfig()
+	return withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		ids, err := expandStdinIDs(args)
 		if err != nil {
 			return err
 		}
-		c := client.NewRESTClient(cfg.Server, cfg.Token)
-		id := automationID(args[0])
-		if _, err := c.CallAction("automation", action, map[string]interface{}{"entity_id": id}, false); err != nil {
+		for i := range ids {
+			ids[i] = automationID(ids[i])
+		}
+		ps, err := policies(ctx)
+		if err != nil {
+			return err
+		}
+		if err := ps.CheckAction("automation." + action); err != nil {
+			return err
+		}
+		if err := ps.CheckEntities(ids...); err != nil {
 			return err
 		}
-		info("automation.%s called for %s", action, id)
+		c, err := newRESTClient(ctx)
+		if err != nil {
+			return err
+		}
+		data := map[string]interface{}{"entity_id": targetValue(ids)}
+		auditPayload(ctx, data)
+		if _, err := c.CallAction(ctx, "automation", action, data, false); err != nil {
+			return err
+		}
+		info("automation.%s called for %s", action, strings.Join(ids, ", "))
 		return nil
-	}
+	})
 }
 
 var automationApplyFile string
@@ -157,7 +192,7 @@ the storage ID is stable and set by you.
 Examples:
   ha-client automation apply -f morning_routine.yaml
   ha-client automation apply -f morning_routine.yaml --dry-run`,
-	RunE: func(cmd *cobra.Command, args []string) error {
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
 		data, err := os.ReadFile(automationApplyFile)
 		if err != nil {
 			return fmt.Errorf("reading file: %w", err)
@@ -177,33 +212,33 @@ Examples:
 			return fmt.Errorf("automation 'id' field must be a non-empty string")
 		}
 
-		haConfig, err := resolveConfig()
+		auditPayload(ctx, cfg)
+		rc, err := newRESTClient(ctx)
 		if err != nil {
 			return err
 		}
-		rc := client.NewRESTClient(haConfig.Server, haConfig.Token)
 
 		if automationApplyDryRun {
-			return runDryRun(cmd, rc, autoID, cfg)
+			return runDryRun(ctx, cmd, rc, autoID, cfg)
 		}
 
-		if err := rc.SaveAutomationConfig(autoID, cfg); err != nil {
+		if err := rc.SaveAutomationConfig(ctx, autoID, cfg); err != nil {
 			return fmt.Errorf("apply failed: %w", err)
 		}
 		info("automation %q applied", autoID)
 		return nil
-	},
+	}),
 }
 
-func runDryRun(cmd *cobra.Command, rc interface {
-	GetAutomationConfig(string) (map[string]interface{}, error)
+func runDryRun(ctx context.Context, cmd *cobra.Command, rc interface {
+	GetAutomationConfig(context.Context, string) (map[string]interface{}, error)
 }, autoID string, newCfg map[string]interface{}) error {
 	newYAML, err := yaml.Marshal(newCfg)
 	if err != nil {
 		return err
 	}
 
-	current, err := rc.GetAutomationConfig(autoID)
+	current, err := rc.GetAutomationConfig(ctx, autoID)
 	var oldYAML []byte
 	if err != nil {
 		if errors.Is(err, client.ErrNotFound) {
@@ -231,10 +266,10 @@ func runDryRun(cmd *cobra.Command, rc interface {
 		return err
 	}
 	if text == "" {
-		fmt.Fprintln(cmd.OutOrStdout(), "(no changes)")
+		fmt.Fprintln(commandOutput(ctx, cmd.OutOrStdout()), "(no changes)")
 		return nil
 	}
-	fmt.Fprint(cmd.OutOrStdout(), text)
+	fmt.Fprint(commandOutput(ctx, cmd.OutOrStdout()), text)
 	return nil
 }
 
@@ -245,10 +280,11 @@ func init() {
 		automationDescribeCmd,
 		automationExportCmd,
 		automationApplyCmd,
-		&cobra.Command{Use: "trigger <entity_id>", Short: "Trigger an automation", Args: cobra.ExactArgs(1), RunE: automationAction("trigger")},
-		&cobra.Command{Use: "enable <entity_id>", Short: "Enable an automation", Args: cobra.ExactArgs(1), RunE: automationAction("turn_on")},
-		&cobra.Command{Use: "disable <entity_id>", Short: "Disable an automation", Args: cobra.ExactArgs(1), RunE: automationAction("turn_off")},
+		&cobra.Command{Use: "trigger <entity_id|->", Short: "Trigger an automation", Args: cobra.ExactArgs(1), RunE: automationAction("trigger")},
+		&cobra.Command{Use: "enable <entity_id|->", Short: "Enable an automation", Args: cobra.ExactArgs(1), RunE: automationAction("turn_on")},
+		&cobra.Command{Use: "disable <entity_id|->", Short: "Disable an automation", Args: cobra.ExactArgs(1), RunE: automationAction("turn_off")},
 	)
+	addSelectorFlags(automationListCmd)
 	automationApplyCmd.Flags().StringVarP(&automationApplyFile, "filename", "f", "", "path to automation YAML file (required)")
 	_ = automationApplyCmd.MarkFlagRequired("filename")
 	automationApplyCmd.Flags().BoolVar(&automationApplyDryRun, "dry-run", false, "print diff without applying")
@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rnorth/ha-client/internal/config"
+	"github.com/rnorth/ha-client/internal/output"
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage contexts (named Home Assistant instances)",
+	Long: `Manage contexts: named Home Assistant instances stored in config.yaml, each
+with its own credentials in the OS keychain. Select one per command with
+--context or HASS_CONTEXT, or set a default with 'config use-context'.`,
+}
+
+var configGetContextsCmd = &cobra.Command{
+	Use:   "get-contexts",
+	Short: "List configured contexts",
+	Long: `List configured contexts. CURRENT marks the context commands use by default.
+
+Examples:
+  ha-client config get-contexts
+  ha-client config get-contexts -o json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, err := config.LoadFile(config.DefaultConfigPath())
+		if err != nil {
+			return err
+		}
+		current := config.SelectContext(contextFlag, file)
+		type row struct {
+			Current bool   `json:"current" yaml:"current"`
+			Name    string `json:"name" yaml:"name"`
+			Server  string `json:"server" yaml:"server"`
+		}
+		rows := []row{}
+		for _, c := range config.Contexts(file) {
+			rows = append(rows, row{Current: c.Name == current, Name: c.Name, Server: c.Server})
+		}
+		return output.Render(os.Stdout, resolveFormat(), rows, nil, renderOpts()...)
+	},
+}
+
+var configUseContextCmd = &cobra.Command{
+	Use:   "use-context <name>",
+	Short: "Set the default context",
+	Long: `Set the context used when neither --context nor HASS_CONTEXT is given.
+
+Examples:
+  ha-client config use-context cabin`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfigFile(func(file *config.File) error {
+			if file.Context(args[0]) == nil && args[0] != config.DefaultContext {
+				return fmt.Errorf("context %q: %w", args[0], config.ErrContextNotFound)
+			}
+			file.CurrentContext = args[0]
+			info("Switched to context %q.", args[0])
+			return nil
+		})
+	},
+}
+
+var configSetContextCmd = &cobra.Command{
+	Use:   "set-context <name>",
+	Short: "Create or update a context",
+	Long: `Create a context, or update the server and/or token of an existing one.
+The server is taken from --server and the token from --token; fields that are
+not given are left unchanged. The token is stored in the OS keychain when one
+is available. To be prompted for credentials instead, use 'login --context'.
+
+Examples:
+  ha-client config set-context cabin --server http://cabin.local:8123
+  ha-client config set-context cabin --token "$CABIN_TOKEN"`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		file, err := config.LoadFile(config.DefaultConfigPath())
+		if err != nil {
+			return err
+		}
+		c := config.Context{Name: name}
+		if existing := file.Context(name); existing != nil {
+			c = *existing
+		}
+		if serverFlag != "" {
+			c.Server = serverFlag
+		}
+		if tokenFlag != "" {
+			if c.Server == "" {
+				return fmt.Errorf("context %q has no server: pass --server as well", name)
+			}
+			// SaveToKeychain records the context in the file as well.
+			if err := config.SaveToKeychain(name, c.Server, tokenFlag); err != nil {
+				return err
+			}
+			info("Context %q saved.", name)
+			return nil
+		}
+		file.SetContext(c)
+		if err := file.Save(config.DefaultConfigPath()); err != nil {
+			return err
+		}
+		if serverFlag != "" {
+			// A server saved by login would otherwise outrank the file.
+			if err := config.UpdateKeychainServer(name, serverFlag); err != nil {
+				return err
+			}
+		}
+		info("Context %q saved.", name)
+		return nil
+	},
+}
+
+var configRenameContextCmd = &cobra.Command{
+	Use:   "rename-context <old-name> <new-name>",
+	Short: "Rename a context",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := updateConfigFile(func(file *config.File) error {
+			return file.RenameContext(args[0], args[1])
+		}); err != nil {
+			return err
+		}
+		if err := config.RenameKeychainEntries(args[0], args[1]); err != nil {
+			info("warning: could not move keychain entries: %v", err)
+		}
+		info("Context %q renamed to %q.", args[0], args[1])
+		return nil
+	},
+}
+
+var configDeleteContextCmd = &cobra.Command{
+	Use:   "delete-context <name>",
+	Short: "Delete a context and its stored credentials",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := updateConfigFile(func(file *config.File) error {
+			return file.DeleteContext(args[0])
+		}); err != nil {
+			return err
+		}
+		if err := config.DeleteKeychainEntries(args[0]); err != nil {
+			info("warning: could not remove keychain entries: %v", err)
+		}
+		info("Context %q deleted.", args[0])
+		return nil
+	},
+}
+
+// updateConfigFile loads config.yaml, applies fn and saves the result.
+func updateConfigFile(fn func(*config.File) error) error {
+	path := config.DefaultConfigPath()
+	file, err := config.LoadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := fn(file); err != nil {
+		return err
+	}
+	return file.Save(path)
+}
+
+// selectedContext returns the context chosen by --context, HASS_CONTEXT or
+// current-context, for commands that manage credentials rather than use them.
+func selectedContext() (string, error) {
+	file, err := config.LoadFile(config.DefaultConfigPath())
+	if err != nil {
+		return "", err
+	}
+	return config.SelectContext(contextFlag, file), nil
+}
+
+func init() {
+	configCmd.AddCommand(
+		configGetContextsCmd,
+		configUseContextCmd,
+		configSetContextCmd,
+		configRenameContextCmd,
+		configDeleteContextCmd,
+	)
+	rootCmd.AddCommand(configCmd)
+}
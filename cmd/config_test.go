@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/rnorth/ha-client/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+)
+
+// setupConfigHome points the config file at a temp dir and the keychain at an
+// in-memory mock, and resets the connection flags after the test.
+func setupConfigHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, ".cache"))
+	t.Setenv("HASS_SERVER", "")
+	t.Setenv("HASS_TOKEN", "")
+	t.Setenv("HASS_CONTEXT", "")
+	t.Setenv("SUPERVISOR_TOKEN", "")
+	keyring.MockInit()
+	t.Cleanup(func() {
+		contextFlag = ""
+		serverFlag = ""
+		tokenFlag = ""
+	})
+	return filepath.Join(home, ".config", "ha-client", "config.yaml")
+}
+
+func runCLI(t *testing.T, args ...string) error {
+	t.Helper()
+	rootCmd.SilenceErrors = true
+	rootCmd.SilenceUsage = true
+	rootCmd.SetArgs(args)
+	err := rootCmd.Execute()
+	// Persistent flags keep their values between Execute calls.
+	contextFlag, serverFlag, tokenFlag, supervisor = "", "", "", false
+	allContexts, contextsFlag = false, nil
+	transport, headerFlags, verbose, traceFile = config.Transport{}, nil, 0, ""
+	retries, retryActions, policyFile, outputFormat = 0, false, "", ""
+	rootCmd.PersistentFlags().Lookup("retries").Changed = false
+	closeTrace()
+	return err
+}
+
+func TestConfigContexts(t *testing.T) {
+	path := setupConfigHome(t)
+
+	require.NoError(t, runCLI(t, "config", "set-context", "home", "--server", "http://home:8123", "--token", "home-token"))
+	require.NoError(t, runCLI(t, "config", "set-context", "office", "--server", "http://office:8123", "--token", "office-token"))
+	require.NoError(t, runCLI(t, "config", "use-context", "office"))
+
+	file, err := config.LoadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "office", file.CurrentContext)
+	require.Len(t, file.Contexts, 2)
+	assert.Empty(t, file.Context("home").Token, "token should be in the keychain, not the file")
+
+	cfg, err := config.Resolve(context.Background(), config.Overrides{})
+	require.NoError(t, err)
+	assert.Equal(t, "http://office:8123", cfg.Server)
+	assert.Equal(t, "office-token", cfg.Token)
+
+	cfg, err = config.Resolve(context.Background(), config.Overrides{Context: "home"})
+	require.NoError(t, err)
+	assert.Equal(t, "home-token", cfg.Token)
+
+	require.NoError(t, runCLI(t, "config", "rename-context", "office", "work"))
+	cfg, err = config.Resolve(context.Background(), config.Overrides{})
+	require.NoError(t, err)
+	assert.Equal(t, "work", cfg.Context)
+	assert.Equal(t, "office-token", cfg.Token)
+
+	require.NoError(t, runCLI(t, "config", "delete-context", "home"))
+	_, err = config.Resolve(context.Background(), config.Overrides{Context: "home"})
+	assert.ErrorIs(t, err, config.ErrContextNotFound)
+}
+
+func TestConfigGetContexts_KeychainDefault(t *testing.T) {
+	setupConfigHome(t)
+	// A login saved before contexts existed is only in the keychain.
+	require.NoError(t, keyring.Set("ha-client", "server", "http://legacy:8123"))
+	require.NoError(t, keyring.Set("ha-client", "token", "legacy-token"))
+	require.NoError(t, runCLI(t, "config", "set-context", "cabin", "--server", "http://cabin:8123"))
+
+	out, err := captureStdout(t, func() error { return runCLI(t, "config", "get-contexts", "-o", "json") })
+	require.NoError(t, err)
+	var rows []map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(out), &rows))
+	require.Len(t, rows, 2)
+	assert.Equal(t, map[string]interface{}{"current": true, "name": "default", "server": "http://legacy:8123"}, rows[0])
+	assert.Equal(t, "cabin", rows[1]["name"])
+}
+
+func TestConfigSetContext_KeepsExistingServer(t *testing.T) {
+	setupConfigHome(t)
+
+	require.NoError(t, runCLI(t, "config", "set-context", "lab", "--server", "http://lab:8123"))
+	require.NoError(t, runCLI(t, "config", "set-context", "lab", "--token", "lab-token"))
+
+	cfg, err := config.Resolve(context.Background(), config.Overrides{Context: "lab"})
+	require.NoError(t, err)
+	assert.Equal(t, "http://lab:8123", cfg.Server)
+	assert.Equal(t, "lab-token", cfg.Token)
+}
+
+func TestConfigSetContext_ChangesKeychainServer(t *testing.T) {
+	setupConfigHome(t)
+
+	require.NoError(t, runCLI(t, "config", "set-context", "lab", "--server", "http://old:8123", "--token", "lab-token"))
+	require.NoError(t, runCLI(t, "config", "set-context", "lab", "--server", "http://new:8123"))
+
+	cfg, err := config.Resolve(context.Background(), config.Overrides{Context: "lab"})
+	require.NoError(t, err)
+	assert.Equal(t, "http://new:8123", cfg.Server)
+	assert.Equal(t, "lab-token", cfg.Token)
+}
+
+func TestConfigUseContext_Unknown(t *testing.T) {
+	setupConfigHome(t)
+	err := runCLI(t, "config", "use-context", "nope")
+	assert.ErrorIs(t, err, config.ErrContextNotFound)
+}
+
+func TestContextFlagSelectsContext(t *testing.T) {
+	setupConfigHome(t)
+	var gotAuth string
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/states": func(w http.ResponseWriter, r *http.Request) {
+			gotAuth = r.Header.Get("Authorization")
+			_, _ = w.Write([]byte("[]"))
+		},
+	})
+	defer srv.Close()
+
+	require.NoError(t, runCLI(t, "config", "set-context", "lab", "--server", srv.URL, "--token", "lab-token"))
+	require.NoError(t, runCLI(t, "config", "set-context", "home", "--server", "http://unused.invalid", "--token", "home-token"))
+	require.NoError(t, runCLI(t, "config", "use-context", "home"))
+
+	require.NoError(t, runCLI(t, "state", "list", "--context", "lab", "-o", "json"))
+	assert.Equal(t, "Bearer lab-token", gotAuth)
+
+	gotAuth = ""
+	t.Setenv("HASS_CONTEXT", "lab")
+	require.NoError(t, runCLI(t, "state", "list", "-o", "json"))
+	assert.Equal(t, "Bearer lab-token", gotAuth)
+}
@@ -1,9 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 
+	"github.com/rnorth/ha-client/internal/client"
 	"github.com/rnorth/ha-client/internal/output"
 	"github.com/spf13/cobra"
 )
@@ -17,14 +19,20 @@ var deviceListCmd = &cobra.Command{
 
 Examples:
   ha-client device list
-  ha-client device list -o json`,
-	RunE: func(cmd *cobra.Command, args []string) error {
-		wsc, err := newWSClient()
+  ha-client device list -o json
+  ha-client device list -l floor=upstairs
+  ha-client device list --field-selector 'manufacturer=~^(IKEA|Philips)'`,
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		sel, err := parseSelectors()
+		if err != nil {
+			return err
+		}
+		wsc, err := newWSClient(ctx)
 		if err != nil {
 			return err
 		}
 		defer wsc.Close()
-		devices, err := wsc.ListDevices()
+		devices, err := wsc.ListDevices(ctx)
 		if err != nil {
 			return err
 		}
@@ -37,8 +45,13 @@ Examples:
 			}
 			devices = filtered
 		}
-		return output.Render(os.Stdout, resolveFormat(), devices, []string{"ID", "Name", "Manufacturer", "Model", "AreaID"}, renderOpts()...)
-	},
+		devices, err = selectItems(ctx, sel, devices, func(d client.Device) selectorRef { return selectorRef{deviceID: d.ID} })
+		if err != nil {
+			return err
+		}
+		return render(ctx, os.Stdout, resolveFormat(), devices, []string{"ID", "Name", "Manufacturer", "Model", "AreaID"},
+			renderOpts(output.WithWideColumns("LABELS:.labels", "CONFIG_ENTRIES:.config_entries"))...)
+	}),
 }
 
 var deviceGetCmd = &cobra.Command{
@@ -49,52 +62,53 @@ var deviceGetCmd = &cobra.Command{
 Examples:
   ha-client device get "Smart Bulb"`,
 	Args:  cobra.ExactArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		wsc, err := newWSClient()
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		wsc, err := newWSClient(ctx)
 		if err != nil {
 			return err
 		}
 		defer wsc.Close()
-		devices, err := wsc.ListDevices()
+		devices, err := wsc.ListDevices(ctx)
 		if err != nil {
 			return err
 		}
 		for _, d := range devices {
 			if d.ID == args[0] || d.Name == args[0] {
-				return output.Render(os.Stdout, resolveFormat(), d, nil, renderOpts()...)
+				return render(ctx, os.Stdout, resolveFormat(), d, nil, renderOpts()...)
 			}
 		}
-		return fmt.Errorf("device %q not found", args[0])
-	},
+		return fmt.Errorf("device %q: %w", args[0], client.ErrNotFound)
+	}),
 }
 
 var deviceDescribeCmd = &cobra.Command{
 	Use:   "describe <device_id>",
 	Short: "Show full device details",
 	Args:  cobra.ExactArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		wsc, err := newWSClient()
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		wsc, err := newWSClient(ctx)
 		if err != nil {
 			return err
 		}
 		defer wsc.Close()
-		devices, err := wsc.ListDevices()
+		devices, err := wsc.ListDevices(ctx)
 		if err != nil {
 			return err
 		}
 		for _, d := range devices {
 			if d.ID == args[0] || d.Name == args[0] {
-				return output.Render(os.Stdout, resolveDescribeFormat(), d, nil, renderOpts()...)
+				return render(ctx, os.Stdout, resolveDescribeFormat(), d, nil, renderOpts()...)
 			}
 		}
-		return fmt.Errorf("device %q not found", args[0])
-	},
+		return fmt.Errorf("device %q: %w", args[0], client.ErrNotFound)
+	}),
 }
 
 var deviceListArea string
 
 func init() {
 	deviceListCmd.Flags().StringVar(&deviceListArea, "area", "", "filter by area ID")
+	addSelectorFlags(deviceListCmd)
 	deviceCmd.AddCommand(deviceListCmd, deviceGetCmd, deviceDescribeCmd)
 	rootCmd.AddCommand(deviceCmd)
 }
@@ -1,9 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"os"
 	"strings"
 
+	"github.com/rnorth/ha-client/internal/client"
 	"github.com/rnorth/ha-client/internal/output"
 	"github.com/spf13/cobra"
 )
@@ -17,14 +19,20 @@ var entityListCmd = &cobra.Command{
 
 Examples:
   ha-client entity list
+  ha-client entity list -l label=critical
+  ha-client entity list --field-selector 'platform=hue,disabled_by!=*'
   ha-client entity list -o json | jq '.[] | select(.platform == "hue")'`,
-	RunE: func(cmd *cobra.Command, args []string) error {
-		wsc, err := newWSClient()
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		sel, err := parseSelectors()
+		if err != nil {
+			return err
+		}
+		wsc, err := newWSClient(ctx)
 		if err != nil {
 			return err
 		}
 		defer wsc.Close()
-		entities, err := wsc.ListEntities()
+		entities, err := wsc.ListEntities(ctx)
 		if err != nil {
 			return err
 		}
@@ -38,8 +46,13 @@ Examples:
 			}
 			entities = filtered
 		}
-		return output.Render(os.Stdout, resolveFormat(), entities, []string{"EntityID", "Name", "Platform", "AreaID"}, renderOpts()...)
-	},
+		entities, err = selectItems(ctx, sel, entities, func(e client.EntityEntry) selectorRef { return selectorRef{entityID: e.EntityID} })
+		if err != nil {
+			return err
+		}
+		return render(ctx, os.Stdout, resolveFormat(), entities, []string{"EntityID", "Name", "Platform", "AreaID"},
+			renderOpts(output.WithWideColumns("DeviceID", "EntityCategory", "DisabledBy", "HiddenBy", "LABELS:.labels"))...)
+	}),
 }
 
 var entityGetCmd = &cobra.Command{
@@ -51,42 +64,43 @@ Examples:
   ha-client entity get light.desk
   ha-client entity get light.desk -o json`,
 	Args:  cobra.ExactArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		wsc, err := newWSClient()
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		wsc, err := newWSClient(ctx)
 		if err != nil {
 			return err
 		}
 		defer wsc.Close()
-		entity, err := wsc.GetEntity(args[0])
+		entity, err := wsc.GetEntity(ctx, args[0])
 		if err != nil {
 			return err
 		}
-		return output.Render(os.Stdout, resolveFormat(), entity, nil, renderOpts()...)
-	},
+		return render(ctx, os.Stdout, resolveFormat(), entity, nil, renderOpts()...)
+	}),
 }
 
 var entityDescribeCmd = &cobra.Command{
 	Use:   "describe <entity_id>",
 	Short: "Show full entity registry details",
 	Args:  cobra.ExactArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		wsc, err := newWSClient()
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		wsc, err := newWSClient(ctx)
 		if err != nil {
 			return err
 		}
 		defer wsc.Close()
-		entity, err := wsc.GetEntity(args[0])
+		entity, err := wsc.GetEntity(ctx, args[0])
 		if err != nil {
 			return err
 		}
-		return output.Render(os.Stdout, resolveDescribeFormat(), entity, nil, renderOpts()...)
-	},
+		return render(ctx, os.Stdout, resolveDescribeFormat(), entity, nil, renderOpts()...)
+	}),
 }
 
 var entityListDomain string
 
 func init() {
 	entityListCmd.Flags().StringVar(&entityListDomain, "domain", "", "filter by entity domain (e.g. light, sensor)")
+	addSelectorFlags(entityListCmd)
 	entityCmd.AddCommand(entityListCmd, entityGetCmd, entityDescribeCmd)
 	rootCmd.AddCommand(entityCmd)
 }
@@ -1,11 +1,10 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
 
 	"github.com/rnorth/ha-client/internal/client"
 	"github.com/spf13/cobra"
@@ -16,73 +15,67 @@ var eventCmd = &cobra.Command{
 	Short: "Subscribe to Home Assistant events",
 }
 
-var eventTypeFilter string
+var (
+	eventTypeFilter  string
+	eventNoReconnect bool
+)
 
 var eventWatchCmd = &cobra.Command{
 	Use:   "watch",
 	Short: "Stream events in real-time (Ctrl+C to stop)",
 	Long: `Stream Home Assistant events in real-time. Press Ctrl+C to stop.
 
+If the connection drops (e.g. Home Assistant restarts), the stream reconnects
+with exponential backoff and writes {"type":"reconnected"} to mark a possible
+gap in events. It exits with an error if the token is rejected on reconnect.
+Use --no-reconnect to exit with an error instead.
+
 Examples:
   ha-client event watch
   ha-client event watch --type state_changed
   ha-client event watch --type automation_triggered`,
-	RunE: func(cmd *cobra.Command, args []string) error {
-		cfg, err := resolveConfig()
-		if err != nil {
-			return err
-		}
+	RunE: withStream(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		// --timeout bounds connecting and subscribing, not the stream itself,
+		// which runs until Ctrl+C (the command context is cancelled by Execute).
+		setupCtx, cancel := withTimeout(ctx)
+		defer cancel()
 
-		wsc, err := client.NewWSClient(cfg.Server, cfg.Token)
+		wsc, err := newWSClient(setupCtx, client.WithReconnect(!eventNoReconnect))
 		if err != nil {
 			return fmt.Errorf("failed to connect: %w", err)
 		}
 		defer wsc.Close()
 
-		stop := make(chan os.Signal, 1)
-		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
-		// Buffered so the goroutine below can send without blocking if we already
-		// returned via the signal branch.
-		done := make(chan error, 1)
+		sub, err := wsc.Subscribe(setupCtx, eventTypeFilter)
+		if err != nil {
+			return err
+		}
 
-		// Run SubscribeEvents in a goroutine because it blocks indefinitely.
-		// The main goroutine then selects between a user interrupt and a connection
-		// error, allowing a clean shutdown on Ctrl+C.
-		go func() {
-			done <- wsc.SubscribeEvents(eventTypeFilter, func(event json.RawMessage) bool {
-				// Check for stop signal before printing each event so we don't
-				// emit a partial event after the user has asked us to quit.
-				select {
-				case <-stop:
-					return false
-				default:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		for {
+			select {
+			case event, ok := <-sub.Events():
+				if !ok {
+					return sub.Err()
 				}
 				var pretty map[string]interface{}
 				// Best-effort pretty-print; if the event isn't valid JSON we skip it
 				// silently rather than crashing — HA occasionally sends non-JSON events.
 				if json.Unmarshal(event, &pretty) == nil {
-					enc := json.NewEncoder(os.Stdout)
-					enc.SetIndent("", "  ")
 					_ = enc.Encode(pretty)
 				}
-				return true
-			})
-		}()
-
-		select {
-		case <-stop:
-			info("\nStopped.")
-		case err := <-done:
-			if err != nil {
-				return err
+			case <-ctx.Done():
+				info("\nStopped.")
+				return nil
 			}
 		}
-		return nil
-	},
+	}),
 }
 
 func init() {
 	eventWatchCmd.Flags().StringVar(&eventTypeFilter, "type", "", "filter to a specific event type (e.g. state_changed)")
+	eventWatchCmd.Flags().BoolVar(&eventNoReconnect, "no-reconnect", false, "exit on connection loss instead of reconnecting")
 	eventCmd.AddCommand(eventWatchCmd)
 	rootCmd.AddCommand(eventCmd)
 }
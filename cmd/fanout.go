@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/rnorth/ha-client/internal/config"
+	clierrors "github.com/rnorth/ha-client/internal/errors"
+	"github.com/rnorth/ha-client/internal/output"
+	"github.com/spf13/cobra"
+)
+
+var (
+	allContexts  bool
+	contextsFlag []string
+)
+
+type fanOutKey struct{}
+
+// fanOutRun collects what one context produced while a command is fanned out
+// across several contexts, so the results can be merged once all are done.
+type fanOutRun struct {
+	context string
+	format  output.Format
+	columns []string
+	opts    []output.RenderOption
+	results []interface{}
+	out     bytes.Buffer
+	err     error
+}
+
+func fanOutFrom(ctx context.Context) *fanOutRun {
+	run, _ := ctx.Value(fanOutKey{}).(*fanOutRun)
+	return run
+}
+
+// fanOutRequested reports whether --all-contexts or --contexts was given.
+func fanOutRequested() bool {
+	return allContexts || len(contextsFlag) > 0
+}
+
+// fanOutContexts returns the contexts selected by --all-contexts/--contexts.
+func fanOutContexts() ([]string, error) {
+	switch {
+	case allContexts && len(contextsFlag) > 0:
+		return nil, usageError("--all-contexts and --contexts cannot be used together")
+	case contextFlag != "":
+		return nil, usageError("--context cannot be combined with --all-contexts or --contexts")
+	case serverFlag != "" || tokenFlag != "" || supervisor:
+		return nil, usageError("--server, --token and --supervisor cannot be combined with --all-contexts or --contexts")
+	}
+	file, err := config.LoadFile(config.DefaultConfigPath())
+	if err != nil {
+		return nil, err
+	}
+	if allContexts {
+		var names []string
+		for _, c := range config.Contexts(file) {
+			names = append(names, c.Name)
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("no contexts configured (see 'ha-client config set-context')")
+		}
+		return names, nil
+	}
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range contextsFlag {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		if file.Context(name) == nil && name != config.DefaultContext {
+			return nil, fmt.Errorf("context %q: %w (see 'ha-client config get-contexts')", name, config.ErrContextNotFound)
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// runFanOut runs the command once per context, concurrently, then writes the
+// merged results. A failing context is reported on stderr without stopping the
+// others; the returned error (if any) only summarises the failures.
+func runFanOut(ctx context.Context, cmd *cobra.Command, args []string, run runFunc, names []string) error {
+	runs := make([]*fanOutRun, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		runs[i] = &fanOutRun{context: name}
+		wg.Add(1)
+		go func(r *fanOutRun) {
+			defer wg.Done()
+			r.err = run(context.WithValue(ctx, fanOutKey{}, r), cmd, args)
+		}(runs[i])
+	}
+	wg.Wait()
+
+	var (
+		results []output.ContextResult
+		format  = resolveFormat()
+		columns []string
+		opts    = renderOpts()
+		failed  []*fanOutRun
+		// rendered is whether any context produced results, even empty ones.
+		rendered bool
+	)
+	for _, r := range runs {
+		if r.err != nil {
+			failed = append(failed, r)
+			continue
+		}
+		if r.results != nil {
+			format, columns, opts, rendered = r.format, r.columns, r.opts, true
+		}
+		for _, data := range r.results {
+			results = append(results, output.ContextResult{Context: r.context, Data: data})
+		}
+	}
+	// Empty results are still rendered, as "(none)" or "[]", so that a listing
+	// that matched nothing anywhere is not mistaken for one that failed.
+	// Commands that only report on stderr (e.g. "area delete") render nothing.
+	if rendered {
+		if err := output.RenderContexts(os.Stdout, format, results, columns, opts...); err != nil {
+			return err
+		}
+	}
+	// Output the command wrote directly (diffs, template results) is kept
+	// per context, under a header, rather than interleaved.
+	for _, r := range runs {
+		if r.out.Len() > 0 {
+			fmt.Fprintf(os.Stdout, "==> %s <==\n", r.context)
+			_, _ = r.out.WriteTo(os.Stdout)
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+	summary := &clierrors.CLIError{
+		Err: fmt.Errorf("%d of %d contexts failed", len(failed), len(runs)),
+	}
+	for i, r := range failed {
+		ce := clierrors.Classify(r.err)
+		printError(ce, r.context)
+		// Keep a specific exit code when every context failed the same way.
+		if i == 0 || (ce.ExitCode == summary.ExitCode && ce.Code == summary.Code) {
+			summary.ExitCode, summary.Code = ce.ExitCode, ce.Code
+		} else {
+			summary.ExitCode, summary.Code = clierrors.ExitGeneral, "error"
+		}
+	}
+	return summary
+}
+
+// render writes data like output.Render. When the command is fanned out across
+// contexts, the data is collected instead, to be merged with the other results.
+func render(ctx context.Context, w io.Writer, format output.Format, data interface{}, columns []string, opts ...output.RenderOption) error {
+	if run := fanOutFrom(ctx); run != nil {
+		run.format, run.columns, run.opts = format, columns, opts
+		run.results = append(run.results, data)
+		return nil
+	}
+	return output.Render(w, format, data, columns, opts...)
+}
+
+// commandOutput returns the writer for output a command prints itself rather
+// than through render. When fanned out, that output is buffered per context.
+func commandOutput(ctx context.Context, w io.Writer) io.Writer {
+	if run := fanOutFrom(ctx); run != nil {
+		return &run.out
+	}
+	return w
+}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&allContexts, "all-contexts", false, "run the command against every configured context")
+	rootCmd.PersistentFlags().StringSliceVar(&contextsFlag, "contexts", nil, "run the command against these contexts (comma-separated)")
+}
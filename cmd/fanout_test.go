@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/rnorth/ha-client/internal/client"
+	clierrors "github.com/rnorth/ha-client/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+)
+
+func statesServer(states ...client.State) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(states)
+	}
+}
+
+// captureStdout runs fn with os.Stdout redirected and returns what it wrote.
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	r, w, _ := os.Pipe()
+	origStdout := os.Stdout
+	os.Stdout = w
+	err := fn()
+	os.Stdout = origStdout
+	require.NoError(t, w.Close())
+	out, _ := io.ReadAll(r)
+	return string(out), err
+}
+
+func resetFanOutFlags(t *testing.T) {
+	t.Cleanup(func() { stateListDomain = "" })
+}
+
+func TestFanOut_MergesResults(t *testing.T) {
+	setupConfigHome(t)
+	resetFanOutFlags(t)
+	home := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/states": statesServer(client.State{EntityID: "sensor.temp", State: "21"}, client.State{EntityID: "light.desk", State: "on"}),
+	})
+	defer home.Close()
+	cabin := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/states": statesServer(client.State{EntityID: "sensor.temp", State: "4"}),
+	})
+	defer cabin.Close()
+	require.NoError(t, runCLI(t, "config", "set-context", "home", "--server", home.URL, "--token", "t1"))
+	require.NoError(t, runCLI(t, "config", "set-context", "cabin", "--server", cabin.URL, "--token", "t2"))
+
+	out, err := captureStdout(t, func() error {
+		return runCLI(t, "state", "list", "--all-contexts", "--domain", "sensor", "-o", "json")
+	})
+	require.NoError(t, err)
+
+	var got []map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(out), &got))
+	require.Len(t, got, 2)
+	assert.Equal(t, "home", got[0]["context"])
+	assert.Equal(t, "21", got[0]["state"])
+	assert.Equal(t, "cabin", got[1]["context"])
+	assert.Equal(t, "4", got[1]["state"])
+}
+
+func TestFanOut_EmptyResults(t *testing.T) {
+	setupConfigHome(t)
+	resetFanOutFlags(t)
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/states": statesServer(client.State{EntityID: "light.desk", State: "on"}),
+	})
+	defer srv.Close()
+	require.NoError(t, runCLI(t, "config", "set-context", "home", "--server", srv.URL, "--token", "t1"))
+	require.NoError(t, runCLI(t, "config", "set-context", "cabin", "--server", srv.URL, "--token", "t2"))
+
+	for format, want := range map[string]string{"json": "[]\n", "table": "(none)\n"} {
+		out, err := captureStdout(t, func() error {
+			return runCLI(t, "state", "list", "--all-contexts", "--domain", "sensor", "-o", format)
+		})
+		require.NoError(t, err)
+		assert.Equal(t, want, out, format)
+	}
+}
+
+func TestFanOut_AllContextsIncludesKeychainDefault(t *testing.T) {
+	setupConfigHome(t)
+	resetFanOutFlags(t)
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/states": statesServer(client.State{EntityID: "light.desk", State: "on"}),
+	})
+	defer srv.Close()
+	// A login saved before contexts existed is only in the keychain.
+	require.NoError(t, keyring.Set("ha-client", "server", srv.URL))
+	require.NoError(t, keyring.Set("ha-client", "token", "legacy-token"))
+
+	out, err := captureStdout(t, func() error {
+		return runCLI(t, "state", "list", "--all-contexts", "-o", "json")
+	})
+	require.NoError(t, err)
+
+	var got []map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(out), &got))
+	require.Len(t, got, 1)
+	assert.Equal(t, "default", got[0]["context"])
+}
+
+func TestFanOut_PartialFailure(t *testing.T) {
+	setupConfigHome(t)
+	resetFanOutFlags(t)
+	ok := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/states": statesServer(client.State{EntityID: "light.desk", State: "on"}),
+	})
+	defer ok.Close()
+	broken := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/states": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		},
+	})
+	defer broken.Close()
+	require.NoError(t, runCLI(t, "config", "set-context", "home", "--server", ok.URL, "--token", "t1"))
+	require.NoError(t, runCLI(t, "config", "set-context", "cabin", "--server", broken.URL, "--token", "bad"))
+
+	out, err := captureStdout(t, func() error {
+		return runCLI(t, "state", "list", "--contexts", "home,cabin", "-o", "table")
+	})
+	require.Error(t, err)
+	assert.Contains(t, out, "home")
+	assert.Contains(t, out, "light.desk")
+	assert.NotContains(t, out, "cabin")
+
+	ce := clierrors.Classify(err)
+	assert.Equal(t, "1 of 2 contexts failed", ce.Error())
+	assert.Equal(t, clierrors.ExitAuth, ce.ExitCode)
+}
+
+func TestFanOut_RejectsContextFlag(t *testing.T) {
+	setupConfigHome(t)
+	resetFanOutFlags(t)
+	require.NoError(t, runCLI(t, "config", "set-context", "home", "--server", "http://home.invalid", "--token", "t1"))
+
+	err := runCLI(t, "state", "list", "--all-contexts", "--context", "home")
+	require.Error(t, err)
+	assert.Equal(t, clierrors.ExitUsage, clierrors.Classify(err).ExitCode)
+}
@@ -1,28 +1,38 @@
 package cmd
 
 import (
+	"context"
 	"os"
 
 	"github.com/rnorth/ha-client/internal/client"
-	"github.com/rnorth/ha-client/internal/output"
 	"github.com/spf13/cobra"
 )
 
+// serverInfo is client.HAInfo plus the URL it was fetched from, which matters
+// when a context lists several servers.
+type serverInfo struct {
+	Server        string `json:"server"`
+	client.HAInfo `yaml:",inline"`
+}
+
 var infoCmd = &cobra.Command{
 	Use:   "info",
 	Short: "Show Home Assistant server information",
-	RunE: func(cmd *cobra.Command, args []string) error {
-		cfg, err := resolveConfig()
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		cfg, err := resolveConfig(ctx)
+		if err != nil {
+			return err
+		}
+		c, err := restClient(cfg)
 		if err != nil {
 			return err
 		}
-		c := client.NewRESTClient(cfg.Server, cfg.Token)
-		info, err := c.GetInfo()
+		info, err := c.GetInfo(ctx)
 		if err != nil {
 			return err
 		}
-		return output.Render(os.Stdout, resolveFormat(), info, nil, renderOpts()...)
-	},
+		return render(ctx, os.Stdout, resolveFormat(), serverInfo{Server: cfg.Server, HAInfo: *info}, nil, renderOpts()...)
+	}),
 }
 
 func init() {
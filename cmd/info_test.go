@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rnorth/ha-client/internal/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInfo_ServerFailover(t *testing.T) {
+	path := setupConfigHome(t)
+
+	// down accepts connections but drops them without answering.
+	downProbes := 0
+	down := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/": func(w http.ResponseWriter, r *http.Request) {
+			downProbes++
+			conn, _, err := w.(http.Hijacker).Hijack()
+			require.NoError(t, err)
+			_ = conn.Close()
+		},
+	})
+	defer down.Close()
+	downURL := down.URL
+
+	pings := 0
+	remote := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/": func(w http.ResponseWriter, r *http.Request) {
+			pings++
+			_, _ = w.Write([]byte(`{"message":"API running."}`))
+		},
+		"/api/config": func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewEncoder(w).Encode(client.HAInfo{Version: "2024.1.0"})
+		},
+	})
+	defer remote.Close()
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	require.NoError(t, os.WriteFile(path, []byte(`current-context: laptop
+contexts:
+  - name: laptop
+    token: test-token
+    servers:
+      - `+downURL+`
+      - `+remote.URL+`
+`), 0600))
+
+	for i := 0; i < 2; i++ {
+		out, err := captureStdout(t, func() error {
+			return runCLI(t, "info", "-o", "json")
+		})
+		require.NoError(t, err)
+		var got map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(out), &got))
+		assert.Equal(t, remote.URL, got["server"])
+		assert.Equal(t, "2024.1.0", got["version"])
+	}
+	assert.Equal(t, 1, downProbes, "the selected server should be cached")
+	assert.Equal(t, 2, pings, "the cached server is checked before each command")
+}
+
+func TestInfo_NoServerReachable(t *testing.T) {
+	path := setupConfigHome(t)
+	down := newMockRESTServer(t, nil)
+	down.Close()
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	require.NoError(t, os.WriteFile(path, []byte(`contexts:
+  - name: default
+    token: test-token
+    servers: [`+down.URL+`, `+down.URL+`/other]
+`), 0600))
+
+	err := runCLI(t, "info", "-o", "json")
+	assert.ErrorContains(t, err, "none of its servers is reachable")
+}
+
+func TestInfo_CachedServerDown(t *testing.T) {
+	path := setupConfigHome(t)
+	infoServer := func(version string, pings *int) *httptest.Server {
+		return newMockRESTServer(t, map[string]http.HandlerFunc{
+			"/api/": func(w http.ResponseWriter, r *http.Request) {
+				*pings++
+				_, _ = w.Write([]byte(`{"message":"API running."}`))
+			},
+			"/api/config": func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(client.HAInfo{Version: version})
+			},
+		})
+	}
+	var localPings, remotePings int
+	local := infoServer("local", &localPings)
+	remote := infoServer("remote", &remotePings)
+	defer remote.Close()
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	require.NoError(t, os.WriteFile(path, []byte(`contexts:
+  - name: default
+    token: test-token
+    servers: [`+local.URL+`, `+remote.URL+`]
+`), 0600))
+	version := func() string {
+		t.Helper()
+		out, err := captureStdout(t, func() error { return runCLI(t, "info", "-o", "json") })
+		require.NoError(t, err)
+		var got map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(out), &got))
+		return got["version"].(string)
+	}
+
+	assert.Equal(t, "local", version())
+	local.Close()
+	assert.Equal(t, "remote", version(), "a cached server that is down should be replaced")
+	assert.Equal(t, "remote", version())
+	assert.Equal(t, 1, localPings)
+	assert.Equal(t, 2, remotePings, "the new choice should be cached and checked")
+}
+
+func TestInfo_Formats(t *testing.T) {
+	setupConfigHome(t)
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/config": func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewEncoder(w).Encode(client.HAInfo{Version: "2024.1.0", LocationName: "Home"})
+		},
+	})
+	defer srv.Close()
+	t.Setenv("HASS_SERVER", srv.URL)
+	t.Setenv("HASS_TOKEN", "test-token")
+
+	out, err := captureStdout(t, func() error { return runCLI(t, "info", "-o", "yaml") })
+	require.NoError(t, err)
+	assert.Contains(t, out, "server: "+srv.URL+"\n")
+	assert.Contains(t, out, "version: 2024.1.0\n", "HAInfo's fields are inlined")
+
+	out, err = captureStdout(t, func() error { return runCLI(t, "info", "-o", "table") })
+	require.NoError(t, err)
+	assert.Contains(t, out, "LocationName")
+	assert.NotContains(t, out, "HAInfo")
+
+	out, err = captureStdout(t, func() error { return runCLI(t, "info", "-o", "csv") })
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out, "SERVER,VERSION,LOCATION_NAME,"), out)
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"os"
 	"strings"
-	"syscall"
 
 	"github.com/rnorth/ha-client/internal/client"
 	"github.com/rnorth/ha-client/internal/config"
@@ -13,53 +12,179 @@ import (
 	"golang.org/x/term"
 )
 
+var loginUsername string
+
 var loginCmd = &cobra.Command{
 	Use:   "login",
 	Short: "Store Home Assistant credentials",
-	Long:  "Prompts for server URL and long-lived access token and stores them securely.",
+	Long: `Prompts for server URL and long-lived access token and stores them securely
+under the selected context (see 'ha-client config get-contexts').
+
+With --username, logs in with a Home Assistant username and password instead
+(answering any multi-factor prompt) and stores a refresh token, from which
+short-lived access tokens are obtained as needed.
+
+Examples:
+  ha-client login
+  ha-client login --context cabin
+  ha-client login --server http://homeassistant.local:8123 --username alice`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		name, err := selectedContext()
+		if err != nil {
+			return err
+		}
 		reader := bufio.NewReader(os.Stdin)
 
-		fmt.Print("Home Assistant server URL (e.g. http://homeassistant.local:8123): ")
-		server, _ := reader.ReadString('\n')
-		server = strings.TrimSpace(server)
+		server := serverFlag
+		if server == "" {
+			fmt.Print("Home Assistant server URL (e.g. http://homeassistant.local:8123): ")
+			server, _ = reader.ReadString('\n')
+			server = strings.TrimSpace(server)
+		}
 
-		fmt.Print("Long-lived access token: ")
-		tokenBytes, err := term.ReadPassword(int(syscall.Stdin))
-		fmt.Println()
-		if err != nil {
-			// Fallback for non-TTY (e.g. piped input in tests)
-			tokenBytes, _ = reader.ReadBytes('\n')
+		if loginUsername != "" {
+			return loginWithPassword(cmd, reader, name, server)
 		}
-		token := strings.TrimSpace(string(tokenBytes))
 
-		// Verify credentials work
-		c := client.NewRESTClient(server, token)
-		if _, err := c.GetInfo(); err != nil {
+		token := readSecret(reader, "Long-lived access token: ")
+
+		// Verify credentials work. The timeout starts only now so that time spent
+		// typing at the prompts does not count against it.
+		ctx, cancel := withTimeout(cmd.Context())
+		defer cancel()
+		opts, err := loginClientOptions(name)
+		if err != nil {
+			return err
+		}
+		c := client.NewRESTClient(server, token, opts...)
+		if _, err := c.GetInfo(ctx); err != nil {
 			return fmt.Errorf("could not connect to Home Assistant: %w", err)
 		}
 
-		if err := config.SaveToKeychain(server, token); err != nil {
+		if err := config.SaveToKeychain(name, server, token); err != nil {
 			return fmt.Errorf("failed to save credentials: %w", err)
 		}
-		fmt.Println("Credentials saved successfully.")
+		fmt.Printf("Credentials saved successfully for context %q.\n", name)
 		return nil
 	},
 }
 
+// loginWithPassword runs Home Assistant's login flow and stores the resulting
+// refresh token for the context.
+func loginWithPassword(cmd *cobra.Command, reader *bufio.Reader, name, server string) error {
+	password := readSecret(reader, "Password: ")
+
+	opts, err := loginClientOptions(name)
+	if err != nil {
+		return err
+	}
+	auth := client.NewAuthClient(server, opts...)
+	// Further forms, such as a TOTP code, are answered at the terminal. The
+	// timeout is not applied here: the user may need a while to find the code.
+	tokens, err := auth.Login(cmd.Context(), loginUsername, password, func(step *client.LoginStep) (map[string]interface{}, error) {
+		return promptLoginStep(reader, step), nil
+	})
+	if err != nil {
+		return fmt.Errorf("login failed: %w", err)
+	}
+
+	ctx, cancel := withTimeout(cmd.Context())
+	defer cancel()
+	if _, err := client.NewRESTClient(server, tokens.AccessToken, opts...).GetInfo(ctx); err != nil {
+		return fmt.Errorf("could not connect to Home Assistant: %w", err)
+	}
+	if err := config.SaveRefreshToken(name, server, tokens.RefreshToken); err != nil {
+		return fmt.Errorf("failed to save credentials: %w", err)
+	}
+	fmt.Printf("Logged in as %s; refresh token saved for context %q.\n", loginUsername, name)
+	return nil
+}
+
+// promptLoginStep asks for each field of a login flow form.
+func promptLoginStep(reader *bufio.Reader, step *client.LoginStep) map[string]interface{} {
+	data := map[string]interface{}{}
+	for _, f := range step.DataSchema {
+		label := f.Name
+		if step.StepID == "mfa" && f.Name == "code" {
+			label = "Two-factor authentication code"
+		}
+		if f.Options != nil {
+			label += fmt.Sprintf(" %v", f.Options)
+		}
+		fmt.Printf("%s: ", label)
+		v, _ := reader.ReadString('\n')
+		data[f.Name] = strings.TrimSpace(v)
+	}
+	return data
+}
+
+// readSecret prompts for a value without echoing it, falling back to a plain
+// read when stdin is not a terminal (e.g. piped input in tests).
+func readSecret(reader *bufio.Reader, prompt string) string {
+	fmt.Print(prompt)
+	b, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		b, _ = reader.ReadBytes('\n')
+	}
+	return strings.TrimSpace(string(b))
+}
+
 var logoutCmd = &cobra.Command{
 	Use:   "logout",
-	Short: "Remove stored Home Assistant credentials",
+	Short: "Remove stored Home Assistant credentials for the selected context",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := config.DeleteFromKeychain(); err != nil {
+		name, err := selectedContext()
+		if err != nil {
+			return err
+		}
+		revokeRefreshToken(cmd, name)
+		if err := config.DeleteFromKeychain(name); err != nil {
 			return fmt.Errorf("failed to remove credentials: %w", err)
 		}
-		fmt.Println("Credentials removed.")
+		fmt.Printf("Credentials removed for context %q.\n", name)
 		return nil
 	},
 }
 
+// revokeRefreshToken tells Home Assistant to forget a username/password login
+// before its refresh token is deleted locally. It is best effort: logging out
+// must work even when the server is unreachable.
+func revokeRefreshToken(cmd *cobra.Command, name string) {
+	ctx, cancel := withTimeout(cmd.Context())
+	defer cancel()
+	cfg, err := config.Resolve(ctx, config.Overrides{Context: name})
+	if err != nil || cfg.RefreshToken == "" || cfg.Server == "" {
+		return
+	}
+	opts, err := clientOptions(cfg.Transport)
+	if err != nil {
+		return
+	}
+	if err := client.NewAuthClient(cfg.Server, opts...).Revoke(ctx, cfg.RefreshToken); err != nil {
+		verbosef("revoking refresh token: %v", err)
+	}
+}
+
 func init() {
+	loginCmd.Flags().StringVar(&loginUsername, "username", "", "log in with this Home Assistant user's password instead of a long-lived token")
 	rootCmd.AddCommand(loginCmd)
 	rootCmd.AddCommand(logoutCmd)
 }
+
+// loginClientOptions returns the transport settings for verifying new
+// credentials: the context's own, if it exists already, overridden by flags.
+func loginClientOptions(context string) ([]client.Option, error) {
+	t, err := transportOverrides()
+	if err != nil {
+		return nil, err
+	}
+	file, err := config.LoadFile(config.DefaultConfigPath())
+	if err != nil {
+		return nil, err
+	}
+	if c := file.Context(context); c != nil {
+		t = c.Transport.Merge(t)
+	}
+	return clientOptions(t)
+}
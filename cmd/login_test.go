@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/rnorth/ha-client/internal/client"
+	"github.com/rnorth/ha-client/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withStdin feeds input to the command's prompts.
+func withStdin(t *testing.T, input string) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	_, _ = w.WriteString(input)
+	_ = w.Close()
+	old := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() { os.Stdin = old })
+}
+
+func TestLogin_Password(t *testing.T) {
+	setupConfigHome(t)
+	t.Cleanup(func() { loginUsername = "" })
+
+	var refreshes, revoked int
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/auth/login_flow": func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewEncoder(w).Encode(client.LoginStep{FlowID: "f1", Type: "form", StepID: "init"})
+		},
+		"/auth/login_flow/f1": func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			switch {
+			case body["password"] == "secret":
+				_ = json.NewEncoder(w).Encode(client.LoginStep{FlowID: "f1", Type: "form", StepID: "mfa",
+					DataSchema: []client.LoginField{{Name: "code", Type: "string"}}})
+			case body["code"] == "123456":
+				_ = json.NewEncoder(w).Encode(client.LoginStep{Type: "create_entry", Result: "auth-code"})
+			default:
+				_ = json.NewEncoder(w).Encode(client.LoginStep{FlowID: "f1", Type: "form", StepID: "init",
+					Errors: map[string]string{"base": "invalid_auth"}})
+			}
+		},
+		"/auth/token": func(w http.ResponseWriter, r *http.Request) {
+			if r.FormValue("grant_type") == "refresh_token" {
+				assert.Equal(t, "refresh-1", r.FormValue("refresh_token"))
+				refreshes++
+			}
+			_ = json.NewEncoder(w).Encode(client.Tokens{AccessToken: "access", RefreshToken: "refresh-1", ExpiresIn: 1800})
+		},
+		"/auth/revoke": func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "refresh-1", r.FormValue("token"))
+			revoked++
+		},
+		"/api/config": func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "Bearer access", r.Header.Get("Authorization"))
+			_ = json.NewEncoder(w).Encode(client.HAInfo{Version: "2024.1.0"})
+		},
+	})
+	defer srv.Close()
+
+	withStdin(t, "secret\n123456\n")
+	_, err := captureStdout(t, func() error {
+		return runCLI(t, "login", "--server", srv.URL, "--username", "alice")
+	})
+	require.NoError(t, err)
+
+	cfg, err := config.Resolve(context.Background(), config.Overrides{})
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL, cfg.Server)
+	assert.Equal(t, "refresh-1", cfg.RefreshToken)
+	assert.Empty(t, cfg.Token)
+
+	out, err := captureStdout(t, func() error {
+		return runCLI(t, "info", "-o", "json")
+	})
+	require.NoError(t, err)
+	assert.Contains(t, out, "2024.1.0")
+	assert.Equal(t, 1, refreshes, "commands exchange the refresh token for an access token")
+
+	_, err = captureStdout(t, func() error { return runCLI(t, "logout") })
+	require.NoError(t, err)
+	assert.Equal(t, 1, revoked)
+
+	t.Run("wrong password", func(t *testing.T) {
+		withStdin(t, "wrong\n")
+		_, err := captureStdout(t, func() error {
+			return runCLI(t, "login", "--server", srv.URL, "--username", "alice")
+		})
+		assert.ErrorContains(t, err, "invalid username or password")
+	})
+}
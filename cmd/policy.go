@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rnorth/ha-client/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var policyFile string
+
+// mutatingCommands change Home Assistant, so a read-only policy denies them.
+// Commands with a --dry-run flag do not mutate when it is given.
+var mutatingCommands = map[string]bool{
+	"action call":              true,
+	"area create":              true,
+	"area delete":              true,
+	"auth token create":        true,
+	"auth token revoke":        true,
+	"automation apply":         true,
+	"automation trigger":       true,
+	"automation enable":        true,
+	"automation disable":       true,
+	"state set":                true,
+	"supervisor addon start":   true,
+	"supervisor addon stop":    true,
+	"supervisor addon restart": true,
+	"supervisor backup create": true,
+}
+
+// commandName is the command's path without the binary name, e.g. "state set".
+func commandName(cmd *cobra.Command) string {
+	return strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+}
+
+// mutates reports whether this invocation of cmd would change Home Assistant.
+func mutates(cmd *cobra.Command) bool {
+	if !mutatingCommands[commandName(cmd)] {
+		return false
+	}
+	if f := cmd.Flags().Lookup("dry-run"); f != nil && f.Value.String() == "true" {
+		return false
+	}
+	return true
+}
+
+// policies returns the policies in force for the selected context, or for the
+// context being run when the command is fanned out: the config file's, the
+// context's own, and --policy.
+func policies(ctx context.Context) (config.Policies, error) {
+	file, err := config.LoadFile(config.DefaultConfigPath())
+	if err != nil {
+		return nil, err
+	}
+	name := config.SelectContext(contextFlag, file)
+	if run := fanOutFrom(ctx); run != nil {
+		name = run.context
+	}
+	ps := file.Policies(name)
+	if policyFile != "" {
+		p, err := config.LoadPolicy(policyFile)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, *p)
+	}
+	return ps, nil
+}
+
+// checkCommandPolicy runs before every command that talks to Home Assistant,
+// so that a denied command fails before anything is sent.
+func checkCommandPolicy(ctx context.Context, cmd *cobra.Command) error {
+	ps, err := policies(ctx)
+	if err != nil {
+		return err
+	}
+	return ps.CheckCommand(commandName(cmd), mutates(cmd))
+}
+
+// checkEntityPolicy checks the entities a command is about to change.
+func checkEntityPolicy(ctx context.Context, ids ...string) error {
+	ps, err := policies(ctx)
+	if err != nil {
+		return err
+	}
+	return ps.CheckEntities(ids...)
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&policyFile, "policy", "", "policy file restricting commands, actions and entities (in addition to the config file's)")
+}
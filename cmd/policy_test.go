@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rnorth/ha-client/internal/client"
+	clierrors "github.com/rnorth/ha-client/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy(t *testing.T) {
+	path := setupConfigHome(t)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	require.NoError(t, os.WriteFile(path, []byte(`
+policy:
+  deny_actions: ["lock.*"]
+  deny_commands: ["area delete", "event watch"]
+  allow_entities: ["light.*"]
+`), 0600))
+	readOnly := filepath.Join(t.TempDir(), "read-only.yaml")
+	require.NoError(t, os.WriteFile(readOnly, []byte("read_only: true\n"), 0600))
+
+	var called bool
+	ws := newMockWSServer(t, []interface{}{
+		[]client.Area{{AreaID: "kitchen", Name: "Kitchen"}},
+		[]client.Device{},
+		[]client.EntityEntry{{EntityID: "light.ceiling", AreaID: "kitchen"}, {EntityID: "switch.fan", AreaID: "kitchen"}},
+	})
+	defer ws.Close()
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/websocket": ws.Config.Handler.ServeHTTP,
+		"/api/services":  actionSchemaHandler,
+		"/api/services/homeassistant/turn_off": func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			_, _ = w.Write([]byte("[]"))
+		},
+	})
+	defer srv.Close()
+	t.Setenv("HASS_SERVER", srv.URL)
+	t.Setenv("HASS_TOKEN", "test-token")
+	actionDataJSONRaw, actionDataFields = "", nil
+	t.Cleanup(func() { actionTargets, actionYes, actionDryRun = actionTargetFlags{}, false, false })
+
+	for _, tc := range []struct {
+		args []string
+		msg  string
+	}{
+		{[]string{"action", "call", "lock.unlock", "--entity_id=lock.front_door", "--yes"}, `action lock.unlock: denied by policy (deny_actions "lock.*")`},
+		{[]string{"action", "call", "homeassistant.turn_off", "--entity_id=switch.fan", "--yes", "--no-validate"}, "entity switch.fan: denied by policy (not in allow_entities)"},
+		{[]string{"action", "call", "homeassistant.turn_off", "--area=kitchen", "--yes", "--no-validate"}, "entity switch.fan: denied by policy"},
+		{[]string{"area", "delete", "kitchen"}, `area delete: denied by policy (deny_commands "area delete")`},
+		{[]string{"event", "watch"}, `event watch: denied by policy (deny_commands "event watch")`},
+		{[]string{"state", "set", "switch.fan", "on"}, "entity switch.fan: denied by policy"},
+		{[]string{"state", "set", "light.desk", "on", "--policy", readOnly}, "state set: denied by policy (read_only)"},
+	} {
+		actionTargets = actionTargetFlags{}
+		err := runCLI(t, tc.args...)
+		require.Error(t, err, tc.args)
+		assert.Contains(t, err.Error(), tc.msg)
+		assert.Equal(t, "policy_denied", clierrors.Classify(err).Code)
+		assert.Equal(t, clierrors.ExitPolicyDenied, clierrors.Classify(err).ExitCode)
+	}
+	assert.False(t, called, "denied calls must not reach Home Assistant")
+
+	actionTargets = actionTargetFlags{}
+	require.NoError(t, runCLI(t, "action", "call", "homeassistant.turn_off", "--entity_id=light.desk", "--dry-run", "--no-validate", "--policy", readOnly))
+	assert.False(t, called, "a dry run is allowed by a read-only policy")
+
+	actionTargets, actionDryRun = actionTargetFlags{}, false
+	require.NoError(t, runCLI(t, "action", "call", "homeassistant.turn_off", "--entity_id=light.desk", "--yes", "--no-validate"))
+	assert.True(t, called)
+}
+
+func TestPolicy_EntityIDAll(t *testing.T) {
+	policy := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(policy, []byte("deny_entities: [\"lock.*\"]\n"), 0600))
+
+	var called bool
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/services": actionSchemaHandler,
+		"/api/states": statesServer(
+			client.State{EntityID: "lock.front_door", State: "locked"},
+			client.State{EntityID: "light.desk", State: "on"},
+		),
+		"/api/services/lock/unlock": func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			_, _ = w.Write([]byte("[]"))
+		},
+		"/api/services/light/turn_off": func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			_, _ = w.Write([]byte("[]"))
+		},
+	})
+	defer srv.Close()
+	t.Setenv("HASS_SERVER", srv.URL)
+	t.Setenv("HASS_TOKEN", "test-token")
+	actionDataJSONRaw, actionDataFields = "", nil
+	t.Cleanup(func() {
+		actionTargets, actionYes, actionNoValidate, actionDataFields = actionTargetFlags{}, false, false, nil
+	})
+
+	for _, args := range [][]string{
+		{"action", "call", "lock.unlock", "-d", "entity_id=all", "--yes", "--policy", policy},
+		{"action", "call", "lock.unlock", "--entity_id", "all", "--yes", "--policy", policy},
+		{"action", "call", "homeassistant.turn_off", "-d", "entity_id=all", "--yes", "--no-validate", "--policy", policy},
+	} {
+		actionTargets, actionDataFields, actionNoValidate = actionTargetFlags{}, nil, false
+		err := runCLI(t, args...)
+		require.Error(t, err, args)
+		assert.Contains(t, err.Error(), `entity lock.front_door: denied by policy (deny_entities "lock.*")`, args)
+		assert.Equal(t, clierrors.ExitPolicyDenied, clierrors.Classify(err).ExitCode)
+	}
+	assert.False(t, called, "denied calls must not reach Home Assistant")
+
+	actionTargets, actionDataFields, actionNoValidate = actionTargetFlags{}, nil, false
+	require.NoError(t, runCLI(t, "action", "call", "light.turn_off", "-d", "entity_id=all", "--yes", "--policy", policy))
+	assert.True(t, called, "all lights are not locks")
+}
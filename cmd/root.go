@@ -1,9 +1,19 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/rnorth/ha-client/internal/client"
 	"github.com/rnorth/ha-client/internal/config"
@@ -15,10 +25,18 @@ import (
 
 var (
 	outputFormat string
+	contextFlag  string
 	serverFlag   string
 	tokenFlag    string
+	supervisor   bool
+	transport    config.Transport
+	headerFlags  []string
+	retries      int
+	retryActions bool
 	quietMode    bool
+	verbose      int
 	noHeaders    bool
+	timeout      time.Duration
 )
 
 var rootCmd = &cobra.Command{
@@ -28,27 +46,176 @@ var rootCmd = &cobra.Command{
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	// Ctrl+C / SIGTERM cancel the context, aborting in-flight requests. Default
+	// handling is then restored, so that a second Ctrl+C kills a command stuck
+	// on something that ignores the context, such as a prompt.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	closeTrace()
+	if err != nil {
 		ce := clierrors.Classify(err)
+		printError(ce, "")
+		os.Exit(ce.ExitCode)
+	}
+}
+
+// printError reports an error on stderr. context names the context that failed
+// when a command was run against several at once.
+func printError(ce *clierrors.CLIError, context string) {
+	if !term.IsTerminal(int(os.Stderr.Fd())) {
+		// Structured JSON error for agents/pipes
+		errObj := struct {
+			Error   string `json:"error"`
+			Code    string `json:"code"`
+			Context string `json:"context,omitempty"`
+			Status  int    `json:"status,omitempty"`
+			HACode  string `json:"ha_code,omitempty"`
+			Request string `json:"request,omitempty"`
+		}{ce.Error(), ce.Code, context, ce.Status, ce.HACode, ce.Request}
+		data, _ := json.Marshal(errObj)
+		fmt.Fprintln(os.Stderr, string(data))
+	} else if context != "" {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", context, ce)
+	} else {
+		fmt.Fprintln(os.Stderr, ce)
+	}
+}
 
-		if !term.IsTerminal(int(os.Stderr.Fd())) {
-			// Structured JSON error for agents/pipes
-			errObj := map[string]string{"error": ce.Error(), "code": ce.Code}
-			data, _ := json.Marshal(errObj)
-			fmt.Fprintln(os.Stderr, string(data))
-		} else {
-			fmt.Fprintln(os.Stderr, err)
+// configKey is the context key of a command run's configMemo.
+type configKey struct{}
+
+// configMemo holds the settings resolved for one command run. A command may
+// build several clients, and each would otherwise resolve the context again,
+// re-running its token_command or server_command.
+type configMemo struct {
+	once sync.Once
+	cfg  *config.Config
+	err  error
+}
+
+// withConfigMemo gives each run of a command (one per context when fanned out)
+// its own configMemo. If the server rejects a token cached from token_command,
+// the cache is dropped and the run repeated once with a fresh token. A rejected
+// token fails the first request, so nothing was done by the first run.
+func withConfigMemo(run runFunc) runFunc {
+	return func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		for retried := false; ; retried = true {
+			m := &configMemo{}
+			err := run(context.WithValue(ctx, configKey{}, m), cmd, args)
+			if err == nil || m.cfg == nil || clierrors.Classify(err).ExitCode != clierrors.ExitAuth {
+				return err
+			}
+			// A rejected token is not kept, whether or not it came from the cache.
+			if !config.ForgetCachedToken(m.cfg) || retried || ctx.Err() != nil {
+				return err
+			}
+			verbosef("cached token rejected; running token_command again")
 		}
-		os.Exit(ce.ExitCode)
 	}
 }
 
-func resolveConfig() (*config.Config, error) {
-	cfg, err := config.Resolve(serverFlag, tokenFlag)
+// resolveConfig returns the connection settings for the selected context, or
+// for the context being run when the command is fanned out. Within a command
+// run they are resolved once and shared.
+func resolveConfig(ctx context.Context) (*config.Config, error) {
+	m, ok := ctx.Value(configKey{}).(*configMemo)
+	if !ok {
+		m = &configMemo{}
+	}
+	m.once.Do(func() { m.cfg, m.err = loadConfig(ctx) })
+	return m.cfg, m.err
+}
+
+func loadConfig(ctx context.Context) (*config.Config, error) {
+	t, err := transportOverrides()
 	if err != nil {
 		return nil, err
 	}
-	return cfg, cfg.Validate()
+	o := config.Overrides{Context: contextFlag, Server: serverFlag, Token: tokenFlag, Supervisor: supervisor, Transport: t}
+	if run := fanOutFrom(ctx); run != nil {
+		o = config.Overrides{Context: run.context, Transport: t}
+	} else if fanOutRequested() {
+		return nil, usageError("this command does not support --all-contexts or --contexts")
+	}
+	cfg, err := config.Resolve(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if len(cfg.Servers) > 1 {
+		if err := selectServer(ctx, cfg); err != nil {
+			return nil, err
+		}
+	}
+	if e := auditFrom(ctx); e != nil {
+		e.Context, e.Server = cfg.Context, cfg.Server
+	}
+	return cfg, nil
+}
+
+// probeTimeout bounds each reachability check when choosing between servers.
+const probeTimeout = 2 * time.Second
+
+// selectServer sets cfg.Server to the first of cfg.Servers that answers. The
+// one remembered from a recent run is checked first, before the command sends
+// anything, so a command is never repeated on another server part way through.
+func selectServer(ctx context.Context, cfg *config.Config) error {
+	opts, err := clientOptions(cfg.Transport)
+	if err != nil {
+		return err
+	}
+	down := ""
+	if server, ok := config.CachedServer(cfg); ok {
+		if probe(ctx, cfg, server, opts) {
+			verbosef("using %s (cached)", server)
+			cfg.Server = server
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		down = server
+		if err := config.ForgetServer(cfg); err != nil {
+			verbosef("forgetting selected server: %v", err)
+		}
+	}
+	for _, server := range cfg.Servers {
+		if server == down {
+			continue
+		}
+		if !probe(ctx, cfg, server, opts) {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue
+		}
+		cfg.Server = server
+		if err := config.CacheServer(cfg, server); err != nil {
+			verbosef("caching selected server: %v", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("context %q: none of its servers is reachable (%s)", cfg.Context, strings.Join(cfg.Servers, ", "))
+}
+
+// probe reports whether server answers within probeTimeout. Any HTTP answer
+// counts; a rejected token is reported by the command itself.
+func probe(ctx context.Context, cfg *config.Config, server string, opts []client.Option) bool {
+	probeCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	start := time.Now()
+	err := client.NewRESTClient(server, cfg.Token, opts...).Ping(probeCtx)
+	var apiErr *client.APIError
+	if err != nil && !errors.As(err, &apiErr) {
+		verbosef("probe %s: %v", server, err)
+		return false
+	}
+	verbosef("probe %s: reachable (%s)", server, time.Since(start).Round(time.Millisecond))
+	return true
 }
 
 func resolveFormat() output.Format {
@@ -57,27 +224,200 @@ func resolveFormat() output.Format {
 
 // resolveDescribeFormat returns the output format for "describe" subcommands.
 // Describe commands expose deeply-nested data (attributes, config blocks) that
-// does not render usefully as a flat table, so we upgrade table → YAML at a TTY.
+// does not render usefully as a flat table, so we upgrade table (or wide) → YAML at a TTY.
 // YAML is preferred over JSON for human-facing output because it is less noisy
 // (no quotes, no braces) and easier to scan at a glance.
 func resolveDescribeFormat() output.Format {
 	format := resolveFormat()
-	if format == output.FormatTable {
+	if format == output.FormatTable || format == output.FormatWide {
 		return output.FormatYAML
 	}
 	return format
 }
 
-func newWSClient() (*client.WSClient, error) {
-	cfg, err := resolveConfig()
+// runFunc is a command body that receives the command's context.
+type runFunc func(ctx context.Context, cmd *cobra.Command, args []string) error
+
+// withContext adapts a runFunc to cobra's RunE. The context it passes on is
+// cancelled by Ctrl+C and bounded by --timeout, so every API call made with it
+// is aborted rather than left hanging. With --all-contexts or --contexts, run is
+// called once per context (see runFanOut). Policies are checked first, and
+// commands that change Home Assistant are logged (see audited), per context.
+func withContext(run runFunc) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		// A bad -o template is reported before anything is sent.
+		if err := resolveFormat().Validate(); err != nil {
+			return err
+		}
+		ctx, cancel := withTimeout(cmd.Context())
+		defer cancel()
+		checked := guarded(run)
+		if fanOutRequested() {
+			names, err := fanOutContexts()
+			if err != nil {
+				return err
+			}
+			return runFanOut(ctx, cmd, args, checked, names)
+		}
+		return checked(ctx, cmd, args)
+	}
+}
+
+// withStream adapts a runFunc for a command that runs until Ctrl+C, such as
+// "event watch", to cobra's RunE. It is checked and audited like withContext,
+// but --timeout is left to the command, and it cannot be fanned out.
+func withStream(run runFunc) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		return guarded(run)(cmd.Context(), cmd, args)
+	}
+}
+
+// guarded checks the policies for the context and audits the run, then calls
+// run with its own configMemo.
+func guarded(run runFunc) runFunc {
+	return audited(enforcePolicy(withConfigMemo(run)))
+}
+
+// enforcePolicy checks the policies for the context before run is called.
+func enforcePolicy(run runFunc) runFunc {
+	return func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		if err := checkCommandPolicy(ctx, cmd); err != nil {
+			return err
+		}
+		return run(ctx, cmd, args)
+	}
+}
+
+// withTimeout bounds ctx by --timeout; a zero timeout means no deadline.
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// transportOverrides returns the TLS/proxy/header settings given as flags.
+func transportOverrides() (config.Transport, error) {
+	t := transport
+	for _, h := range headerFlags {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return t, usageError("invalid --header %q: expected \"Name: value\"", h)
+		}
+		if t.Headers == nil {
+			t.Headers = map[string]string{}
+		}
+		t.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	if rootCmd.PersistentFlags().Changed("retries") {
+		if retries < 0 {
+			return t, usageError("--retries must not be negative")
+		}
+		n := retries
+		t.Retries = &n
+	}
+	return t, nil
+}
+
+// clientOptions turns a context's transport settings into client options, so
+// that REST and WebSocket connections are set up identically.
+func clientOptions(t config.Transport) ([]client.Option, error) {
+	var opts []client.Option
+	if t.CertificateAuthority != "" || t.ClientCertificate != "" || t.ClientKey != "" || t.InsecureSkipTLSVerify {
+		tlsConfig, err := client.LoadTLSConfig(t.CertificateAuthority, t.ClientCertificate, t.ClientKey, t.InsecureSkipTLSVerify)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, client.WithTLSConfig(tlsConfig))
+	}
+	if t.ProxyURL != "" {
+		u, err := url.Parse(t.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy_url: %w", err)
+		}
+		opts = append(opts, client.WithProxy(u))
+	}
+	if len(t.Headers) > 0 {
+		h := http.Header{}
+		for k, v := range t.Headers {
+			h.Set(k, v)
+		}
+		opts = append(opts, client.WithHeaders(h))
+	}
+	if t.Retries != nil {
+		opts = append(opts, client.WithRetries(*t.Retries))
+	}
+	if retryActions {
+		opts = append(opts, client.WithRetryActions(true))
+	}
+	if tracing() {
+		opts = append(opts, client.WithTracer(traceEvent))
+	}
+	return opts, nil
+}
+
+// tokenSources holds one access-token source per refresh token, so commands
+// that open several clients (or fan out) refresh each login only once.
+var (
+	tokenSourcesMu sync.Mutex
+	tokenSources   = map[string]client.TokenSource{}
+)
+
+// connectOptions returns the client options for a resolved context: its
+// transport settings plus, for a username/password login, a token source that
+// exchanges the stored refresh token for access tokens.
+func connectOptions(cfg *config.Config) ([]client.Option, error) {
+	opts, err := clientOptions(cfg.Transport)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Token != "" || cfg.RefreshToken == "" {
+		return opts, nil
+	}
+	key := cfg.Server + "\n" + cfg.RefreshToken
+	tokenSourcesMu.Lock()
+	ts, ok := tokenSources[key]
+	if !ok {
+		ts = client.NewRefreshTokenSource(client.NewAuthClient(cfg.Server, opts...), cfg.RefreshToken)
+		tokenSources[key] = ts
+	}
+	tokenSourcesMu.Unlock()
+	return append(opts, client.WithTokenSource(ts)), nil
+}
+
+func newRESTClient(ctx context.Context) (*client.RESTClient, error) {
+	cfg, err := resolveConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return restClient(cfg)
+}
+
+// restClient returns a REST client for already-resolved settings.
+func restClient(cfg *config.Config) (*client.RESTClient, error) {
+	opts, err := connectOptions(cfg)
 	if err != nil {
 		return nil, err
 	}
-	return client.NewWSClient(cfg.Server, cfg.Token)
+	return client.NewRESTClient(cfg.Server, cfg.Token, opts...), nil
 }
 
-func renderOpts() []output.RenderOption {
-	return []output.RenderOption{output.WithNoHeaders(noHeaders)}
+func newWSClient(ctx context.Context, extra ...client.Option) (*client.WSClient, error) {
+	cfg, err := resolveConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := connectOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return client.NewWSClient(ctx, cfg.Server, cfg.Token, append(opts, extra...)...)
+}
+
+// renderOpts returns the render options set by flags, plus extra ones such as
+// a command's wide columns.
+func renderOpts(extra ...output.RenderOption) []output.RenderOption {
+	return append([]output.RenderOption{output.WithNoHeaders(noHeaders)}, extra...)
 }
 
 func info(format string, a ...interface{}) {
@@ -86,11 +426,48 @@ func info(format string, a ...interface{}) {
 	}
 }
 
+// verbosef writes diagnostics to stderr when -v is given.
+func verbosef(format string, a ...interface{}) {
+	if verbose > 0 {
+		fmt.Fprintf(os.Stderr, format+"\n", a...)
+	}
+}
+
+// usageError reports a mistake in how a command was invoked (exit code 2).
+func usageError(format string, a ...interface{}) error {
+	return &clierrors.CLIError{Err: fmt.Errorf(format, a...), ExitCode: clierrors.ExitUsage, Code: "usage_error"}
+}
+
+var (
+	stdinOnce sync.Once
+	stdinData []byte
+	stdinErr  error
+)
+
+// readStdin reads all of stdin once, so that a command fanned out across
+// contexts sees the same input in every run.
+func readStdin() ([]byte, error) {
+	stdinOnce.Do(func() { stdinData, stdinErr = io.ReadAll(os.Stdin) })
+	return stdinData, stdinErr
+}
+
 func init() {
-	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "", "output format: table, json, yaml (default: auto-detect TTY)")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "", "output format: table, wide, json, yaml, ndjson, csv, tsv, markdown, name, custom-columns=HEADER:.path,..., jsonpath=TEMPLATE, go-template=TEMPLATE, go-template-file=PATH (default: auto-detect TTY)")
+	rootCmd.PersistentFlags().StringVar(&contextFlag, "context", "", "context (named HA instance) to use (overrides HASS_CONTEXT/current-context)")
 	rootCmd.PersistentFlags().StringVar(&serverFlag, "server", "", "HA server URL (overrides config/env)")
 	rootCmd.PersistentFlags().StringVar(&tokenFlag, "token", "", "HA access token (overrides config/env)")
+	rootCmd.PersistentFlags().BoolVar(&supervisor, "supervisor", false, "connect through the Supervisor using SUPERVISOR_TOKEN (default inside an add-on when nothing else is configured)")
+	rootCmd.PersistentFlags().StringVar(&transport.CertificateAuthority, "certificate-authority", "", "path to a CA certificate file to trust (PEM)")
+	rootCmd.PersistentFlags().StringVar(&transport.ClientCertificate, "client-certificate", "", "path to a client certificate file for mutual TLS (PEM)")
+	rootCmd.PersistentFlags().StringVar(&transport.ClientKey, "client-key", "", "path to the client certificate's key file (PEM)")
+	rootCmd.PersistentFlags().BoolVar(&transport.InsecureSkipTLSVerify, "insecure-skip-tls-verify", false, "do not verify the server's certificate (insecure)")
+	rootCmd.PersistentFlags().StringVar(&transport.ProxyURL, "proxy-url", "", "HTTP(S) proxy to connect through (overrides HTTPS_PROXY)")
+	rootCmd.PersistentFlags().StringArrayVar(&headerFlags, "header", nil, "extra request header \"Name: value\" (repeatable)")
+	rootCmd.PersistentFlags().IntVar(&retries, "retries", 0, "retry failed reads this many times on connection errors and 429/502/503/504 (default: the context's retries, else 0)")
+	rootCmd.PersistentFlags().BoolVar(&retryActions, "retry-actions", false, "also retry action calls and other writes, which may then run twice")
+	rootCmd.PersistentFlags().CountVarP(&verbose, "verbose", "v", "log requests and diagnostics on stderr (-vv adds headers, bodies and WebSocket frames)")
 	rootCmd.PersistentFlags().BoolVarP(&quietMode, "quiet", "q", false, "suppress informational messages on stderr")
-	rootCmd.PersistentFlags().BoolVar(&noHeaders, "no-headers", false, "omit table headers (only affects table output)")
+	rootCmd.PersistentFlags().BoolVar(&noHeaders, "no-headers", false, "omit table headers (affects table, wide, custom-columns, csv and tsv output)")
+	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 30*time.Second, "maximum time to wait for Home Assistant (0 for no limit)")
 	rootCmd.Version = "0.1.0"
 }
@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rnorth/ha-client/internal/client"
+	clierrors "github.com/rnorth/ha-client/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain gives the tests a home directory of their own, so that nothing
+// they write (the audit log, caches) lands in the real one.
+func TestMain(m *testing.M) {
+	home, err := os.MkdirTemp("", "ha-client-test")
+	if err != nil {
+		panic(err)
+	}
+	_ = os.Setenv("HOME", home)
+	_ = os.Setenv("XDG_CACHE_HOME", filepath.Join(home, ".cache"))
+	code := m.Run()
+	_ = os.RemoveAll(home)
+	os.Exit(code)
+}
+
+func TestTimeoutFlag(t *testing.T) {
+	release := make(chan struct{})
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/states": func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		},
+	})
+	defer srv.Close()
+	defer close(release)
+
+	t.Setenv("HASS_SERVER", srv.URL)
+	t.Setenv("HASS_TOKEN", "test-token")
+	t.Cleanup(func() { timeout = 30 * time.Second })
+
+	rootCmd.SilenceErrors = true
+	rootCmd.SilenceUsage = true
+	rootCmd.SetArgs([]string{"state", "list", "--timeout", "50ms", "-o", "json"})
+	err := rootCmd.Execute()
+	require.Error(t, err)
+	ce := clierrors.Classify(err)
+	assert.Equal(t, "timeout", ce.Code)
+	assert.Equal(t, clierrors.ExitTimeout, ce.ExitCode)
+}
+
+func TestHeaderFlag(t *testing.T) {
+	var got string
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/states": func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header.Get("CF-Access-Client-Id")
+			_, _ = w.Write([]byte("[]"))
+		},
+	})
+	defer srv.Close()
+
+	t.Setenv("HASS_SERVER", srv.URL)
+	t.Setenv("HASS_TOKEN", "test-token")
+	t.Cleanup(func() { headerFlags = nil })
+
+	require.NoError(t, runCLI(t, "state", "list", "--header", "CF-Access-Client-Id: abc", "-o", "json"))
+	assert.Equal(t, "abc", got)
+
+	err := runCLI(t, "state", "list", "--header", "no-colon")
+	require.Error(t, err)
+	assert.Equal(t, clierrors.ExitUsage, clierrors.Classify(err).ExitCode)
+}
+
+func TestTraceFile(t *testing.T) {
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/states": statesServer(),
+	})
+	defer srv.Close()
+
+	t.Setenv("HASS_SERVER", srv.URL)
+	t.Setenv("HASS_TOKEN", "secret-token")
+	path := filepath.Join(t.TempDir(), "trace.ndjson")
+
+	_, err := captureStdout(t, func() error {
+		return runCLI(t, "state", "list", "--trace-file", path, "--header", "X-Api-Key: key-secret", "-o", "json")
+	})
+	require.NoError(t, err)
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		assert.NotContains(t, scanner.Text(), "secret-token")
+		assert.NotContains(t, scanner.Text(), "key-secret")
+		var line map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	require.Len(t, lines, 1)
+	assert.Equal(t, "GET", lines[0]["method"])
+	assert.Equal(t, srv.URL+"/api/states", lines[0]["url"])
+	assert.Equal(t, float64(200), lines[0]["status"])
+	assert.Contains(t, lines[0], "latency_ms")
+	headers := lines[0]["request_headers"].(map[string]interface{})
+	assert.Equal(t, []interface{}{"[REDACTED]"}, headers["X-Api-Key"], "configured headers are masked")
+}
+
+func TestWriteTrace_Verbosity(t *testing.T) {
+	frame := client.TraceEvent{Kind: "ws", Direction: "recv", MessageID: 3, MessageType: "event", Frame: `{"id":3,"type":"event"}`}
+	req := client.TraceEvent{Kind: "http", Method: "GET", URL: "http://ha/api/states", Status: 200, ResponseBody: "[]"}
+
+	var v, vv strings.Builder
+	for _, e := range []client.TraceEvent{req, frame} {
+		writeTrace(&v, e, false)
+		writeTrace(&vv, e, true)
+	}
+	assert.Equal(t, "GET http://ha/api/states 200 (0s)\n", v.String(), "-v leaves out WebSocket frames")
+	assert.Equal(t, "GET http://ha/api/states 200 (0s)\n< []\nWS < {\"id\":3,\"type\":\"event\"}\n", vv.String())
+}
+
+func TestRetries(t *testing.T) {
+	path := setupConfigHome(t)
+	calls := 0
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/states": func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte("[]"))
+		},
+	})
+	defer srv.Close()
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	require.NoError(t, os.WriteFile(path, []byte(`contexts:
+  - name: default
+    server: `+srv.URL+`
+    token: test-token
+    retries: 2
+`), 0600))
+
+	_, err := captureStdout(t, func() error { return runCLI(t, "state", "list", "-o", "json") })
+	require.NoError(t, err, "the context's retries apply")
+	assert.Equal(t, 2, calls)
+
+	calls = 0
+	_, err = captureStdout(t, func() error { return runCLI(t, "state", "list", "--retries", "0", "-o", "json") })
+	require.Error(t, err, "--retries overrides the context")
+	assert.Equal(t, 1, calls)
+}
+
+func TestCachedTokenRejected(t *testing.T) {
+	path := setupConfigHome(t)
+	valid := "old-token"
+	calls := 0
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/states": func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if r.Header.Get("Authorization") != "Bearer "+valid {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte("[]"))
+		},
+	})
+	defer srv.Close()
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("old-token"), 0600))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	require.NoError(t, os.WriteFile(path, []byte(`contexts:
+  - name: default
+    server: `+srv.URL+`
+    token_command: cat `+tokenFile+`
+    cache_ttl: 1h
+`), 0600))
+
+	_, err := captureStdout(t, func() error { return runCLI(t, "state", "list", "-o", "json") })
+	require.NoError(t, err)
+
+	// The token is rotated while the old one is still cached.
+	valid = "new-token"
+	require.NoError(t, os.WriteFile(tokenFile, []byte("new-token"), 0600))
+	calls = 0
+	_, err = captureStdout(t, func() error { return runCLI(t, "state", "list", "-o", "json") })
+	require.NoError(t, err, "a rejected cached token is replaced by running token_command again")
+	assert.Equal(t, 2, calls)
+
+	// A token fresh from token_command is not retried, and not kept either.
+	valid = "other-token"
+	calls = 0
+	_, err = captureStdout(t, func() error { return runCLI(t, "state", "list", "-o", "json") })
+	assert.Equal(t, clierrors.ExitAuth, clierrors.Classify(err).ExitCode)
+	assert.Equal(t, 2, calls, "the cached token and then a fresh one")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("other-token"), 0600))
+	_, err = captureStdout(t, func() error { return runCLI(t, "state", "list", "-o", "json") })
+	require.NoError(t, err)
+}
+
+func TestResolveConfig_OncePerCommand(t *testing.T) {
+	path := setupConfigHome(t)
+	ws := registryWSServer(t, map[string]interface{}{
+		"config/area_registry/list":   []client.Area{{AreaID: "kitchen", Name: "Kitchen"}},
+		"config/device_registry/list": []client.Device{},
+		"config/entity_registry/list": []client.EntityEntry{{EntityID: "light.ceiling", AreaID: "kitchen"}},
+	})
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/websocket":               ws.Config.Handler.ServeHTTP,
+		"/api/services":                actionSchemaHandler,
+		"/api/services/light/turn_off": func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("[]")) },
+	})
+	defer srv.Close()
+	counter := filepath.Join(t.TempDir(), "runs")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	require.NoError(t, os.WriteFile(path, []byte(`contexts:
+  - name: default
+    server: `+srv.URL+`
+    token_command: echo x >> `+counter+`; echo test-token
+`), 0600))
+	t.Setenv("HASS_SERVER", "")
+	t.Setenv("HASS_TOKEN", "")
+	actionDataJSONRaw, actionDataFields = "", nil
+	t.Cleanup(func() { actionTargets = actionTargetFlags{} })
+
+	// The call, the area lookup and the plan each need a client.
+	_, err := captureStdout(t, func() error { return runCLI(t, "action", "call", "light.turn_off", "--area", "Kitchen") })
+	require.NoError(t, err)
+	runs, err := os.ReadFile(counter)
+	require.NoError(t, err)
+	assert.Equal(t, "x\n", string(runs), "token_command should run once per command")
+}
@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/rnorth/ha-client/internal/client"
+	"github.com/rnorth/ha-client/internal/selector"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fieldSelector string
+	labelSelector string
+)
+
+// labelSelectorKeys are the keys -l/--selector accepts. Each is looked up in
+// the registries, through an entity's device when the entity has none of its
+// own (as Home Assistant does for area targets).
+var labelSelectorKeys = []string{"area", "floor", "label", "device"}
+
+// addSelectorFlags adds --field-selector and -l/--selector to a list command.
+func addSelectorFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&fieldSelector, "field-selector", "", "filter by fields, e.g. state=unavailable,attributes.device_class=temperature (=, !=, =~, !~, <, >)")
+	cmd.Flags().StringVarP(&labelSelector, "selector", "l", "", "filter by registry, e.g. area=kitchen,label=critical (keys: area, floor, label, device; = or !=)")
+}
+
+// selectors are a list command's parsed --field-selector and -l/--selector.
+type selectors struct {
+	fields selector.Selector
+	labels selector.Selector
+}
+
+// parseSelectors parses the selector flags, so that a mistake is reported
+// before anything is fetched.
+func parseSelectors() (*selectors, error) {
+	fields, err := selector.Parse(fieldSelector)
+	if err != nil {
+		return nil, usageError("invalid --field-selector: %v", err)
+	}
+	labels, err := selector.Parse(labelSelector)
+	if err != nil {
+		return nil, usageError("invalid --selector: %v", err)
+	}
+	for _, r := range labels {
+		if !slices.Contains(labelSelectorKeys, r.Key) {
+			return nil, usageError("invalid --selector: unknown key %q (use %v)", r.Key, labelSelectorKeys)
+		}
+		if r.Op != "=" && r.Op != "!=" {
+			return nil, usageError("invalid --selector: %s%s%s: only = and != are supported", r.Key, r.Op, r.Value)
+		}
+	}
+	return &selectors{fields: fields, labels: labels}, nil
+}
+
+// selectorRef is the registry entry an item belongs to: an entity, or a device.
+type selectorRef struct {
+	entityID string
+	deviceID string
+}
+
+// selectItems keeps the items that match the selectors. ref tells -l which
+// entity or device an item is; the registries are only fetched if -l is given.
+func selectItems[T any](ctx context.Context, s *selectors, items []T, ref func(T) selectorRef) ([]T, error) {
+	if len(s.fields) == 0 && len(s.labels) == 0 {
+		return items, nil
+	}
+	var reg *registryIndex
+	labels := s.labels
+	if len(labels) > 0 {
+		var err error
+		if reg, labels, err = loadRegistryIndex(ctx, labels); err != nil {
+			return nil, err
+		}
+	}
+	out := make([]T, 0, len(items))
+	for _, it := range items {
+		ok, err := s.fields.MatchesObject(it)
+		if err != nil {
+			return nil, err
+		}
+		if ok && (reg == nil || labels.Matches(reg.values(ref(it)))) {
+			out = append(out, it)
+		}
+	}
+	return out, nil
+}
+
+// registryIndex answers -l lookups for entities and devices.
+type registryIndex struct {
+	entities  map[string]client.EntityEntry
+	devices   map[string]client.Device
+	areaFloor map[string]string
+}
+
+// loadRegistryIndex fetches the registries and returns the label selector with
+// its values, which may be names, resolved to IDs.
+func loadRegistryIndex(ctx context.Context, labels selector.Selector) (*registryIndex, selector.Selector, error) {
+	wsc, err := newWSClient(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer wsc.Close()
+
+	entities, err := wsc.ListEntities(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	devices, err := wsc.ListDevices(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	areas, err := wsc.ListAreas(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	reg := &registryIndex{
+		entities:  make(map[string]client.EntityEntry, len(entities)),
+		devices:   make(map[string]client.Device, len(devices)),
+		areaFloor: make(map[string]string, len(areas)),
+	}
+	for _, e := range entities {
+		reg.entities[e.EntityID] = e
+	}
+	for _, d := range devices {
+		reg.devices[d.ID] = d
+	}
+	for _, a := range areas {
+		reg.areaFloor[a.AreaID] = a.FloorID
+	}
+
+	entries := map[string][]registryEntry{}
+	for _, a := range areas {
+		entries["area"] = append(entries["area"], registryEntry{a.AreaID, a.Name})
+	}
+	for _, d := range devices {
+		entries["device"] = append(entries["device"], registryEntry{d.ID, d.Name})
+	}
+	keys := map[string]bool{}
+	for _, r := range labels {
+		keys[r.Key] = true
+	}
+	if keys["label"] {
+		list, err := wsc.ListLabels(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("listing labels: %w", err)
+		}
+		for _, l := range list {
+			entries["label"] = append(entries["label"], registryEntry{l.LabelID, l.Name})
+		}
+	}
+	if keys["floor"] {
+		list, err := wsc.ListFloors(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("listing floors: %w", err)
+		}
+		for _, f := range list {
+			entries["floor"] = append(entries["floor"], registryEntry{f.FloorID, f.Name})
+		}
+	}
+
+	resolved := make(selector.Selector, len(labels))
+	for i, r := range labels {
+		id, err := resolveRegistryID(r.Key, r.Value, entries[r.Key])
+		if err != nil {
+			return nil, nil, err
+		}
+		r.Value = id
+		resolved[i] = r
+	}
+	return reg, resolved, nil
+}
+
+// values returns the lookup for one item. An entity without an area of its own
+// is in its device's area; its labels include its device's.
+func (r *registryIndex) values(ref selectorRef) func(key string) []string {
+	var e client.EntityEntry
+	deviceID := ref.deviceID
+	if ref.entityID != "" {
+		e = r.entities[ref.entityID]
+		deviceID = e.DeviceID
+	}
+	d := r.devices[deviceID]
+	area := e.AreaID
+	if area == "" {
+		area = d.AreaID
+	}
+	return func(key string) []string {
+		var values []string
+		switch key {
+		case "area":
+			values = []string{area}
+		case "floor":
+			values = []string{r.areaFloor[area]}
+		case "device":
+			values = []string{deviceID}
+		case "label":
+			values = append(slices.Clone(e.Labels), d.Labels...)
+		}
+		return slices.DeleteFunc(values, func(v string) bool { return v == "" })
+	}
+}
@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rnorth/ha-client/internal/client"
+	clierrors "github.com/rnorth/ha-client/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// registryWSServer answers WebSocket commands by type, since list commands
+// with -l open a second connection for the registries.
+func registryWSServer(t *testing.T, results map[string]interface{}) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := wsUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.WriteJSON(map[string]string{"type": "auth_required", "ha_version": "2024.1"})
+		var auth map[string]string
+		_ = conn.ReadJSON(&auth)
+		_ = conn.WriteJSON(map[string]string{"type": "auth_ok"})
+		for {
+			var cmd struct {
+				ID   int    `json:"id"`
+				Type string `json:"type"`
+			}
+			if err := conn.ReadJSON(&cmd); err != nil {
+				return
+			}
+			result, ok := results[cmd.Type]
+			if !ok {
+				t.Errorf("unexpected WebSocket command %s", cmd.Type)
+			}
+			data, _ := json.Marshal(result)
+			_ = conn.WriteJSON(map[string]interface{}{"id": cmd.ID, "type": "result", "success": true, "result": json.RawMessage(data)})
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// selectorHome is a small house: the kitchen is upstairs, the strip light is
+// in the kitchen through its device, and the porch light is labelled critical.
+func selectorHome(t *testing.T, states ...client.State) {
+	t.Helper()
+	ws := registryWSServer(t, map[string]interface{}{
+		"config/area_registry/list": []client.Area{
+			{AreaID: "kitchen", Name: "Kitchen", FloorID: "upstairs"},
+			{AreaID: "garden", Name: "Garden"},
+		},
+		"config/floor_registry/list": []client.Floor{{FloorID: "upstairs", Name: "Upstairs"}},
+		"config/label_registry/list": []client.Label{{LabelID: "critical", Name: "Critical"}},
+		"config/device_registry/list": []client.Device{
+			{ID: "strip", Name: "Light strip", AreaID: "kitchen", Manufacturer: "IKEA"},
+			{ID: "porch", Name: "Porch lamp", AreaID: "garden", Manufacturer: "Philips", Labels: []string{"critical"}},
+		},
+		"config/entity_registry/list": []client.EntityEntry{
+			{EntityID: "light.strip", DeviceID: "strip", Platform: "tradfri"},
+			{EntityID: "light.porch", DeviceID: "porch", Platform: "hue"},
+			{EntityID: "sensor.oven", AreaID: "kitchen", Platform: "mqtt"},
+		},
+	})
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/websocket": ws.Config.Handler.ServeHTTP,
+		"/api/states":    statesServer(states...),
+	})
+	t.Cleanup(srv.Close)
+	t.Setenv("HASS_SERVER", srv.URL)
+	t.Setenv("HASS_TOKEN", "test-token")
+	t.Cleanup(func() { fieldSelector, labelSelector = "", "" })
+}
+
+func TestStateList_FieldSelector(t *testing.T) {
+	selectorHome(t,
+		client.State{EntityID: "sensor.oven", State: "180", Attributes: map[string]interface{}{"device_class": "temperature"}},
+		client.State{EntityID: "sensor.fridge", State: "4", Attributes: map[string]interface{}{"device_class": "temperature"}},
+		client.State{EntityID: "sensor.door", State: "unavailable"},
+		client.State{EntityID: "light.strip", State: "on"},
+	)
+	for _, tc := range []struct {
+		selector string
+		want     string
+	}{
+		{"state=unavailable", "sensor.door\n"},
+		{"state!=unavailable,entity_id=sensor.*", "sensor.oven\nsensor.fridge\n"},
+		{"attributes.device_class=temperature,state>20", "sensor.oven\n"},
+		{"attributes.device_class!=temperature", "sensor.door\nlight.strip\n"},
+		{"entity_id=~^sensor\\.(door|fridge)$", "sensor.fridge\nsensor.door\n"},
+	} {
+		out, err := captureStdout(t, func() error {
+			return runCLI(t, "state", "list", "--field-selector", tc.selector, "-o", "name")
+		})
+		require.NoError(t, err, tc.selector)
+		assert.Equal(t, tc.want, out, tc.selector)
+		fieldSelector = ""
+	}
+}
+
+func TestStateList_LabelSelector(t *testing.T) {
+	selectorHome(t,
+		client.State{EntityID: "sensor.oven", State: "180"},
+		client.State{EntityID: "light.strip", State: "on"},
+		client.State{EntityID: "light.porch", State: "off"},
+		client.State{EntityID: "sun.sun", State: "above_horizon"},
+	)
+	for _, tc := range []struct {
+		selector string
+		want     string
+	}{
+		{"area=Kitchen", "sensor.oven\nlight.strip\n"},
+		{"floor=upstairs,device=Light strip", "light.strip\n"},
+		{"label=critical", "light.porch\n"},
+		{"area!=kitchen", "light.porch\nsun.sun\n"},
+	} {
+		out, err := captureStdout(t, func() error {
+			return runCLI(t, "state", "list", "-l", tc.selector, "-o", "name")
+		})
+		require.NoError(t, err, tc.selector)
+		assert.Equal(t, tc.want, out, tc.selector)
+		labelSelector = ""
+	}
+
+	err := runCLI(t, "state", "list", "-l", "area=Attic")
+	assert.Equal(t, clierrors.ExitNotFound, clierrors.Classify(err).ExitCode)
+}
+
+func TestListSelectors_SharedByListCommands(t *testing.T) {
+	selectorHome(t,
+		client.State{EntityID: "automation.porch_on", State: "on", Attributes: map[string]interface{}{"mode": "single"}},
+		client.State{EntityID: "automation.oven_alert", State: "off", Attributes: map[string]interface{}{"mode": "queued"}},
+	)
+	out, err := captureStdout(t, func() error {
+		return runCLI(t, "entity", "list", "-l", "label!=critical", "--field-selector", "platform!=mqtt", "-o", "name")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "light.strip\n", out)
+	fieldSelector, labelSelector = "", ""
+
+	out, err = captureStdout(t, func() error {
+		return runCLI(t, "device", "list", "-l", "floor=Upstairs", "-o", "name")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "strip\n", out)
+	labelSelector = ""
+
+	out, err = captureStdout(t, func() error {
+		return runCLI(t, "device", "list", "--field-selector", "manufacturer=~^Phil", "-o", "name")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "porch\n", out)
+	fieldSelector = ""
+
+	out, err = captureStdout(t, func() error {
+		return runCLI(t, "automation", "list", "--field-selector", "attributes.mode=queued", "-o", "name")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "automation.oven_alert\n", out)
+}
+
+func TestListSelectors_Invalid(t *testing.T) {
+	t.Cleanup(func() { fieldSelector, labelSelector = "", "" })
+	for _, args := range [][]string{
+		{"state", "list", "--field-selector", "state"},
+		{"state", "list", "--field-selector", "attributes.temperature>warm"},
+		{"entity", "list", "--field-selector", "entity_id=~("},
+		{"device", "list", "-l", "colour=red"},
+		{"automation", "list", "-l", "area=~kitchen"},
+	} {
+		err := runCLI(t, args...)
+		require.Error(t, err, args)
+		assert.Equal(t, clierrors.ExitUsage, clierrors.Classify(err).ExitCode, args)
+		fieldSelector, labelSelector = "", ""
+	}
+}
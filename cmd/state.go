@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -24,14 +25,19 @@ var stateListCmd = &cobra.Command{
 Examples:
   ha-client state list
   ha-client state list -o json
+  ha-client state list --field-selector state=unavailable
+  ha-client state list --field-selector 'attributes.device_class=temperature,state>25' -l area=kitchen
   ha-client state list -o json | jq '.[] | select(.entity_id | startswith("light."))'`,
-	RunE: func(cmd *cobra.Command, args []string) error {
-		cfg, err := resolveConfig()
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		sel, err := parseSelectors()
 		if err != nil {
 			return err
 		}
-		c := client.NewRESTClient(cfg.Server, cfg.Token)
-		states, err := c.ListStates()
+		c, err := newRESTClient(ctx)
+		if err != nil {
+			return err
+		}
+		states, err := c.ListStates(ctx)
 		if err != nil {
 			return err
 		}
@@ -45,50 +51,71 @@ Examples:
 			}
 			states = filtered
 		}
-		return output.Render(os.Stdout, resolveFormat(), states, []string{"EntityID", "State", "LastUpdated"}, renderOpts()...)
-	},
+		states, err = selectItems(ctx, sel, states, func(s client.State) selectorRef { return selectorRef{entityID: s.EntityID} })
+		if err != nil {
+			return err
+		}
+		return render(ctx, os.Stdout, resolveFormat(), states, []string{"EntityID", "State", "LastUpdated"}, renderOpts(output.WithWideColumns(stateWideColumns...))...)
+	}),
 }
 
 var stateGetCmd = &cobra.Command{
-	Use:   "get <entity_id>",
+	Use:   "get <entity_id|->",
 	Short: "Get state of an entity",
 	Long: `Get the current state of a specific entity.
 
+With - as the entity ID, the IDs are read from stdin (one per line, as printed
+by -o name) and their states are listed.
+
 Examples:
   ha-client state get light.desk
-  ha-client state get sensor.temperature -o json`,
+  ha-client state get sensor.temperature -o json
+  ha-client entity list -o name | grep kitchen | ha-client state get -`,
 	Args:  cobra.ExactArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		cfg, err := resolveConfig()
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		c, err := newRESTClient(ctx)
 		if err != nil {
 			return err
 		}
-		c := client.NewRESTClient(cfg.Server, cfg.Token)
-		state, err := c.GetState(args[0])
+		if args[0] == "-" {
+			ids, err := expandStdinIDs(args)
+			if err != nil {
+				return err
+			}
+			states := make([]client.State, 0, len(ids))
+			for _, id := range ids {
+				state, err := c.GetState(ctx, id)
+				if err != nil {
+					return err
+				}
+				states = append(states, *state)
+			}
+			return render(ctx, os.Stdout, resolveFormat(), states, []string{"EntityID", "State", "LastUpdated"}, renderOpts(output.WithWideColumns(stateWideColumns...))...)
+		}
+		state, err := c.GetState(ctx, args[0])
 		if err != nil {
 			return err
 		}
-		return output.Render(os.Stdout, resolveFormat(), state, nil, renderOpts()...)
-	},
+		return render(ctx, os.Stdout, resolveFormat(), state, nil, renderOpts()...)
+	}),
 }
 
 var stateDescribeCmd = &cobra.Command{
 	Use:   "describe <entity_id>",
 	Short: "Show full state and attributes of an entity",
 	Args:  cobra.ExactArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		cfg, err := resolveConfig()
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		c, err := newRESTClient(ctx)
 		if err != nil {
 			return err
 		}
-		c := client.NewRESTClient(cfg.Server, cfg.Token)
-		state, err := c.GetState(args[0])
+		state, err := c.GetState(ctx, args[0])
 		if err != nil {
 			return err
 		}
 		// Always render describe as JSON/YAML (attributes map doesn't render well in table)
-		return output.Render(os.Stdout, resolveDescribeFormat(), state, nil, renderOpts()...)
-	},
+		return render(ctx, os.Stdout, resolveDescribeFormat(), state, nil, renderOpts()...)
+	}),
 }
 
 var stateSetCmd = &cobra.Command{
@@ -100,31 +127,38 @@ Examples:
   ha-client state set input_boolean.guest_mode on
   ha-client state set sensor.manual_temp 22.5 --attributes '{"unit_of_measurement":"°C"}'`,
 	Args:  cobra.ExactArgs(2),
-	RunE: func(cmd *cobra.Command, args []string) error {
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		if err := checkEntityPolicy(ctx, args[0]); err != nil {
+			return err
+		}
 		var attrs map[string]interface{}
 		if attrJSON != "" {
 			if err := json.Unmarshal([]byte(attrJSON), &attrs); err != nil {
 				return fmt.Errorf("invalid --attributes JSON: %w", err)
 			}
 		}
-		cfg, err := resolveConfig()
+		c, err := newRESTClient(ctx)
 		if err != nil {
 			return err
 		}
-		c := client.NewRESTClient(cfg.Server, cfg.Token)
-		state, err := c.SetState(args[0], args[1], attrs)
+		auditPayload(ctx, map[string]interface{}{"entity_id": args[0], "state": args[1], "attributes": attrs})
+		state, err := c.SetState(ctx, args[0], args[1], attrs)
 		if err != nil {
 			return err
 		}
-		return output.Render(os.Stdout, resolveFormat(), state, nil, renderOpts()...)
-	},
+		return render(ctx, os.Stdout, resolveFormat(), state, nil, renderOpts()...)
+	}),
 }
 
 var attrJSON string
 var stateListDomain string
 
+// stateWideColumns are the columns -o wide adds to lists of states.
+var stateWideColumns = []string{"NAME:.attributes.friendly_name", "UNIT:.attributes.unit_of_measurement", "DEVICE_CLASS:.attributes.device_class", "LastChanged"}
+
 func init() {
 	stateListCmd.Flags().StringVar(&stateListDomain, "domain", "", "filter by entity domain (e.g. light, sensor, switch)")
+	addSelectorFlags(stateListCmd)
 	stateSetCmd.Flags().StringVar(&attrJSON, "attributes", "", "JSON attributes to set alongside the state")
 	stateCmd.AddCommand(stateListCmd, stateGetCmd, stateDescribeCmd, stateSetCmd)
 	rootCmd.AddCommand(stateCmd)
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/rnorth/ha-client/internal/client"
+	clierrors "github.com/rnorth/ha-client/internal/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -77,3 +78,93 @@ func TestStateList_DomainFilter(t *testing.T) {
 	assert.Contains(t, string(out), "light.bedroom")
 	assert.NotContains(t, string(out), "switch.fan")
 }
+
+func TestStateGet_JSONPath(t *testing.T) {
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/states/sensor.living_temp": func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewEncoder(w).Encode(client.State{EntityID: "sensor.living_temp", State: "21.5",
+				Attributes: map[string]interface{}{"temperature": 21.5}})
+		},
+	})
+	defer srv.Close()
+	t.Setenv("HASS_SERVER", srv.URL)
+	t.Setenv("HASS_TOKEN", "test-token")
+
+	out, err := captureStdout(t, func() error {
+		return runCLI(t, "state", "get", "sensor.living_temp", "-o", "jsonpath={.attributes.temperature}")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "21.5", out)
+}
+
+func TestStateList_GoTemplate(t *testing.T) {
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/states": statesServer(client.State{EntityID: "light.desk", State: "on"}, client.State{EntityID: "switch.fan", State: "off"}),
+	})
+	defer srv.Close()
+	t.Setenv("HASS_SERVER", srv.URL)
+	t.Setenv("HASS_TOKEN", "test-token")
+
+	out, err := captureStdout(t, func() error {
+		return runCLI(t, "state", "list", "-o", `go-template={{range .}}{{.entity_id}}={{.state}}{{"\n"}}{{end}}`)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "light.desk=on\nswitch.fan=off\n", out)
+}
+
+func TestStateList_BadTemplateIsUsageError(t *testing.T) {
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/states": func(w http.ResponseWriter, r *http.Request) {
+			t.Error("no request should be made with an invalid template")
+		},
+	})
+	defer srv.Close()
+	t.Setenv("HASS_SERVER", srv.URL)
+	t.Setenv("HASS_TOKEN", "test-token")
+
+	err := runCLI(t, "state", "list", "-o", "jsonpath={.entity_id")
+	require.Error(t, err)
+	ce := clierrors.Classify(err)
+	assert.Equal(t, clierrors.ExitUsage, ce.ExitCode)
+	assert.Equal(t, "usage_error", ce.Code)
+}
+
+func TestStateList_WideAndCustomColumns(t *testing.T) {
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/states": statesServer(
+			client.State{EntityID: "sensor.temp", State: "21", Attributes: map[string]interface{}{"friendly_name": "Temp", "unit_of_measurement": "°C"}},
+			client.State{EntityID: "light.desk", State: "on"},
+		),
+	})
+	defer srv.Close()
+	t.Setenv("HASS_SERVER", srv.URL)
+	t.Setenv("HASS_TOKEN", "test-token")
+	t.Cleanup(func() { noHeaders = false })
+
+	out, err := captureStdout(t, func() error { return runCLI(t, "state", "list", "-o", "wide") })
+	require.NoError(t, err)
+	assert.Contains(t, out, "NAME")
+	assert.Contains(t, out, "UNIT")
+	assert.Contains(t, out, "°C")
+
+	out, err = captureStdout(t, func() error {
+		return runCLI(t, "state", "list", "--no-headers", "-o", "custom-columns=ID:.entity_id,UNIT:.attributes.unit_of_measurement")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "sensor.temp  °C\nlight.desk   <none>\n", out)
+}
+
+func TestStateList_CSV(t *testing.T) {
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/states": statesServer(client.State{EntityID: "sensor.temp", State: "21,5"}, client.State{EntityID: "light.desk", State: "on"}),
+	})
+	defer srv.Close()
+	t.Setenv("HASS_SERVER", srv.URL)
+	t.Setenv("HASS_TOKEN", "test-token")
+
+	out, err := captureStdout(t, func() error { return runCLI(t, "state", "list", "-o", "csv") })
+	require.NoError(t, err)
+	assert.Equal(t, "ENTITY_ID,STATE,LAST_UPDATED\n"+
+		"sensor.temp,\"21,5\",0001-01-01 00:00:00 +0000 UTC\n"+
+		"light.desk,on,0001-01-01 00:00:00 +0000 UTC\n", out)
+}
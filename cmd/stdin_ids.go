@@ -0,0 +1,37 @@
+package cmd
+
+import "strings"
+
+// expandStdinIDs replaces a "-" among ids with the IDs read from stdin,
+// separated by newlines or spaces as -o name prints them, so that one command's
+// output can be piped into another:
+//
+//	ha-client state list --domain light -o name | ha-client action call light.turn_off --entity_id -
+func expandStdinIDs(ids []string) ([]string, error) {
+	var out []string
+	seen := map[string]bool{}
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	for _, id := range ids {
+		if id != "-" {
+			add(id)
+			continue
+		}
+		data, err := readStdin()
+		if err != nil {
+			return nil, err
+		}
+		fromStdin := strings.Fields(string(data))
+		if len(fromStdin) == 0 {
+			return nil, usageError("no entity IDs on stdin")
+		}
+		for _, id := range fromStdin {
+			add(id)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/rnorth/ha-client/internal/client"
+	clierrors "github.com/rnorth/ha-client/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pipeIDs feeds input to the next command's stdin. Stdin is only read once per
+// process, so the cached read is reset too.
+func pipeIDs(t *testing.T, input string) {
+	t.Helper()
+	withStdin(t, input)
+	stdinOnce = sync.Once{}
+	t.Cleanup(func() { stdinOnce = sync.Once{} })
+}
+
+func TestNameOutput_PipedIntoActionCall(t *testing.T) {
+	var gotBody map[string]interface{}
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/states": statesServer(
+			client.State{EntityID: "light.desk", State: "on"},
+			client.State{EntityID: "light.hall", State: "on"},
+			client.State{EntityID: "switch.fan", State: "off"},
+		),
+		"/api/services": actionSchemaHandler,
+		"/api/services/light/turn_off": func(w http.ResponseWriter, r *http.Request) {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&gotBody))
+			_, _ = w.Write([]byte("[]"))
+		},
+	})
+	defer srv.Close()
+	t.Setenv("HASS_SERVER", srv.URL)
+	t.Setenv("HASS_TOKEN", "test-token")
+	actionDataJSONRaw, actionDataFields = "", nil
+	t.Cleanup(func() { actionTargets, stateListDomain = actionTargetFlags{}, "" })
+
+	names, err := captureStdout(t, func() error { return runCLI(t, "state", "list", "--domain", "light", "-o", "name") })
+	require.NoError(t, err)
+	assert.Equal(t, "light.desk\nlight.hall\n", names)
+
+	pipeIDs(t, names)
+	require.NoError(t, runCLI(t, "action", "call", "light.turn_off", "--entity_id", "-", "--entity_id", "light.desk"))
+	assert.Equal(t, []interface{}{"light.desk", "light.hall"}, gotBody["entity_id"])
+}
+
+func TestStateGet_Stdin(t *testing.T) {
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/states/light.desk": func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewEncoder(w).Encode(client.State{EntityID: "light.desk", State: "on"})
+		},
+		"/api/states/sensor.temp": func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewEncoder(w).Encode(client.State{EntityID: "sensor.temp", State: "21"})
+		},
+	})
+	defer srv.Close()
+	t.Setenv("HASS_SERVER", srv.URL)
+	t.Setenv("HASS_TOKEN", "test-token")
+
+	pipeIDs(t, "light.desk\n  sensor.temp\n\n")
+	out, err := captureStdout(t, func() error { return runCLI(t, "state", "get", "-", "-o", "jsonpath={[*].state}") })
+	require.NoError(t, err)
+	assert.Equal(t, "on 21", out)
+
+	pipeIDs(t, "\n")
+	err = runCLI(t, "state", "get", "-", "-o", "json")
+	assert.Equal(t, clierrors.ExitUsage, clierrors.Classify(err).ExitCode)
+}
+
+func TestAutomationEnable_Stdin(t *testing.T) {
+	var gotBody map[string]interface{}
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/api/services/automation/turn_on": func(w http.ResponseWriter, r *http.Request) {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&gotBody))
+			_, _ = w.Write([]byte("[]"))
+		},
+	})
+	defer srv.Close()
+	t.Setenv("HASS_SERVER", srv.URL)
+	t.Setenv("HASS_TOKEN", "test-token")
+
+	pipeIDs(t, "automation.morning\nevening\n")
+	require.NoError(t, runCLI(t, "automation", "enable", "-"))
+	assert.Equal(t, []interface{}{"automation.morning", "automation.evening"}, gotBody["entity_id"])
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/rnorth/ha-client/internal/client"
+	"github.com/rnorth/ha-client/internal/output"
+	"github.com/spf13/cobra"
+)
+
+// supervisorURL is a variable so tests can point it at a mock server.
+var supervisorURL = client.SupervisorURL
+
+var supervisorCmd = &cobra.Command{
+	Use:   "supervisor",
+	Short: "Manage add-ons and backups through the Supervisor (inside an add-on only)",
+	Long: `Use the Home Assistant Supervisor API to inspect the Supervisor and manage
+add-ons and backups. The Supervisor API is only reachable from inside an add-on
+(such as the SSH terminal add-on), where SUPERVISOR_TOKEN is set.`,
+}
+
+var supervisorInfoCmd = &cobra.Command{
+	Use:   "info",
+	Short: "Show Supervisor version and health",
+	Args:  cobra.NoArgs,
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		sc, err := newSupervisorClient(ctx)
+		if err != nil {
+			return err
+		}
+		info, err := sc.Info(ctx)
+		if err != nil {
+			return err
+		}
+		return render(ctx, os.Stdout, resolveFormat(), info, nil, renderOpts()...)
+	}),
+}
+
+var supervisorAddonCmd = &cobra.Command{Use: "addon", Short: "Manage add-ons"}
+
+var supervisorAddonListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List installed add-ons",
+	Long: `List installed add-ons and their state.
+
+Examples:
+  ha-client supervisor addon list
+  ha-client supervisor addon list -o json`,
+	Args: cobra.NoArgs,
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		sc, err := newSupervisorClient(ctx)
+		if err != nil {
+			return err
+		}
+		addons, err := sc.ListAddons(ctx)
+		if err != nil {
+			return err
+		}
+		return render(ctx, os.Stdout, resolveFormat(), addons, []string{"Slug", "Name", "Version", "State", "UpdateAvailable"}, renderOpts(output.WithWideColumns("Repository"))...)
+	}),
+}
+
+var supervisorAddonInfoCmd = &cobra.Command{
+	Use:   "info <slug>",
+	Short: "Show details of an add-on",
+	Args:  cobra.ExactArgs(1),
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		sc, err := newSupervisorClient(ctx)
+		if err != nil {
+			return err
+		}
+		addon, err := sc.GetAddon(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		return render(ctx, os.Stdout, resolveDescribeFormat(), addon, nil, renderOpts()...)
+	}),
+}
+
+func supervisorAddonAction(action string) func(cmd *cobra.Command, args []string) error {
+	return withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		sc, err := newSupervisorClient(ctx)
+		if err != nil {
+			return err
+		}
+		if err := sc.AddonAction(ctx, args[0], action); err != nil {
+			return err
+		}
+		info("add-on %s: %s done", args[0], action)
+		return nil
+	})
+}
+
+var supervisorBackupCmd = &cobra.Command{Use: "backup", Short: "Manage backups"}
+
+var supervisorBackupListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List backups",
+	Args:  cobra.NoArgs,
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		sc, err := newSupervisorClient(ctx)
+		if err != nil {
+			return err
+		}
+		backups, err := sc.ListBackups(ctx)
+		if err != nil {
+			return err
+		}
+		return render(ctx, os.Stdout, resolveFormat(), backups, []string{"Slug", "Name", "Date", "Type", "Size"}, renderOpts(output.WithWideColumns("Protected"))...)
+	}),
+}
+
+var supervisorBackupName string
+
+var supervisorBackupCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a full backup",
+	Long: `Create a full backup. The command waits until the backup is complete, which
+can take several minutes; raise --timeout accordingly.
+
+Examples:
+  ha-client supervisor backup create --name before-upgrade --timeout 30m`,
+	Args: cobra.NoArgs,
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+		sc, err := newSupervisorClient(ctx)
+		if err != nil {
+			return err
+		}
+		slug, err := sc.NewFullBackup(ctx, supervisorBackupName)
+		if err != nil {
+			return err
+		}
+		info("backup %s created", slug)
+		return nil
+	}),
+}
+
+// newSupervisorClient returns a Supervisor API client, which needs the
+// SUPERVISOR_TOKEN connection that only exists inside an add-on.
+func newSupervisorClient(ctx context.Context) (*client.SupervisorClient, error) {
+	cfg, err := resolveConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.Supervisor {
+		return nil, fmt.Errorf("the Supervisor API is only available inside a Home Assistant add-on (SUPERVISOR_TOKEN is not in use)")
+	}
+	opts, err := clientOptions(cfg.Transport)
+	if err != nil {
+		return nil, err
+	}
+	return client.NewSupervisorClient(supervisorURL, cfg.Token, opts...), nil
+}
+
+func init() {
+	supervisorAddonCmd.AddCommand(
+		supervisorAddonListCmd,
+		supervisorAddonInfoCmd,
+		&cobra.Command{Use: "start <slug>", Short: "Start an add-on", Args: cobra.ExactArgs(1), RunE: supervisorAddonAction("start")},
+		&cobra.Command{Use: "stop <slug>", Short: "Stop an add-on", Args: cobra.ExactArgs(1), RunE: supervisorAddonAction("stop")},
+		&cobra.Command{Use: "restart <slug>", Short: "Restart an add-on", Args: cobra.ExactArgs(1), RunE: supervisorAddonAction("restart")},
+	)
+	supervisorBackupCreateCmd.Flags().StringVar(&supervisorBackupName, "name", "", "backup name (default: chosen by the Supervisor)")
+	supervisorBackupCmd.AddCommand(supervisorBackupListCmd, supervisorBackupCreateCmd)
+	supervisorCmd.AddCommand(supervisorInfoCmd, supervisorAddonCmd, supervisorBackupCmd)
+	rootCmd.AddCommand(supervisorCmd)
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupervisorAddonList(t *testing.T) {
+	setupConfigHome(t)
+	t.Setenv("SUPERVISOR_TOKEN", "supervisor-token")
+	srv := newMockRESTServer(t, map[string]http.HandlerFunc{
+		"/addons": func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "Bearer supervisor-token", r.Header.Get("Authorization"))
+			_, _ = w.Write([]byte(`{"result":"ok","data":{"addons":[{"slug":"core_ssh","name":"Terminal & SSH","state":"started"}]}}`))
+		},
+	})
+	defer srv.Close()
+	orig := supervisorURL
+	supervisorURL = srv.URL
+	t.Cleanup(func() { supervisorURL = orig })
+
+	out, err := captureStdout(t, func() error {
+		return runCLI(t, "supervisor", "addon", "list", "-o", "json")
+	})
+	require.NoError(t, err)
+	assert.Contains(t, out, `"slug": "core_ssh"`)
+
+	out, err = captureStdout(t, func() error {
+		return runCLI(t, "supervisor", "addon", "list", "-o", "yaml")
+	})
+	require.NoError(t, err)
+	assert.Contains(t, out, "update_available: false")
+}
+
+func TestSupervisorOutsideAddon(t *testing.T) {
+	setupConfigHome(t)
+	t.Setenv("SUPERVISOR_TOKEN", "")
+	t.Setenv("HASS_SERVER", "http://ha.invalid")
+	t.Setenv("HASS_TOKEN", "token")
+
+	err := runCLI(t, "supervisor", "info")
+	assert.ErrorContains(t, err, "only available inside a Home Assistant add-on")
+}
@@ -1,11 +1,10 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"os"
 
-	"github.com/rnorth/ha-client/internal/client"
 	"github.com/spf13/cobra"
 )
 
@@ -26,7 +25,7 @@ Examples:
   echo '{{ states("sensor.temperature") }}' | ha-client template eval -
   ha-client template eval -f template.j2`,
 	Args: cobra.RangeArgs(0, 1),
-	RunE: func(cmd *cobra.Command, args []string) error {
+	RunE: withContext(func(ctx context.Context, cmd *cobra.Command, args []string) error {
 		var tmpl string
 
 		switch {
@@ -37,7 +36,7 @@ Examples:
 			}
 			tmpl = string(data)
 		case len(args) == 1 && args[0] == "-":
-			data, err := io.ReadAll(os.Stdin)
+			data, err := readStdin()
 			if err != nil {
 				return fmt.Errorf("reading stdin: %w", err)
 			}
@@ -48,20 +47,19 @@ Examples:
 			return fmt.Errorf("provide a template as an argument, via stdin (-), or with --file")
 		}
 
-		cfg, err := resolveConfig()
+		c, err := newRESTClient(ctx)
 		if err != nil {
 			return err
 		}
-		c := client.NewRESTClient(cfg.Server, cfg.Token)
 
-		result, err := c.RenderTemplate(tmpl)
+		result, err := c.RenderTemplate(ctx, tmpl)
 		if err != nil {
 			return err
 		}
 
-		fmt.Fprintln(cmd.OutOrStdout(), result)
+		fmt.Fprintln(commandOutput(ctx, cmd.OutOrStdout()), result)
 		return nil
-	},
+	}),
 }
 
 func init() {
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rnorth/ha-client/internal/client"
+)
+
+var traceFile string
+
+// traceMu serialises trace output: fanned-out commands trace concurrently.
+var (
+	traceMu  sync.Mutex
+	traceOut *os.File
+	traceErr error
+)
+
+// tracing reports whether clients should be given traceEvent.
+func tracing() bool {
+	return verbose > 0 || traceFile != ""
+}
+
+// traceEvent logs a request or frame on stderr according to -v, and appends it
+// to --trace-file as one JSON object per line.
+//
+//	-v    one line per HTTP request (method, URL, status, latency) and retry
+//	-vv   plus headers, request and response bodies, and WebSocket frames
+func traceEvent(e client.TraceEvent) {
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	if verbose > 0 {
+		writeTrace(os.Stderr, e, verbose > 1)
+	}
+	if traceFile == "" || traceErr != nil {
+		return
+	}
+	if traceOut == nil {
+		traceOut, traceErr = os.OpenFile(traceFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if traceErr != nil {
+			fmt.Fprintf(os.Stderr, "trace file: %v\n", traceErr)
+			return
+		}
+	}
+	line := struct {
+		client.TraceEvent
+		LatencyMS float64 `json:"latency_ms,omitempty"`
+		DelayMS   float64 `json:"delay_ms,omitempty"`
+	}{e, float64(e.Latency) / float64(time.Millisecond), float64(e.Delay) / float64(time.Millisecond)}
+	data, _ := json.Marshal(line)
+	_, _ = traceOut.Write(append(data, '\n'))
+}
+
+// closeTrace closes --trace-file, if it was opened.
+func closeTrace() {
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	if traceOut != nil {
+		_ = traceOut.Close()
+	}
+	traceOut, traceErr = nil, nil
+}
+
+func writeTrace(w io.Writer, e client.TraceEvent, detail bool) {
+	if e.Kind == "retry" {
+		fmt.Fprintf(w, "retrying %s %s in %s (attempt %d: %s)\n", e.Method, e.URL, e.Delay.Round(time.Millisecond), e.Attempt, e.Error)
+		return
+	}
+	if e.Kind == "ws" {
+		// A subscription streams frames, which would drown out everything else.
+		if !detail {
+			return
+		}
+		arrow := ">"
+		if e.Direction == "recv" {
+			arrow = "<"
+		}
+		fmt.Fprintf(w, "WS %s %s\n", arrow, e.Frame)
+		return
+	}
+	latency := e.Latency.Round(time.Millisecond)
+	if e.Error != "" {
+		fmt.Fprintf(w, "%s %s: %s (%s)\n", e.Method, e.URL, e.Error, latency)
+	} else {
+		fmt.Fprintf(w, "%s %s %d (%s)\n", e.Method, e.URL, e.Status, latency)
+	}
+	if !detail {
+		return
+	}
+	writeHeaders(w, "> ", e.RequestHeaders)
+	if e.RequestBody != "" {
+		fmt.Fprintf(w, "> %s\n", e.RequestBody)
+	}
+	writeHeaders(w, "< ", e.ResponseHeaders)
+	if e.ResponseBody != "" {
+		fmt.Fprintf(w, "< %s\n", strings.TrimRight(e.ResponseBody, "\n"))
+	}
+}
+
+func writeHeaders(w io.Writer, prefix string, h map[string][]string) {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s%s: %s\n", prefix, name, strings.Join(h[name], ", "))
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&traceFile, "trace-file", "", "write every HTTP request and WebSocket frame as NDJSON to this file (credentials redacted)")
+}
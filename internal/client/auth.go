@@ -0,0 +1,242 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Home Assistant identifies OAuth clients by URL (IndieAuth), and only accepts
+// a redirect URI on the same host. ha-client never follows the redirect; it
+// reads the authorization code from the login flow result instead.
+const (
+	authClientID    = "https://github.com/rnorth/ha-client"
+	authRedirectURI = authClientID + "/auth/callback"
+)
+
+// AuthClient drives Home Assistant's login flow (/auth/login_flow) and token
+// endpoint (/auth/token), which need no prior credentials.
+type AuthClient struct {
+	rest *RESTClient
+}
+
+func NewAuthClient(serverURL string, opts ...Option) *AuthClient {
+	return &AuthClient{rest: NewRESTClient(serverURL, "", opts...)}
+}
+
+// LoginStep is one step of a login flow. A "form" step asks for the fields in
+// DataSchema; "create_entry" ends the flow with an authorization code in Result;
+// "abort" ends it with a Reason.
+type LoginStep struct {
+	FlowID     string            `json:"flow_id"`
+	Type       string            `json:"type"`
+	StepID     string            `json:"step_id"`
+	DataSchema []LoginField      `json:"data_schema"`
+	Errors     map[string]string `json:"errors"`
+	Result     string            `json:"result"`
+	Reason     string            `json:"reason"`
+}
+
+// LoginField is one input requested by a login flow form.
+type LoginField struct {
+	Name     string      `json:"name"`
+	Type     string      `json:"type"`
+	Required bool        `json:"required"`
+	Options  interface{} `json:"options,omitempty"`
+}
+
+// Tokens is a response from the token endpoint. RefreshToken is only present
+// when exchanging an authorization code.
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	TokenType    string `json:"token_type"`
+}
+
+// StartLoginFlow begins a login flow with the built-in username/password provider.
+func (a *AuthClient) StartLoginFlow(ctx context.Context) (*LoginStep, error) {
+	body := map[string]interface{}{
+		"client_id":    authClientID,
+		"handler":      []interface{}{"homeassistant", nil},
+		"redirect_uri": authRedirectURI,
+	}
+	var step LoginStep
+	return &step, a.rest.post(ctx, "/auth/login_flow", body, &step)
+}
+
+// SubmitLoginStep answers the current form of a login flow.
+func (a *AuthClient) SubmitLoginStep(ctx context.Context, flowID string, data map[string]interface{}) (*LoginStep, error) {
+	body := map[string]interface{}{"client_id": authClientID}
+	for k, v := range data {
+		body[k] = v
+	}
+	var step LoginStep
+	return &step, a.rest.post(ctx, "/auth/login_flow/"+flowID, body, &step)
+}
+
+// Login runs a complete login flow: it submits the username and password,
+// then calls prompt for every further form (such as an MFA code) until Home
+// Assistant issues an authorization code, which it exchanges for tokens.
+// prompt receives the form and returns the answers keyed by field name.
+func (a *AuthClient) Login(ctx context.Context, username, password string, prompt func(*LoginStep) (map[string]interface{}, error)) (*Tokens, error) {
+	step, err := a.StartLoginFlow(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("starting login flow: %w", err)
+	}
+	data := map[string]interface{}{"username": username, "password": password}
+	for step.Type == "form" {
+		if data == nil {
+			if data, err = prompt(step); err != nil {
+				return nil, err
+			}
+		}
+		next, err := a.SubmitLoginStep(ctx, step.FlowID, data)
+		if err != nil {
+			return nil, err
+		}
+		if next.Type == "form" && next.StepID == step.StepID && len(next.Errors) > 0 {
+			// Home Assistant re-shows a form with errors after a wrong answer.
+			return nil, &APIError{Code: CodeAuthInvalid, Message: loginErrorMessage(next.Errors), Request: "login_flow"}
+		}
+		step, data = next, nil
+	}
+	switch step.Type {
+	case "create_entry":
+		return a.exchange(ctx, url.Values{"grant_type": {"authorization_code"}, "code": {step.Result}})
+	case "abort":
+		return nil, fmt.Errorf("login aborted: %s", step.Reason)
+	default:
+		return nil, fmt.Errorf("unexpected login flow step %q", step.Type)
+	}
+}
+
+func loginErrorMessage(errs map[string]string) string {
+	var msgs []string
+	for _, v := range errs {
+		switch v {
+		case "invalid_auth":
+			msgs = append(msgs, "invalid username or password")
+		case "invalid_code":
+			msgs = append(msgs, "invalid code")
+		default:
+			msgs = append(msgs, v)
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Refresh obtains a new access token for a refresh token.
+func (a *AuthClient) Refresh(ctx context.Context, refreshToken string) (*Tokens, error) {
+	return a.exchange(ctx, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}})
+}
+
+// Revoke invalidates a refresh token and the access tokens issued for it.
+func (a *AuthClient) Revoke(ctx context.Context, refreshToken string) error {
+	_, err := a.form(ctx, "/auth/revoke", url.Values{"token": {refreshToken}})
+	return err
+}
+
+func (a *AuthClient) exchange(ctx context.Context, form url.Values) (*Tokens, error) {
+	form.Set("client_id", authClientID)
+	body, err := a.form(ctx, "/auth/token", form)
+	if err != nil {
+		return nil, err
+	}
+	var t Tokens
+	if err := json.Unmarshal(body, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// form POSTs form-encoded data, which the token endpoints require.
+func (a *AuthClient) form(ctx context.Context, path string, form url.Values) ([]byte, error) {
+	c := a.rest
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewBufferString(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.opts.headers {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return nil, newHTTPError(http.MethodPost, path, resp.StatusCode, body)
+	}
+	return body, nil
+}
+
+// TokenSource supplies access tokens to REST and WebSocket clients.
+type TokenSource interface {
+	// Token returns a valid access token, obtaining a new one if needed.
+	Token(ctx context.Context) (string, error)
+	// Invalidate discards the current token after the server rejected it.
+	Invalidate()
+}
+
+// RefreshTokenSource exchanges a refresh token for short-lived access tokens,
+// renewing them shortly before they expire. It is safe for concurrent use, so
+// one source can be shared by every client talking to the same server.
+type RefreshTokenSource struct {
+	auth         *AuthClient
+	refreshToken string
+
+	mu     sync.Mutex
+	access string
+	expiry time.Time
+}
+
+func NewRefreshTokenSource(auth *AuthClient, refreshToken string) *RefreshTokenSource {
+	return &RefreshTokenSource{auth: auth, refreshToken: refreshToken}
+}
+
+// refreshMargin renews access tokens this long before they expire, so a token
+// does not lapse between being handed out and reaching the server.
+const refreshMargin = time.Minute
+
+func (s *RefreshTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.access != "" && time.Now().Add(refreshMargin).Before(s.expiry) {
+		return s.access, nil
+	}
+	t, err := s.auth.Refresh(ctx, s.refreshToken)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode < 500 {
+		// HA answers 400 invalid_grant for a revoked or expired refresh token.
+		return "", &APIError{Code: CodeAuthInvalid, Message: "refresh token rejected; run 'ha-client login' again", Request: apiErr.Request}
+	}
+	if err != nil {
+		return "", fmt.Errorf("refreshing access token: %w", err)
+	}
+	s.access, s.expiry = t.AccessToken, time.Now().Add(time.Duration(t.ExpiresIn)*time.Second)
+	return s.access, nil
+}
+
+func (s *RefreshTokenSource) Invalidate() {
+	s.mu.Lock()
+	s.access = ""
+	s.mu.Unlock()
+}
+
+// WithTokenSource makes a client authenticate with tokens from ts instead of
+// a fixed token. A REST request rejected with 401 is retried once with a fresh
+// token; a WebSocket connection fetches a token for every (re)connect.
+func WithTokenSource(ts TokenSource) Option {
+	return func(o *options) { o.tokenSource = ts }
+}
@@ -0,0 +1,162 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rnorth/ha-client/internal/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockAuthServer implements HA's login flow for user "alice" with password
+// "secret" and TOTP code "123456", the token endpoint, and /api/config, which
+// accepts only access tokens it issued. refreshes counts refresh grants.
+func mockAuthServer(t *testing.T, refreshes *int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if r.Header.Get("Content-Type") == "application/json" {
+			_ = json.NewDecoder(r.Body).Decode(&body)
+		}
+		switch {
+		case r.URL.Path == "/auth/login_flow":
+			assert.Equal(t, "https://github.com/rnorth/ha-client", body["client_id"])
+			_ = json.NewEncoder(w).Encode(client.LoginStep{FlowID: "f1", Type: "form", StepID: "init",
+				DataSchema: []client.LoginField{{Name: "username"}, {Name: "password"}}})
+		case r.URL.Path == "/auth/login_flow/f1" && body["password"] != nil:
+			if body["username"] != "alice" || body["password"] != "secret" {
+				_ = json.NewEncoder(w).Encode(client.LoginStep{FlowID: "f1", Type: "form", StepID: "init",
+					Errors: map[string]string{"base": "invalid_auth"}})
+				return
+			}
+			_ = json.NewEncoder(w).Encode(client.LoginStep{FlowID: "f1", Type: "form", StepID: "mfa",
+				DataSchema: []client.LoginField{{Name: "code", Type: "string"}}})
+		case r.URL.Path == "/auth/login_flow/f1":
+			if body["code"] != "123456" {
+				_ = json.NewEncoder(w).Encode(client.LoginStep{FlowID: "f1", Type: "form", StepID: "mfa",
+					Errors: map[string]string{"base": "invalid_code"}})
+				return
+			}
+			_ = json.NewEncoder(w).Encode(client.LoginStep{FlowID: "f1", Type: "create_entry", Result: "auth-code"})
+		case r.URL.Path == "/auth/token":
+			require.NoError(t, r.ParseForm())
+			switch r.PostForm.Get("grant_type") {
+			case "authorization_code":
+				assert.Equal(t, "auth-code", r.PostForm.Get("code"))
+				_ = json.NewEncoder(w).Encode(client.Tokens{AccessToken: "access-0", RefreshToken: "refresh-1", ExpiresIn: 1800})
+			case "refresh_token":
+				if r.PostForm.Get("refresh_token") != "refresh-1" {
+					w.WriteHeader(http.StatusBadRequest)
+					_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+					return
+				}
+				n := atomic.AddInt32(refreshes, 1)
+				_ = json.NewEncoder(w).Encode(client.Tokens{AccessToken: "access-" + string(rune('0'+n)), ExpiresIn: 1800})
+			}
+		case r.URL.Path == "/api/config":
+			if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer access-") {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(client.HAInfo{Version: "2024.1.0"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestLoginWithMFA(t *testing.T) {
+	var refreshes int32
+	srv := mockAuthServer(t, &refreshes)
+	auth := client.NewAuthClient(srv.URL)
+
+	var prompted []string
+	tokens, err := auth.Login(context.Background(), "alice", "secret", func(step *client.LoginStep) (map[string]interface{}, error) {
+		prompted = append(prompted, step.StepID)
+		return map[string]interface{}{"code": "123456"}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mfa"}, prompted)
+	assert.Equal(t, "access-0", tokens.AccessToken)
+	assert.Equal(t, "refresh-1", tokens.RefreshToken)
+}
+
+func TestLoginRejected(t *testing.T) {
+	var refreshes int32
+	srv := mockAuthServer(t, &refreshes)
+	auth := client.NewAuthClient(srv.URL)
+
+	_, err := auth.Login(context.Background(), "alice", "wrong", nil)
+	var apiErr *client.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, client.CodeAuthInvalid, apiErr.Code)
+	assert.Contains(t, err.Error(), "invalid username or password")
+
+	_, err = auth.Login(context.Background(), "alice", "secret", func(*client.LoginStep) (map[string]interface{}, error) {
+		return map[string]interface{}{"code": "000000"}, nil
+	})
+	require.ErrorAs(t, err, &apiErr)
+	assert.Contains(t, err.Error(), "invalid code")
+}
+
+func TestRefreshTokenSource(t *testing.T) {
+	var refreshes int32
+	srv := mockAuthServer(t, &refreshes)
+	ts := client.NewRefreshTokenSource(client.NewAuthClient(srv.URL), "refresh-1")
+	c := client.NewRESTClient(srv.URL, "", client.WithTokenSource(ts))
+
+	_, err := c.GetInfo(context.Background())
+	require.NoError(t, err)
+	_, err = c.GetInfo(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), refreshes, "access token is reused until it expires")
+
+	token, err := ts.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "access-1", token)
+
+	t.Run("revoked refresh token", func(t *testing.T) {
+		ts := client.NewRefreshTokenSource(client.NewAuthClient(srv.URL), "revoked")
+		_, err := client.NewRESTClient(srv.URL, "", client.WithTokenSource(ts)).GetInfo(context.Background())
+		var apiErr *client.APIError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, client.CodeAuthInvalid, apiErr.Code)
+	})
+}
+
+// staleTokenSource hands out an expired token until invalidated.
+type staleTokenSource struct{ invalidated bool }
+
+func (s *staleTokenSource) Token(context.Context) (string, error) {
+	if s.invalidated {
+		return "access-fresh", nil
+	}
+	return "stale", nil
+}
+
+func (s *staleTokenSource) Invalidate() { s.invalidated = true }
+
+func TestTokenSourceRetriesUnauthorized(t *testing.T) {
+	var refreshes int32
+	srv := mockAuthServer(t, &refreshes)
+	ts := &staleTokenSource{}
+
+	info, err := client.NewRESTClient(srv.URL, "", client.WithTokenSource(ts)).GetInfo(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "2024.1.0", info.Version)
+	assert.True(t, ts.invalidated)
+
+	srv2 := mockWSServer(t, "access-fresh", "config/area_registry/list", []client.Area{})
+	defer srv2.Close()
+	wsc, err := client.NewWSClient(context.Background(), wsURL(srv2), "", client.WithTokenSource(ts))
+	require.NoError(t, err, "WebSocket handshake uses the token source")
+	_ = wsc.Close()
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrNotFound is returned when the requested resource does not exist (HTTP 404).
+// Callers can test for it with errors.Is rather than matching error strings.
+var ErrNotFound = errors.New("not found")
+
+// Home Assistant WebSocket error codes (homeassistant.components.websocket_api.const).
+const (
+	CodeNotFound           = "not_found"
+	CodeInvalidFormat      = "invalid_format"
+	CodeUnauthorized       = "unauthorized"
+	CodeHomeAssistantError = "home_assistant_error"
+	// CodeAuthInvalid is not an error code HA sends in a result frame; it stands
+	// for the "auth_invalid" reply to the WebSocket auth handshake.
+	CodeAuthInvalid = "auth_invalid"
+)
+
+// APIError is returned when Home Assistant rejects a request, over either
+// transport. REST errors carry StatusCode and Body; WebSocket errors carry Code
+// and Message. Transport failures (connection refused, timeouts) are not APIErrors.
+type APIError struct {
+	StatusCode int    // HTTP status; 0 for WebSocket errors
+	Code       string // HA WebSocket error code, e.g. "not_found"
+	Message    string // HA's human-readable message, if it sent one
+	Request    string // "GET /api/states/light.desk" or the WebSocket command type
+	Body       string // raw HTTP response body
+
+	RetryAfter time.Duration // the response's Retry-After, if any
+}
+
+func (e *APIError) Error() string {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized:
+		return "unauthorized: check your token"
+	case e.StatusCode != 0:
+		return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Body)
+	case e.Code == CodeAuthInvalid:
+		return "authentication failed: " + e.Message
+	default:
+		return fmt.Sprintf("WS error %s: %s", e.Code, e.Message)
+	}
+}
+
+// Is lets errors.Is(err, ErrNotFound) match a 404 or a not_found result.
+func (e *APIError) Is(target error) bool {
+	return target == ErrNotFound && (e.StatusCode == http.StatusNotFound || e.Code == CodeNotFound)
+}
+
+// newHTTPError builds an APIError from a non-2xx response. HA usually sends a
+// {"message": "..."} body, which is lifted into Message when present.
+func newHTTPError(method, path string, status int, body []byte) *APIError {
+	e := &APIError{StatusCode: status, Request: method + " " + path, Body: string(body)}
+	var parsed struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &parsed) == nil {
+		e.Message = parsed.Message
+	}
+	return e
+}
+
+// newWSError builds an APIError from a failed result frame.
+func newWSError(msgType string, wsErr *WSError) *APIError {
+	e := &APIError{Request: msgType, Code: "unknown_error", Message: "command failed"}
+	if wsErr != nil {
+		e.Code, e.Message = wsErr.Code, wsErr.Message
+	}
+	return e
+}
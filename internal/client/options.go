@@ -0,0 +1,132 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Option configures a client at construction time.
+type Option func(*options)
+
+type options struct {
+	reconnect  bool
+	backoffMin time.Duration
+	backoffMax time.Duration
+
+	tlsConfig *tls.Config
+	proxyURL  *url.URL
+	headers   http.Header
+
+	tokenSource TokenSource
+	tracer      Tracer
+
+	retries      int
+	retryActions bool
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		backoffMin: time.Second,
+		backoffMax: 30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithReconnect makes a WSClient re-establish a dropped connection with
+// exponential backoff instead of failing. After re-authenticating, active
+// subscriptions are replayed under new message IDs and each receives a
+// {"type":"reconnected"} marker event. Commands in flight when the connection
+// dropped still fail, since HA may or may not have acted on them.
+func WithReconnect(enabled bool) Option {
+	return func(o *options) { o.reconnect = enabled }
+}
+
+// WithTLSConfig sets the TLS configuration used for HTTPS and WSS connections,
+// e.g. one built by LoadTLSConfig.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(o *options) { o.tlsConfig = cfg }
+}
+
+// WithProxy sends requests through the given HTTP(S) proxy instead of the one
+// named by the HTTPS_PROXY/HTTP_PROXY environment variables.
+func WithProxy(u *url.URL) Option {
+	return func(o *options) { o.proxyURL = u }
+}
+
+// WithHeaders adds headers to every REST request and to the WebSocket
+// handshake, e.g. service tokens required by an authenticating reverse proxy.
+func WithHeaders(h http.Header) Option {
+	return func(o *options) { o.headers = h }
+}
+
+// LoadTLSConfig builds a TLS configuration that trusts the CA certificates in
+// caFile (in addition to the system roots), presents the client certificate in
+// certFile/keyFile for mutual TLS, and optionally skips server verification.
+// Empty paths are ignored.
+func LoadTLSConfig(caFile, certFile, keyFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading certificate authority: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("client certificate and client key must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+func (o options) proxy() func(*http.Request) (*url.URL, error) {
+	if o.proxyURL != nil {
+		return http.ProxyURL(o.proxyURL)
+	}
+	return http.ProxyFromEnvironment
+}
+
+// httpClient returns the HTTP client REST requests are sent with.
+func (o options) httpClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = o.proxy()
+	if o.tlsConfig != nil {
+		transport.TLSClientConfig = o.tlsConfig
+	}
+	if o.tracer != nil {
+		return &http.Client{Transport: &tracingTransport{base: transport, trace: o.tracer, secrets: o.headers}}
+	}
+	return &http.Client{Transport: transport}
+}
+
+// dialer returns the WebSocket dialer, configured like httpClient so both
+// transports reach the server the same way.
+func (o options) dialer() *websocket.Dialer {
+	d := *websocket.DefaultDialer
+	d.Proxy = o.proxy()
+	d.TLSClientConfig = o.tlsConfig
+	return &d
+}
@@ -0,0 +1,157 @@
+package client_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rnorth/ha-client/internal/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tlsTestServer serves /api/config over REST and /api/websocket over WSS,
+// recording the X-Test header seen by each transport.
+func tlsTestServer(t *testing.T) (*httptest.Server, *sync.Map) {
+	t.Helper()
+	seen := &sync.Map{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/config", func(w http.ResponseWriter, r *http.Request) {
+		seen.Store("rest", r.Header.Get("X-Test"))
+		_ = json.NewEncoder(w).Encode(client.HAInfo{Version: "2024.1.0"})
+	})
+	mux.HandleFunc("/api/websocket", func(w http.ResponseWriter, r *http.Request) {
+		seen.Store("ws", r.Header.Get("X-Test"))
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.WriteJSON(map[string]string{"type": "auth_required"})
+		var auth map[string]string
+		_ = conn.ReadJSON(&auth)
+		_ = conn.WriteJSON(map[string]string{"type": "auth_ok"})
+		var cmd client.WSMessage
+		_ = conn.ReadJSON(&cmd)
+		_ = conn.WriteJSON(map[string]interface{}{"id": cmd.ID, "type": "result", "success": true, "result": []client.Area{}})
+	})
+	srv := httptest.NewUnstartedServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, seen
+}
+
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600))
+	return path
+}
+
+// selfSignedClientCert writes a client certificate and key, returning their
+// paths and a pool that trusts the certificate.
+func selfSignedClientCert(t *testing.T) (certFile, keyFile string, pool *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ha-client test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	pool = x509.NewCertPool()
+	pool.AddCert(cert)
+	return writePEM(t, "client.crt", "CERTIFICATE", der), writePEM(t, "client.key", "EC PRIVATE KEY", keyDER), pool
+}
+
+func TestTLS_CustomCAAndClientCertificate(t *testing.T) {
+	srv, seen := tlsTestServer(t)
+	certFile, keyFile, clientCAs := selfSignedClientCert(t)
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	srv.StartTLS()
+	caFile := writePEM(t, "ca.crt", "CERTIFICATE", srv.Certificate().Raw)
+
+	tlsConfig, err := client.LoadTLSConfig(caFile, certFile, keyFile, false)
+	require.NoError(t, err)
+	headers := http.Header{"X-Test": []string{"yes"}}
+	opts := []client.Option{client.WithTLSConfig(tlsConfig), client.WithHeaders(headers)}
+
+	info, err := client.NewRESTClient(srv.URL, "test-token", opts...).GetInfo(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "2024.1.0", info.Version)
+
+	wsc, err := client.NewWSClient(context.Background(), srv.URL, "test-token", opts...)
+	require.NoError(t, err)
+	defer wsc.Close()
+	_, err = wsc.ListAreas(context.Background())
+	require.NoError(t, err)
+
+	rest, _ := seen.Load("rest")
+	ws, _ := seen.Load("ws")
+	assert.Equal(t, "yes", rest)
+	assert.Equal(t, "yes", ws)
+}
+
+func TestTLS_UntrustedServerFails(t *testing.T) {
+	srv, _ := tlsTestServer(t)
+	srv.StartTLS()
+
+	_, err := client.NewRESTClient(srv.URL, "test-token").GetInfo(context.Background())
+	require.Error(t, err)
+	_, err = client.NewWSClient(context.Background(), srv.URL, "test-token")
+	require.Error(t, err)
+
+	insecure, err := client.LoadTLSConfig("", "", "", true)
+	require.NoError(t, err)
+	_, err = client.NewRESTClient(srv.URL, "test-token", client.WithTLSConfig(insecure)).GetInfo(context.Background())
+	require.NoError(t, err)
+	wsc, err := client.NewWSClient(context.Background(), srv.URL, "test-token", client.WithTLSConfig(insecure))
+	require.NoError(t, err)
+	wsc.Close()
+}
+
+func TestLoadTLSConfig_Errors(t *testing.T) {
+	_, err := client.LoadTLSConfig(filepath.Join(t.TempDir(), "missing.crt"), "", "", false)
+	assert.Error(t, err)
+	certFile, _, _ := selfSignedClientCert(t)
+	_, err = client.LoadTLSConfig("", certFile, "", false)
+	assert.ErrorContains(t, err, "together")
+}
+
+func TestWithProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		_ = json.NewEncoder(w).Encode(client.HAInfo{Version: "via-proxy"})
+	}))
+	defer proxy.Close()
+	u, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+
+	info, err := client.NewRESTClient("http://ha.internal:8123", "test-token", client.WithProxy(u)).GetInfo(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "via-proxy", info.Version)
+	assert.Equal(t, "http://ha.internal:8123/api/config", proxied)
+}
@@ -2,8 +2,8 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,87 +11,111 @@ import (
 	"time"
 )
 
-// ErrNotFound is returned when the requested resource does not exist (HTTP 404).
-// Callers can test for it with errors.Is rather than matching error strings.
-var ErrNotFound = errors.New("not found")
-
 type RESTClient struct {
 	baseURL string
 	token   string
+	opts    options
 	http    *http.Client
 }
 
-func NewRESTClient(serverURL, token string) *RESTClient {
+// NewRESTClient returns a client for the HA REST API. Requests have no fixed
+// timeout; each method's context bounds and cancels it.
+func NewRESTClient(serverURL, token string, opts ...Option) *RESTClient {
 	url := strings.TrimRight(serverURL, "/")
+	o := newOptions(opts)
 	return &RESTClient{
 		baseURL: url,
 		token:   token,
-		http:    &http.Client{Timeout: 30 * time.Second},
+		opts:    o,
+		http:    o.httpClient(),
 	}
 }
 
-func (c *RESTClient) get(path string, out interface{}) error {
-	req, err := http.NewRequest(http.MethodGet, c.baseURL+path, nil)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Authorization", "Bearer "+c.token)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.http.Do(req)
-	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	if resp.StatusCode == http.StatusUnauthorized {
-		return fmt.Errorf("unauthorized: check your token")
-	}
-	if resp.StatusCode == http.StatusNotFound {
-		return ErrNotFound
-	}
-	if resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+// do sends a request and returns the body of a 2xx response. With a token
+// source, a 401 is retried once with a fresh access token. Requests that are
+// idempotent or were never sent, or all requests with WithRetryActions, are
+// retried as set by WithRetries.
+func (c *RESTClient) do(ctx context.Context, method, path string, body []byte, idempotent bool) ([]byte, error) {
+	for attempt := 1; ; attempt++ {
+		data, err := c.attempt(ctx, method, path, body)
+		if err == nil || attempt > c.opts.retries || !retryable(ctx, err) || !(idempotent || c.opts.retryActions || notSent(err)) {
+			return data, err
+		}
+		delay := c.opts.retryDelay(err, attempt)
+		if c.opts.tracer != nil {
+			c.opts.tracer(TraceEvent{Time: time.Now(), Kind: "retry", Method: method, URL: c.baseURL + path,
+				Error: err.Error(), Attempt: attempt, Delay: delay})
+		}
+		if !sleepRetry(ctx, delay) {
+			return nil, err
+		}
 	}
-	return json.NewDecoder(resp.Body).Decode(out)
 }
 
-func (c *RESTClient) postRaw(path string, body interface{}) ([]byte, error) {
-	var bodyReader io.Reader
-	if body != nil {
-		data, err := json.Marshal(body)
+// attempt sends a request once, or twice if the token source's token had
+// expired.
+func (c *RESTClient) attempt(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	for refreshed := false; ; refreshed = true {
+		var bodyReader io.Reader
+		if body != nil {
+			bodyReader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bodyReader)
 		if err != nil {
 			return nil, err
 		}
-		bodyReader = bytes.NewReader(data)
-	}
+		for k, v := range c.opts.headers {
+			req.Header[k] = v
+		}
+		token := c.token
+		if c.opts.tokenSource != nil {
+			if token, err = c.opts.tokenSource.Token(ctx); err != nil {
+				return nil, err
+			}
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
 
-	req, err := http.NewRequest(http.MethodPost, c.baseURL+path, bodyReader)
-	if err != nil {
-		return nil, err
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("request failed: %w", err)
+		}
+		data, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode == http.StatusUnauthorized && c.opts.tokenSource != nil && !refreshed {
+			c.opts.tokenSource.Invalidate()
+			continue
+		}
+		if resp.StatusCode >= 300 {
+			apiErr := newHTTPError(method, path, resp.StatusCode, data)
+			apiErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+			return nil, apiErr
+		}
+		return data, err
 	}
-	req.Header.Set("Authorization", "Bearer "+c.token)
-	req.Header.Set("Content-Type", "application/json")
+}
 
-	resp, err := c.http.Do(req)
+func (c *RESTClient) get(ctx context.Context, path string, out interface{}) error {
+	data, err := c.do(ctx, http.MethodGet, path, nil, true)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+		return err
 	}
-	defer func() { _ = resp.Body.Close() }()
+	return json.Unmarshal(data, out)
+}
 
-	if resp.StatusCode == http.StatusUnauthorized {
-		return nil, fmt.Errorf("unauthorized: check your token")
-	}
-	if resp.StatusCode >= 300 {
-		b, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(b))
+func (c *RESTClient) postRaw(ctx context.Context, path string, body interface{}) ([]byte, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
 	}
-	return io.ReadAll(resp.Body)
+	return c.do(ctx, http.MethodPost, path, data, false)
 }
 
-func (c *RESTClient) post(path string, body interface{}, out interface{}) error {
-	raw, err := c.postRaw(path, body)
+func (c *RESTClient) post(ctx context.Context, path string, body interface{}, out interface{}) error {
+	raw, err := c.postRaw(ctx, path, body)
 	if err != nil {
 		return err
 	}
@@ -101,41 +125,49 @@ func (c *RESTClient) post(path string, body interface{}, out interface{}) error
 	return nil
 }
 
-func (c *RESTClient) GetInfo() (*HAInfo, error) {
+// Ping checks that the API is reachable and the token accepted.
+func (c *RESTClient) Ping(ctx context.Context) error {
+	var out struct {
+		Message string `json:"message"`
+	}
+	return c.get(ctx, "/api/", &out)
+}
+
+func (c *RESTClient) GetInfo(ctx context.Context) (*HAInfo, error) {
 	var info HAInfo
-	return &info, c.get("/api/config", &info)
+	return &info, c.get(ctx, "/api/config", &info)
 }
 
-func (c *RESTClient) ListStates() ([]State, error) {
+func (c *RESTClient) ListStates(ctx context.Context) ([]State, error) {
 	var states []State
-	return states, c.get("/api/states", &states)
+	return states, c.get(ctx, "/api/states", &states)
 }
 
-func (c *RESTClient) GetState(entityID string) (*State, error) {
+func (c *RESTClient) GetState(ctx context.Context, entityID string) (*State, error) {
 	var state State
-	return &state, c.get("/api/states/"+entityID, &state)
+	return &state, c.get(ctx, "/api/states/"+entityID, &state)
 }
 
-func (c *RESTClient) SetState(entityID, state string, attributes map[string]interface{}) (*State, error) {
+func (c *RESTClient) SetState(ctx context.Context, entityID, state string, attributes map[string]interface{}) (*State, error) {
 	body := map[string]interface{}{"state": state}
 	if attributes != nil {
 		body["attributes"] = attributes
 	}
 	var result State
-	return &result, c.post("/api/states/"+entityID, body, &result)
+	return &result, c.post(ctx, "/api/states/"+entityID, body, &result)
 }
 
-func (c *RESTClient) ListActions() ([]ActionDomain, error) {
+func (c *RESTClient) ListActions(ctx context.Context) ([]ActionDomain, error) {
 	var actions []ActionDomain
-	return actions, c.get("/api/services", &actions)
+	return actions, c.get(ctx, "/api/services", &actions)
 }
 
-func (c *RESTClient) CallAction(domain, action string, data map[string]interface{}, returnResponse bool) (*ActionResponse, error) {
+func (c *RESTClient) CallAction(ctx context.Context, domain, action string, data map[string]interface{}, returnResponse bool) (*ActionResponse, error) {
 	path := "/api/services/" + domain + "/" + action
 	if returnResponse {
 		path += "?return_response"
 	}
-	raw, err := c.postRaw(path, data)
+	raw, err := c.postRaw(ctx, path, data)
 	if err != nil {
 		return nil, err
 	}
@@ -153,19 +185,23 @@ func (c *RESTClient) CallAction(domain, action string, data map[string]interface
 }
 
 // GetAutomationConfig fetches the automation config for the given storage ID (the "id" field in the automation YAML, e.g. "abc-123"), not the entity ID.
-func (c *RESTClient) GetAutomationConfig(automationID string) (map[string]interface{}, error) {
+func (c *RESTClient) GetAutomationConfig(ctx context.Context, automationID string) (map[string]interface{}, error) {
 	var cfg map[string]interface{}
-	return cfg, c.get("/api/config/automation/config/"+automationID, &cfg)
+	return cfg, c.get(ctx, "/api/config/automation/config/"+automationID, &cfg)
 }
 
-func (c *RESTClient) SaveAutomationConfig(automationID string, cfg map[string]interface{}) error {
-	return c.post("/api/config/automation/config/"+automationID, cfg, nil)
+func (c *RESTClient) SaveAutomationConfig(ctx context.Context, automationID string, cfg map[string]interface{}) error {
+	return c.post(ctx, "/api/config/automation/config/"+automationID, cfg, nil)
 }
 
 // RenderTemplate evaluates a Jinja template server-side via POST /api/template.
-func (c *RESTClient) RenderTemplate(template string) (string, error) {
-	body := map[string]string{"template": template}
-	raw, err := c.postRaw("/api/template", body)
+func (c *RESTClient) RenderTemplate(ctx context.Context, template string) (string, error) {
+	body, err := json.Marshal(map[string]string{"template": template})
+	if err != nil {
+		return "", err
+	}
+	// Rendering has no side effects, so it is retried like a GET.
+	raw, err := c.do(ctx, http.MethodPost, "/api/template", body, true)
 	if err != nil {
 		return "", err
 	}
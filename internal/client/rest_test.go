@@ -1,10 +1,12 @@
 package client_test
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/rnorth/ha-client/internal/client"
 	"github.com/stretchr/testify/assert"
@@ -25,7 +27,7 @@ func TestGetInfo(t *testing.T) {
 		_ = json.NewEncoder(w).Encode(client.HAInfo{Version: "2024.1.0", LocationName: "Home"})
 	})
 
-	info, err := c.GetInfo()
+	info, err := c.GetInfo(context.Background())
 	require.NoError(t, err)
 	assert.Equal(t, "2024.1.0", info.Version)
 	assert.Equal(t, "Home", info.LocationName)
@@ -40,7 +42,7 @@ func TestListStates(t *testing.T) {
 		})
 	})
 
-	states, err := c.ListStates()
+	states, err := c.ListStates(context.Background())
 	require.NoError(t, err)
 	assert.Len(t, states, 2)
 	assert.Equal(t, "light.desk", states[0].EntityID)
@@ -52,7 +54,7 @@ func TestGetState(t *testing.T) {
 		_ = json.NewEncoder(w).Encode(client.State{EntityID: "light.desk", State: "on"})
 	})
 
-	state, err := c.GetState("light.desk")
+	state, err := c.GetState(context.Background(), "light.desk")
 	require.NoError(t, err)
 	assert.Equal(t, "on", state.State)
 }
@@ -65,7 +67,7 @@ func TestSetState(t *testing.T) {
 		_ = json.NewEncoder(w).Encode(client.State{EntityID: "light.desk", State: "off"})
 	})
 
-	state, err := c.SetState("light.desk", "off", nil)
+	state, err := c.SetState(context.Background(), "light.desk", "off", nil)
 	require.NoError(t, err)
 	assert.Equal(t, "off", state.State)
 }
@@ -76,7 +78,7 @@ func TestListActions(t *testing.T) {
 		_ = json.NewEncoder(w).Encode([]client.ActionDomain{{Domain: "light"}})
 	})
 
-	actions, err := c.ListActions()
+	actions, err := c.ListActions(context.Background())
 	require.NoError(t, err)
 	assert.Len(t, actions, 1)
 	assert.Equal(t, "light", actions[0].Domain)
@@ -93,7 +95,7 @@ func TestCallAction(t *testing.T) {
 		})
 	})
 
-	resp, err := c.CallAction("light", "turn_on", map[string]interface{}{"entity_id": "light.desk"}, false)
+	resp, err := c.CallAction(context.Background(), "light", "turn_on", map[string]interface{}{"entity_id": "light.desk"}, false)
 	require.NoError(t, err)
 	assert.Len(t, resp.ChangedStates, 1)
 	assert.Equal(t, "light.desk", resp.ChangedStates[0].EntityID)
@@ -112,7 +114,7 @@ func TestCallAction_ReturnResponse(t *testing.T) {
 		})
 	})
 
-	resp, err := c.CallAction("weather", "get_forecasts", map[string]interface{}{"entity_id": "weather.home"}, true)
+	resp, err := c.CallAction(context.Background(), "weather", "get_forecasts", map[string]interface{}{"entity_id": "weather.home"}, true)
 	require.NoError(t, err)
 	assert.Empty(t, resp.ChangedStates)
 	assert.NotNil(t, resp.ServiceResponse)
@@ -126,7 +128,7 @@ func TestGetAutomationConfig(t *testing.T) {
 		_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": "abc-123", "alias": "Morning routine"})
 	})
 
-	cfg, err := c.GetAutomationConfig("abc-123")
+	cfg, err := c.GetAutomationConfig(context.Background(), "abc-123")
 	require.NoError(t, err)
 	assert.Equal(t, "Morning routine", cfg["alias"])
 }
@@ -141,6 +143,36 @@ func TestSaveAutomationConfig(t *testing.T) {
 		w.WriteHeader(http.StatusOK)
 	})
 
-	err := c.SaveAutomationConfig("abc-123", map[string]interface{}{"id": "abc-123", "alias": "Morning routine"})
+	err := c.SaveAutomationConfig(context.Background(), "abc-123", map[string]interface{}{"id": "abc-123", "alias": "Morning routine"})
 	require.NoError(t, err)
 }
+
+func TestRESTClient_ContextDeadline(t *testing.T) {
+	release := make(chan struct{})
+	_, c := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := c.ListStates(ctx)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRESTClient_APIError(t *testing.T) {
+	_, c := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message":"Entity not found."}`))
+	})
+
+	_, err := c.GetState(context.Background(), "light.nope")
+	require.Error(t, err)
+	var apiErr *client.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	assert.Equal(t, "GET /api/states/light.nope", apiErr.Request)
+	assert.Equal(t, "Entity not found.", apiErr.Message)
+	assert.ErrorIs(t, err, client.ErrNotFound)
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// WithRetries makes a RESTClient retry a failed GET up to n times: after a
+// connection error, or a 429, 502, 503 or 504 (Home Assistant restarting or a
+// proxy in front of it). Other requests are only retried when no connection
+// could be made, unless WithRetryActions is also given, since an action may
+// already have run.
+func WithRetries(n int) Option {
+	return func(o *options) { o.retries = n }
+}
+
+// WithRetryActions extends WithRetries to POST requests such as action calls.
+func WithRetryActions(enabled bool) Option {
+	return func(o *options) { o.retryActions = enabled }
+}
+
+// retryBackoff is the delay before the first retry; it doubles per attempt up
+// to backoffMax.
+const retryBackoff = 500 * time.Millisecond
+
+// retryable reports whether a failed attempt may succeed if repeated: a
+// connection error or timeout, or a status that means Home Assistant or a
+// proxy is briefly unavailable. Other failures, such as a certificate that
+// does not verify or a rejected refresh token, would fail again.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	// *url.Error is a net.Error itself, so only its Timeout is telling.
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	// The connection was dropped mid-response, e.g. by a restart.
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// notSent reports whether a request failed before any of it reached the
+// server, because no connection could be made, so that even an action call
+// is safe to repeat.
+func notSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && (opErr.Op == "dial" || opErr.Op == "proxyconnect")
+}
+
+// retryDelay is how long to wait before retry number attempt (from 1). It is
+// the server's Retry-After if it sent one, otherwise an exponential backoff
+// with jitter, so that many clients do not retry in lockstep.
+func (o options) retryDelay(err error, attempt int) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return apiErr.RetryAfter
+	}
+	d := retryBackoff << (attempt - 1)
+	if d <= 0 || d > o.backoffMax {
+		d = o.backoffMax
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// sleepRetry waits d, or returns false if ctx ends first or would end before
+// the retry could be made.
+func sleepRetry(ctx context.Context, d time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return false
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
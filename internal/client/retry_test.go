@@ -0,0 +1,144 @@
+package client_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rnorth/ha-client/internal/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyServer fails the first n requests with status, then answers "[]".
+func flakyServer(t *testing.T, n int32, status int, retryAfter string) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= n {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(status)
+			return
+		}
+		_, _ = w.Write([]byte("[]"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestRetriesGET(t *testing.T) {
+	srv, calls := flakyServer(t, 2, http.StatusServiceUnavailable, "")
+	rec := &recorder{}
+	c := client.NewRESTClient(srv.URL, "test-token", client.WithRetries(2), client.WithTracer(rec.trace))
+
+	_, err := c.ListStates(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), *calls)
+
+	var retries []client.TraceEvent
+	for _, e := range rec.all() {
+		if e.Kind == "retry" {
+			retries = append(retries, e)
+		}
+	}
+	require.Len(t, retries, 2)
+	assert.Equal(t, 1, retries[0].Attempt)
+	assert.Contains(t, retries[0].Error, "503")
+	assert.Positive(t, retries[0].Delay)
+
+	t.Run("gives up after the last retry", func(t *testing.T) {
+		srv, calls := flakyServer(t, 5, http.StatusBadGateway, "")
+		_, err := client.NewRESTClient(srv.URL, "test-token", client.WithRetries(1)).ListStates(context.Background())
+		assert.ErrorContains(t, err, "HTTP 502")
+		assert.Equal(t, int32(2), *calls)
+	})
+
+	t.Run("server errors are not retried", func(t *testing.T) {
+		srv, calls := flakyServer(t, 1, http.StatusInternalServerError, "")
+		_, err := client.NewRESTClient(srv.URL, "test-token", client.WithRetries(3)).ListStates(context.Background())
+		require.Error(t, err)
+		assert.Equal(t, int32(1), *calls)
+	})
+}
+
+func TestRetriesHonourRetryAfter(t *testing.T) {
+	srv, calls := flakyServer(t, 1, http.StatusTooManyRequests, "1")
+	c := client.NewRESTClient(srv.URL, "test-token", client.WithRetries(1))
+
+	start := time.Now()
+	_, err := c.ListStates(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), *calls)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+
+	t.Run("not beyond the deadline", func(t *testing.T) {
+		srv, calls := flakyServer(t, 1, http.StatusServiceUnavailable, "60")
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err := client.NewRESTClient(srv.URL, "test-token", client.WithRetries(1)).ListStates(ctx)
+		assert.ErrorContains(t, err, "HTTP 503")
+		assert.Equal(t, int32(1), *calls)
+	})
+}
+
+func TestRetriesActions(t *testing.T) {
+	srv, calls := flakyServer(t, 1, http.StatusServiceUnavailable, "")
+	_, err := client.NewRESTClient(srv.URL, "test-token", client.WithRetries(2)).
+		CallAction(context.Background(), "light", "turn_on", nil, false)
+	require.Error(t, err, "actions are not retried by default")
+	assert.Equal(t, int32(1), *calls)
+
+	srv, calls = flakyServer(t, 1, http.StatusServiceUnavailable, "")
+	_, err = client.NewRESTClient(srv.URL, "test-token", client.WithRetries(2), client.WithRetryActions(true)).
+		CallAction(context.Background(), "light", "turn_on", nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), *calls)
+}
+
+func TestRetriesConnectionError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	rec := &recorder{}
+	_, err := client.NewRESTClient(url, "test-token", client.WithRetries(1), client.WithTracer(rec.trace)).
+		ListStates(context.Background())
+	require.Error(t, err)
+	var kinds []string
+	for _, e := range rec.all() {
+		kinds = append(kinds, e.Kind)
+	}
+	assert.Equal(t, []string{"http", "retry", "http"}, kinds)
+}
+
+func TestRetriesActionsWhenNotSent(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	rec := &recorder{}
+	_, err := client.NewRESTClient(url, "test-token", client.WithRetries(1), client.WithTracer(rec.trace)).
+		CallAction(context.Background(), "light", "turn_on", nil, false)
+	require.Error(t, err)
+	var kinds []string
+	for _, e := range rec.all() {
+		kinds = append(kinds, e.Kind)
+	}
+	assert.Equal(t, []string{"http", "retry", "http"}, kinds, "a refused connection sent nothing, so it is retried")
+}
+
+func TestRetriesSkipTLSErrors(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	rec := &recorder{}
+	_, err := client.NewRESTClient(srv.URL, "test-token", client.WithRetries(2), client.WithTracer(rec.trace)).
+		ListStates(context.Background())
+	require.Error(t, err)
+	assert.Len(t, rec.all(), 1, "an untrusted certificate is not retried")
+}
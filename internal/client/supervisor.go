@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// SupervisorURL is where the Supervisor API is reachable from inside an add-on.
+const SupervisorURL = "http://supervisor"
+
+// SupervisorClient talks to the Home Assistant Supervisor API, which manages
+// add-ons, backups and the host on Home Assistant OS and Supervised installs.
+// It is only reachable from inside an add-on, using SUPERVISOR_TOKEN.
+type SupervisorClient struct {
+	rest *RESTClient
+}
+
+func NewSupervisorClient(serverURL, token string, opts ...Option) *SupervisorClient {
+	return &SupervisorClient{rest: NewRESTClient(serverURL, token, opts...)}
+}
+
+// supervisorResponse is the envelope every Supervisor endpoint replies with.
+type supervisorResponse struct {
+	Result  string          `json:"result"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+func (c *SupervisorClient) get(ctx context.Context, path string, out interface{}) error {
+	var resp supervisorResponse
+	if err := c.rest.get(ctx, path, &resp); err != nil {
+		return err
+	}
+	return resp.decode(path, out)
+}
+
+func (c *SupervisorClient) post(ctx context.Context, path string, body interface{}, out interface{}) error {
+	var resp supervisorResponse
+	if err := c.rest.post(ctx, path, body, &resp); err != nil {
+		return err
+	}
+	return resp.decode(path, out)
+}
+
+func (r *supervisorResponse) decode(path string, out interface{}) error {
+	if r.Result != "ok" {
+		return fmt.Errorf("supervisor %s: %s", path, r.Message)
+	}
+	if out == nil || len(r.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(r.Data, out)
+}
+
+func (c *SupervisorClient) Info(ctx context.Context) (*SupervisorInfo, error) {
+	var info SupervisorInfo
+	return &info, c.get(ctx, "/supervisor/info", &info)
+}
+
+func (c *SupervisorClient) ListAddons(ctx context.Context) ([]Addon, error) {
+	var data struct {
+		Addons []Addon `json:"addons"`
+	}
+	return data.Addons, c.get(ctx, "/addons", &data)
+}
+
+func (c *SupervisorClient) GetAddon(ctx context.Context, slug string) (*AddonInfo, error) {
+	var info AddonInfo
+	return &info, c.get(ctx, "/addons/"+slug+"/info", &info)
+}
+
+// AddonAction runs a lifecycle action ("start", "stop", "restart") on an add-on.
+func (c *SupervisorClient) AddonAction(ctx context.Context, slug, action string) error {
+	return c.post(ctx, "/addons/"+slug+"/"+action, nil, nil)
+}
+
+func (c *SupervisorClient) ListBackups(ctx context.Context) ([]Backup, error) {
+	var data struct {
+		Backups []Backup `json:"backups"`
+	}
+	return data.Backups, c.get(ctx, "/backups", &data)
+}
+
+// NewFullBackup creates a full backup and returns its slug. The Supervisor
+// replies only once the backup is complete, which can take several minutes.
+func (c *SupervisorClient) NewFullBackup(ctx context.Context, name string) (string, error) {
+	body := map[string]interface{}{}
+	if name != "" {
+		body["name"] = name
+	}
+	var data struct {
+		Slug string `json:"slug"`
+	}
+	return data.Slug, c.post(ctx, "/backups/new/full", body, &data)
+}
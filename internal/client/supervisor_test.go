@@ -0,0 +1,60 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rnorth/ha-client/internal/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSupervisorServer(t *testing.T, handler http.HandlerFunc) *client.SupervisorClient {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return client.NewSupervisorClient(srv.URL, "supervisor-token")
+}
+
+func TestSupervisor_ListAddons(t *testing.T) {
+	sc := newSupervisorServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/addons", r.URL.Path)
+		assert.Equal(t, "Bearer supervisor-token", r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`{"result":"ok","data":{"addons":[{"slug":"core_ssh","name":"Terminal & SSH","state":"started"}]}}`))
+	})
+
+	addons, err := sc.ListAddons(context.Background())
+	require.NoError(t, err)
+	require.Len(t, addons, 1)
+	assert.Equal(t, "core_ssh", addons[0].Slug)
+	assert.Equal(t, "started", addons[0].State)
+}
+
+func TestSupervisor_NewFullBackup(t *testing.T) {
+	sc := newSupervisorServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/backups/new/full", r.URL.Path)
+		_, _ = w.Write([]byte(`{"result":"ok","data":{"slug":"abc123"}}`))
+	})
+
+	slug, err := sc.NewFullBackup(context.Background(), "nightly")
+	require.NoError(t, err)
+	assert.Equal(t, "abc123", slug)
+}
+
+func TestSupervisor_ErrorResult(t *testing.T) {
+	sc := newSupervisorServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"result":"error","message":"Addon is not installed"}`))
+	})
+
+	err := sc.AddonAction(context.Background(), "nope", "restart")
+	var apiErr *client.APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Equal(t, "Addon is not installed", apiErr.Message)
+	assert.Equal(t, "POST /addons/nope/restart", apiErr.Request)
+}
@@ -0,0 +1,247 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TraceEvent describes one HTTP exchange or one WebSocket frame. Credentials
+// are redacted before an event is handed to a Tracer, so events are safe to
+// log or attach to bug reports.
+type TraceEvent struct {
+	Time time.Time `json:"time"`
+	Kind string    `json:"kind"` // "http", "retry" or "ws"
+
+	// HTTP exchanges.
+	Method          string        `json:"method,omitempty"`
+	URL             string        `json:"url"`
+	Status          int           `json:"status,omitempty"`
+	Latency         time.Duration `json:"-"`
+	RequestHeaders  http.Header   `json:"request_headers,omitempty"`
+	RequestBody     string        `json:"request_body,omitempty"`
+	ResponseHeaders http.Header   `json:"response_headers,omitempty"`
+	ResponseBody    string        `json:"response_body,omitempty"`
+	Error           string        `json:"error,omitempty"`
+
+	// Retries of a failed HTTP request: the attempt that failed, and the wait
+	// before the next one.
+	Attempt int           `json:"attempt,omitempty"`
+	Delay   time.Duration `json:"-"`
+
+	// WebSocket frames. Direction is "send" or "recv".
+	Direction   string `json:"direction,omitempty"`
+	MessageID   int    `json:"message_id,omitempty"`
+	MessageType string `json:"message_type,omitempty"`
+	Frame       string `json:"frame,omitempty"`
+}
+
+// Tracer receives every traced event. It may be called concurrently.
+type Tracer func(TraceEvent)
+
+// WithTracer reports every HTTP request and WebSocket frame to t.
+func WithTracer(t Tracer) Option {
+	return func(o *options) { o.tracer = t }
+}
+
+// tracingTransport reports each round trip, with bodies, to a Tracer.
+// Headers the user configured (see WithHeaders) are masked along with the
+// usual credential headers, since they are typically service tokens.
+type tracingTransport struct {
+	base    http.RoundTripper
+	trace   Tracer
+	secrets http.Header
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	e := TraceEvent{
+		Time:           time.Now(),
+		Kind:           "http",
+		Method:         req.Method,
+		URL:            req.URL.String(),
+		RequestHeaders: redactHeaders(req.Header, t.secrets),
+	}
+	auth := isAuthPath(req.URL.Path)
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			data, _ := io.ReadAll(body)
+			e.RequestBody = redactBody(data, req.Header.Get("Content-Type"), auth)
+		}
+	}
+	resp, err := t.base.RoundTrip(req)
+	e.Latency = time.Since(e.Time)
+	if err != nil {
+		e.Error = err.Error()
+		t.trace(e)
+		return nil, err
+	}
+	data, readErr := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	if readErr != nil {
+		// Hand the failure to the caller when it reads the body.
+		resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(data), errReader{readErr}))
+	}
+	e.Status = resp.StatusCode
+	e.ResponseHeaders = redactHeaders(resp.Header, t.secrets)
+	e.ResponseBody = redactBody(data, resp.Header.Get("Content-Type"), auth)
+	t.trace(e)
+	return resp, nil
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+// readFrame reads one WebSocket frame into v, tracing it if enabled.
+func (o options) readFrame(conn *websocket.Conn, url string, v interface{}) error {
+	if o.tracer == nil {
+		return conn.ReadJSON(v)
+	}
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return err
+	}
+	o.traceFrame(url, "recv", data)
+	return json.Unmarshal(data, v)
+}
+
+// writeFrame writes v as one WebSocket frame, tracing it if enabled.
+func (o options) writeFrame(conn *websocket.Conn, url string, v interface{}) error {
+	if o.tracer == nil {
+		return conn.WriteJSON(v)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	o.traceFrame(url, "send", data)
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (o options) traceFrame(url, direction string, data []byte) {
+	var head struct {
+		ID   int    `json:"id"`
+		Type string `json:"type"`
+	}
+	_ = json.Unmarshal(data, &head)
+	o.tracer(TraceEvent{
+		Time:        time.Now(),
+		Kind:        "ws",
+		URL:         url,
+		Direction:   direction,
+		MessageID:   head.ID,
+		MessageType: head.Type,
+		Frame:       redactBody(data, "application/json", false),
+	})
+}
+
+// redacted replaces secrets in traces.
+const redacted = "[REDACTED]"
+
+// secretFields are JSON keys and form fields whose values are credentials.
+// The audit log masks the same fields.
+var secretFields = map[string]bool{"access_token": true, "refresh_token": true, "password": true, "token": true}
+
+// authFields are also secret in the payloads of the login flow and the token
+// endpoint: the MFA code, and the authorization code a finished flow returns
+// and the client exchanges. Elsewhere "code" is usually an error code.
+var authFields = map[string]bool{"code": true, "result": true}
+
+// isAuthPath reports whether an HTTP request is to the login flow or token
+// endpoints (see AuthClient).
+func isAuthPath(path string) bool {
+	return strings.Contains(path, "/auth/")
+}
+
+// IsSecretField reports whether a payload field holds a secret that must not
+// be traced or logged.
+func IsSecretField(name string) bool {
+	return secretFields[name]
+}
+
+// sensitiveHeaders are headers whose values are credentials. For the
+// authorization headers the scheme is kept, as it helps when debugging.
+var sensitiveHeaders = map[string]bool{"Authorization": true, "Proxy-Authorization": true, "Cookie": true, "Set-Cookie": true}
+
+// redactHeaders returns h with the values of sensitive headers, and of the
+// headers named in secrets, masked.
+func redactHeaders(h, secrets http.Header) http.Header {
+	if len(h) == 0 {
+		return nil
+	}
+	out := h.Clone()
+	for k, values := range out {
+		if _, secret := secrets[k]; !sensitiveHeaders[k] && !secret {
+			continue
+		}
+		for i, v := range values {
+			if scheme, _, ok := strings.Cut(v, " "); ok && strings.HasSuffix(k, "Authorization") {
+				values[i] = scheme + " " + redacted
+			} else {
+				values[i] = redacted
+			}
+		}
+	}
+	return out
+}
+
+// redactBody returns body as a string with credentials masked. auth is whether
+// body belongs to the login flow, where authFields are masked too.
+func redactBody(body []byte, contentType string, auth bool) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return redacted
+		}
+		for k := range form {
+			if secretFields[k] || auth && authFields[k] {
+				form.Set(k, redacted)
+			}
+		}
+		return form.Encode()
+	}
+	var v interface{}
+	if json.Unmarshal(body, &v) != nil {
+		return string(body)
+	}
+	data, err := json.Marshal(redactJSON(v, auth))
+	if err != nil {
+		return string(body)
+	}
+	return string(data)
+}
+
+// redactJSON masks secret fields in v, and authFields too if auth is set.
+func redactJSON(v interface{}, auth bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			if secretFields[k] || auth && authFields[k] {
+				v[k] = redacted
+			} else {
+				v[k] = redactJSON(val, auth)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactJSON(v[i], auth)
+		}
+	case string:
+		// Access tokens are JWTs; this also catches a new long-lived token,
+		// which is returned as a bare result string.
+		if strings.HasPrefix(v, "eyJ") && strings.Count(v, ".") == 2 {
+			return redacted
+		}
+	}
+	return v
+}
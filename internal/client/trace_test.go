@@ -0,0 +1,165 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rnorth/ha-client/internal/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder collects trace events; WebSocket frames arrive from the read loop.
+type recorder struct {
+	mu     sync.Mutex
+	events []client.TraceEvent
+}
+
+func (r *recorder) trace(e client.TraceEvent) {
+	r.mu.Lock()
+	r.events = append(r.events, e)
+	r.mu.Unlock()
+}
+
+func (r *recorder) all() []client.TraceEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]client.TraceEvent(nil), r.events...)
+}
+
+func TestTraceREST(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"entity_id":"camera.door","attributes":{"access_token":"cam-secret"}}]`))
+	}))
+	defer srv.Close()
+	rec := &recorder{}
+	c := client.NewRESTClient(srv.URL, "secret-token", client.WithTracer(rec.trace))
+
+	_, err := c.CallAction(context.Background(), "light", "turn_on", map[string]interface{}{"entity_id": "light.desk"}, false)
+	require.NoError(t, err)
+
+	events := rec.all()
+	require.Len(t, events, 1)
+	e := events[0]
+	assert.Equal(t, "http", e.Kind)
+	assert.Equal(t, http.MethodPost, e.Method)
+	assert.Equal(t, srv.URL+"/api/services/light/turn_on", e.URL)
+	assert.Equal(t, http.StatusOK, e.Status)
+	assert.Positive(t, e.Latency)
+	assert.Equal(t, "Bearer [REDACTED]", e.RequestHeaders.Get("Authorization"))
+	assert.JSONEq(t, `{"entity_id":"light.desk"}`, e.RequestBody)
+	assert.Contains(t, e.ResponseBody, `"access_token":"[REDACTED]"`)
+	assert.NotContains(t, e.ResponseBody, "cam-secret")
+}
+
+func TestTraceHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "cookie-secret"})
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+	rec := &recorder{}
+	headers := http.Header{}
+	headers.Set("CF-Access-Client-Secret", "cf-secret")
+	headers.Set("Cookie", "session=cookie-secret")
+	headers.Set("Proxy-Authorization", "Basic cHJveHk6c2VjcmV0")
+	headers.Set("X-Request-Source", "ha-client")
+	c := client.NewRESTClient(srv.URL, "secret-token", client.WithHeaders(headers), client.WithTracer(rec.trace))
+
+	_, err := c.ListStates(context.Background())
+	require.NoError(t, err)
+
+	e := rec.all()[0]
+	assert.Equal(t, "[REDACTED]", e.RequestHeaders.Get("CF-Access-Client-Secret"))
+	assert.Equal(t, "[REDACTED]", e.RequestHeaders.Get("Cookie"))
+	assert.Equal(t, "Basic [REDACTED]", e.RequestHeaders.Get("Proxy-Authorization"))
+	assert.Equal(t, "[REDACTED]", e.ResponseHeaders.Get("Set-Cookie"))
+	assert.Equal(t, "[REDACTED]", e.RequestHeaders.Get("X-Request-Source"), "every configured header is masked")
+	assert.Equal(t, "application/json", e.RequestHeaders.Get("Content-Type"))
+	data, _ := json.Marshal(e)
+	assert.NotContains(t, string(data), "secret")
+}
+
+func TestTraceTokenForm(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(client.Tokens{AccessToken: "eyJhbGciOi.eyJpc3Mi.c2lnbmF0dXJl", ExpiresIn: 1800})
+	}))
+	defer srv.Close()
+	rec := &recorder{}
+
+	_, err := client.NewAuthClient(srv.URL, client.WithTracer(rec.trace)).Refresh(context.Background(), "refresh-secret")
+	require.NoError(t, err)
+
+	e := rec.all()[0]
+	assert.Contains(t, e.RequestBody, "refresh_token=%5BREDACTED%5D")
+	assert.NotContains(t, e.RequestBody, "refresh-secret")
+	assert.NotContains(t, e.ResponseBody, "eyJ")
+}
+
+func TestTraceWebSocket(t *testing.T) {
+	srv := mockWSServer(t, "test-token", "auth/long_lived_access_token", "eyJhbGciOi.eyJpc3Mi.c2lnbmF0dXJl")
+	defer srv.Close()
+	rec := &recorder{}
+
+	wsc, err := client.NewWSClient(context.Background(), wsURL(srv), "test-token", client.WithTracer(rec.trace))
+	require.NoError(t, err)
+	_, err = wsc.CreateLongLivedToken(context.Background(), "ci", 365)
+	require.NoError(t, err)
+	require.NoError(t, wsc.Close())
+
+	var frames []string
+	for _, e := range rec.all() {
+		assert.Equal(t, "ws", e.Kind)
+		assert.NotContains(t, e.Frame, "test-token")
+		assert.NotContains(t, e.Frame, "eyJ")
+		frames = append(frames, e.Direction+" "+e.MessageType)
+	}
+	assert.Equal(t, "recv auth_required,send auth,recv auth_ok,send auth/long_lived_access_token,recv result", strings.Join(frames, ","))
+}
+
+func TestTraceLoginCode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/auth/login_flow":
+			_, _ = w.Write([]byte(`{"type":"form","flow_id":"f1","step_id":"init"}`))
+		case "/auth/login_flow/f1":
+			_, _ = w.Write([]byte(`{"type":"create_entry","flow_id":"f1","result":"auth-code-secret"}`))
+		case "/auth/token":
+			_ = json.NewEncoder(w).Encode(client.Tokens{AccessToken: "access"})
+		}
+	}))
+	defer srv.Close()
+	rec := &recorder{}
+
+	_, err := client.NewAuthClient(srv.URL, client.WithTracer(rec.trace)).Login(context.Background(), "ada", "pw-secret", nil)
+	require.NoError(t, err)
+
+	events := rec.all()
+	require.Len(t, events, 3)
+	assert.Contains(t, events[1].RequestBody, `"password":"[REDACTED]"`)
+	assert.Contains(t, events[1].ResponseBody, `"result":"[REDACTED]"`)
+	assert.Contains(t, events[2].RequestBody, "code=%5BREDACTED%5D")
+	for _, e := range events {
+		assert.NotContains(t, e.RequestBody+e.ResponseBody, "secret")
+	}
+}
+
+func TestTraceJSONCode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":{"code":"invalid_code","message":"bad code"},"code":400}`))
+	}))
+	defer srv.Close()
+	rec := &recorder{}
+	c := client.NewRESTClient(srv.URL, "test-token", client.WithTracer(rec.trace))
+
+	_, _ = c.ListStates(context.Background())
+
+	e := rec.all()[0]
+	assert.JSONEq(t, `{"error":{"code":"invalid_code","message":"bad code"},"code":400}`, e.ResponseBody, "codes outside the login flow are kept")
+}
@@ -36,12 +36,26 @@ type ActionDetail struct {
 	Name        string                 `json:"name"`
 	Description string                 `json:"description"`
 	Fields      map[string]interface{} `json:"fields"`
+	Target      map[string]interface{} `json:"target,omitempty"`
 }
 
 type Area struct {
-	AreaID  string `json:"area_id" yaml:"area_id"`
+	AreaID  string   `json:"area_id" yaml:"area_id"`
+	Name    string   `json:"name" yaml:"name"`
+	Picture string   `json:"picture,omitempty" yaml:"picture,omitempty"`
+	FloorID string   `json:"floor_id,omitempty" yaml:"floor_id,omitempty"`
+	Labels  []string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+type Floor struct {
+	FloorID string `json:"floor_id" yaml:"floor_id"`
+	Name    string `json:"name" yaml:"name"`
+	Level   *int   `json:"level,omitempty" yaml:"level,omitempty"`
+}
+
+type Label struct {
+	LabelID string `json:"label_id" yaml:"label_id"`
 	Name    string `json:"name" yaml:"name"`
-	Picture string `json:"picture,omitempty" yaml:"picture,omitempty"`
 }
 
 type Device struct {
@@ -51,18 +65,24 @@ type Device struct {
 	Manufacturer  string   `json:"manufacturer,omitempty" yaml:"manufacturer,omitempty"`
 	Model         string   `json:"model,omitempty" yaml:"model,omitempty"`
 	ConfigEntries []string `json:"config_entries,omitempty" yaml:"config_entries,omitempty"`
+	Labels        []string `json:"labels,omitempty" yaml:"labels,omitempty"`
 }
 
 type EntityEntry struct {
-	EntityID   string  `json:"entity_id" yaml:"entity_id"`
-	Name       string  `json:"name,omitempty" yaml:"name,omitempty"`
-	AreaID     string  `json:"area_id,omitempty" yaml:"area_id,omitempty"`
-	DeviceID   string  `json:"device_id,omitempty" yaml:"device_id,omitempty"`
-	Platform   string  `json:"platform,omitempty" yaml:"platform,omitempty"`
+	EntityID string `json:"entity_id" yaml:"entity_id"`
+	Name     string `json:"name,omitempty" yaml:"name,omitempty"`
+	AreaID   string `json:"area_id,omitempty" yaml:"area_id,omitempty"`
+	DeviceID string `json:"device_id,omitempty" yaml:"device_id,omitempty"`
+	Platform string `json:"platform,omitempty" yaml:"platform,omitempty"`
 	// DisabledBy is nil when the entity is enabled. A non-nil value names the
 	// source that disabled it (e.g. "user", "integration", "config_entry").
 	DisabledBy *string `json:"disabled_by,omitempty" yaml:"disabled_by,omitempty"`
 	UniqueID   string  `json:"unique_id,omitempty" yaml:"unique_id,omitempty"`
+	// HiddenBy and EntityCategory keep an entity out of area, device and
+	// label targets; it can still be targeted by entity ID.
+	HiddenBy       *string  `json:"hidden_by,omitempty" yaml:"hidden_by,omitempty"`
+	EntityCategory string   `json:"entity_category,omitempty" yaml:"entity_category,omitempty"`
+	Labels         []string `json:"labels,omitempty" yaml:"labels,omitempty"`
 }
 
 type ActionResponse struct {
@@ -77,9 +97,79 @@ type WSMessage struct {
 	Result  json.RawMessage `json:"result,omitempty"`
 	Event   json.RawMessage `json:"event,omitempty"`
 	Error   *WSError        `json:"error,omitempty"`
+	Message string          `json:"message,omitempty"` // set on auth_invalid
 }
 
 type WSError struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
 }
+
+type SupervisorInfo struct {
+	Version         string `json:"version" yaml:"version"`
+	VersionLatest   string `json:"version_latest" yaml:"version_latest"`
+	UpdateAvailable bool   `json:"update_available" yaml:"update_available"`
+	Channel         string `json:"channel" yaml:"channel"`
+	Arch            string `json:"arch" yaml:"arch"`
+	Healthy         bool   `json:"healthy" yaml:"healthy"`
+	Supported       bool   `json:"supported" yaml:"supported"`
+}
+
+type Addon struct {
+	Slug            string `json:"slug" yaml:"slug"`
+	Name            string `json:"name" yaml:"name"`
+	Version         string `json:"version" yaml:"version"`
+	State           string `json:"state" yaml:"state"`
+	UpdateAvailable bool   `json:"update_available" yaml:"update_available"`
+	Repository      string `json:"repository" yaml:"repository"`
+}
+
+type AddonInfo struct {
+	Slug            string `json:"slug" yaml:"slug"`
+	Name            string `json:"name" yaml:"name"`
+	Description     string `json:"description" yaml:"description"`
+	Version         string `json:"version" yaml:"version"`
+	VersionLatest   string `json:"version_latest" yaml:"version_latest"`
+	State           string `json:"state" yaml:"state"`
+	Boot            string `json:"boot" yaml:"boot"`
+	UpdateAvailable bool   `json:"update_available" yaml:"update_available"`
+	URL             string `json:"url" yaml:"url"`
+}
+
+type Backup struct {
+	Slug      string    `json:"slug" yaml:"slug"`
+	Name      string    `json:"name" yaml:"name"`
+	Date      time.Time `json:"date" yaml:"date"`
+	Type      string    `json:"type" yaml:"type"`
+	Size      float64   `json:"size" yaml:"size"`
+	Protected bool      `json:"protected" yaml:"protected"`
+}
+
+// User is a Home Assistant user as returned by auth/current_user and
+// config/auth/list. GroupIDs is only present in the latter.
+type User struct {
+	ID          string           `json:"id" yaml:"id"`
+	Name        string           `json:"name" yaml:"name"`
+	IsOwner     bool             `json:"is_owner" yaml:"is_owner"`
+	IsAdmin     bool             `json:"is_admin" yaml:"is_admin"`
+	GroupIDs    []string         `json:"group_ids,omitempty" yaml:"group_ids,omitempty"`
+	Credentials []UserCredential `json:"credentials,omitempty" yaml:"credentials,omitempty"`
+}
+
+type UserCredential struct {
+	AuthProviderType string `json:"auth_provider_type" yaml:"auth_provider_type"`
+	AuthProviderID   string `json:"auth_provider_id" yaml:"auth_provider_id"`
+}
+
+// RefreshToken describes a login session or long-lived access token of the
+// current user. The token itself is never returned.
+type RefreshToken struct {
+	ID         string `json:"id" yaml:"id"`
+	ClientName string `json:"client_name" yaml:"client_name"`
+	ClientID   string `json:"client_id" yaml:"client_id"`
+	Type       string `json:"type" yaml:"type"`
+	CreatedAt  string `json:"created_at" yaml:"created_at"`
+	LastUsedAt string `json:"last_used_at,omitempty" yaml:"last_used_at,omitempty"`
+	LastUsedIP string `json:"last_used_ip,omitempty" yaml:"last_used_ip,omitempty"`
+	IsCurrent  bool   `json:"is_current" yaml:"is_current"`
+}
@@ -1,22 +1,66 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+// ErrClosed is returned by commands issued after the connection has been closed.
+var ErrClosed = errors.New("websocket connection closed")
+
+// ErrSubscriptionOverflow ends a subscription whose consumer fell so far behind
+// that its buffer filled. The shared reader never waits for a consumer, since
+// that consumer may itself be waiting on a reply only the reader can deliver.
+var ErrSubscriptionOverflow = errors.New("subscription ended: events were not consumed fast enough")
+
+// WSClient is a multiplexed Home Assistant WebSocket client. A single background
+// reader owns the connection's read side and routes every incoming frame by its
+// message ID: "result" frames go to the caller waiting in send, "event" frames go
+// to the matching Subscription. This lets one connection serve concurrent commands
+// and any number of subscriptions at the same time.
 type WSClient struct {
-	conn    *websocket.Conn
-	mu      sync.Mutex
+	url   string
+	token string
+	opts  options
+
+	conn    *websocket.Conn // replaced on reconnect; guarded by writeMu for writers
+	writeMu sync.Mutex      // gorilla/websocket supports only one concurrent writer
 	counter atomic.Int32
+
+	mu      sync.Mutex // guards pending, subs, err and down
+	pending map[int]chan wsReply
+	subs    map[int]*Subscription
+	err     error // set once the read loop has exited for good
+	down    error // set while the connection is lost and being re-established
+
+	closed   atomic.Bool     // set by Close so the read loop can tell shutdown from failure
+	lifetime context.Context // cancelled by Close to cut a reconnect short
+	cancel   context.CancelFunc
+	done     chan struct{} // closed when the read loop exits
+}
+
+// wsReply is what a waiting caller receives: the result frame, or the reason
+// it will never arrive.
+type wsReply struct {
+	msg *WSMessage
+	err error
 }
 
-func NewWSClient(serverURL, token string) (*WSClient, error) {
+// reconnectedMarker is injected into every subscription's event stream after a
+// successful reconnect, so consumers know events may have been missed.
+var reconnectedMarker = json.RawMessage(`{"type":"reconnected"}`)
+
+// NewWSClient connects and authenticates. ctx bounds only the connection
+// handshake; each command takes its own context.
+func NewWSClient(ctx context.Context, serverURL, token string, opts ...Option) (*WSClient, error) {
 	// Trim trailing slash so we never produce "//api/websocket".
 	wsURL := strings.TrimRight(serverURL, "/")
 	// Convert http:// → ws://, https:// → wss://
@@ -26,78 +70,362 @@ func NewWSClient(serverURL, token string) (*WSClient, error) {
 		wsURL = "wss:" + wsURL[6:]
 	}
 
-	conn, _, err := websocket.DefaultDialer.Dial(wsURL+"/api/websocket", nil)
+	c := &WSClient{
+		url:     wsURL + "/api/websocket",
+		token:   token,
+		opts:    newOptions(opts),
+		pending: map[int]chan wsReply{},
+		subs:    map[int]*Subscription{},
+		done:    make(chan struct{}),
+	}
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.lifetime, c.cancel = context.WithCancel(context.Background())
+	c.conn = conn
+	go c.readLoop()
+	return c, nil
+}
+
+// dial opens a new connection and completes the auth handshake on it.
+func (c *WSClient) dial(ctx context.Context) (*websocket.Conn, error) {
+	token := c.token
+	if c.opts.tokenSource != nil {
+		// Fetched per dial: a reconnect may come after the last token expired.
+		t, err := c.opts.tokenSource.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		token = t
+	}
+	conn, _, err := c.opts.dialer().DialContext(ctx, c.url, c.opts.headers)
 	if err != nil {
 		return nil, fmt.Errorf("websocket connect failed: %w", err)
 	}
+	// gorilla's reads and writes are not context-aware, so abort a stalled
+	// handshake by closing the connection when ctx ends.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	err = c.handshake(conn, token)
+	if !stop() {
+		return nil, fmt.Errorf("websocket auth: %w", ctx.Err())
+	}
+	if err != nil {
+		conn.Close()
+		if c.opts.tokenSource != nil {
+			// Let the next reconnect fetch a fresh token.
+			c.opts.tokenSource.Invalidate()
+		}
+		return nil, err
+	}
+	return conn, nil
+}
 
+func (c *WSClient) handshake(conn *websocket.Conn, token string) error {
 	// HA WebSocket auth is a server-initiated challenge-response: the server sends
 	// "auth_required" first, then the client replies with the token, then the server
 	// confirms with "auth_ok". We must not send anything before receiving the challenge.
 	var authRequired WSMessage
-	if err := conn.ReadJSON(&authRequired); err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("read auth_required: %w", err)
+	if err := c.opts.readFrame(conn, c.url, &authRequired); err != nil {
+		return fmt.Errorf("read auth_required: %w", err)
 	}
 
-	if err := conn.WriteJSON(map[string]string{"type": "auth", "access_token": token}); err != nil {
-		conn.Close()
-		return nil, err
+	if err := c.opts.writeFrame(conn, c.url, map[string]string{"type": "auth", "access_token": token}); err != nil {
+		return err
 	}
 
 	var authResult WSMessage
-	if err := conn.ReadJSON(&authResult); err != nil {
-		conn.Close()
-		return nil, err
+	if err := c.opts.readFrame(conn, c.url, &authResult); err != nil {
+		return err
 	}
 	if authResult.Type != "auth_ok" {
-		conn.Close()
-		return nil, fmt.Errorf("authentication failed: invalid token")
+		msg := authResult.Message
+		if msg == "" {
+			msg = "invalid token"
+		}
+		return &APIError{Code: CodeAuthInvalid, Message: msg, Request: "auth"}
 	}
-
-	return &WSClient{conn: conn}, nil
+	return nil
 }
 
+// Close closes the connection and waits for the background reader to exit.
+// Callers still waiting on a response receive ErrClosed.
 func (c *WSClient) Close() error {
-	return c.conn.Close()
+	c.writeMu.Lock()
+	if c.closed.Swap(true) {
+		c.writeMu.Unlock()
+		<-c.done
+		return nil
+	}
+	c.cancel()
+	err := c.conn.Close()
+	c.writeMu.Unlock()
+	<-c.done
+	return err
+}
+
+// readLoop is the only goroutine that reads from the connection. When the
+// connection fails it either reconnects (if enabled) or fails every outstanding
+// command and subscription with the read error and exits.
+func (c *WSClient) readLoop() {
+	defer close(c.done)
+	for {
+		err := c.readFrames(c.conn)
+		if c.closed.Load() || !c.opts.reconnect {
+			c.shutdown(err)
+			return
+		}
+		c.interrupt(err)
+		if err := c.reconnect(); err != nil {
+			c.shutdown(err)
+			return
+		}
+	}
+}
+
+// readFrames dispatches frames from conn until a read fails.
+func (c *WSClient) readFrames(conn *websocket.Conn) error {
+	for {
+		var msg WSMessage
+		if err := c.opts.readFrame(conn, c.url, &msg); err != nil {
+			return err
+		}
+		c.dispatch(&msg)
+	}
 }
 
-// send serialises a request-response cycle on the WebSocket connection.
-// The mutex covers the entire send+read pair so that concurrent callers
-// never interleave their writes and reads — each message ID maps 1:1 to the
-// next response, so breaking that pairing would corrupt the message stream.
-func (c *WSClient) send(msgType string, extra map[string]interface{}) (*WSMessage, error) {
+func (c *WSClient) dispatch(msg *WSMessage) {
+	switch msg.Type {
+	case "result":
+		c.mu.Lock()
+		ch := c.pending[msg.ID]
+		delete(c.pending, msg.ID)
+		c.mu.Unlock()
+		if ch != nil {
+			ch <- wsReply{msg: msg} // buffered: never blocks the reader
+		}
+	case "event":
+		c.mu.Lock()
+		sub := c.subs[msg.ID]
+		c.mu.Unlock()
+		if sub != nil {
+			c.deliver(sub, msg.Event)
+		}
+	}
+	// Anything else (e.g. "pong", or a result for a caller that already gave up)
+	// has no one waiting for it and is dropped.
+}
+
+// failPending releases every caller waiting on a result. Must hold mu.
+func (c *WSClient) failPending(err error) {
+	for id, ch := range c.pending {
+		ch <- wsReply{err: err}
+		delete(c.pending, id)
+	}
+}
+
+func (c *WSClient) shutdown(readErr error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// A read error after Close is the expected way for the loop to end; report it
+	// to stragglers as ErrClosed rather than "use of closed network connection".
+	if c.closed.Load() {
+		readErr = ErrClosed
+	}
+	c.err = readErr
+	c.failPending(readErr)
+	for id, sub := range c.subs {
+		sub.err = readErr
+		close(sub.events)
+		delete(c.subs, id)
+	}
+}
+
+// interrupt marks the connection as down. Commands in flight are failed rather
+// than replayed: we cannot know whether HA acted on them before the drop.
+// Subscriptions are kept so reconnect can replay them.
+func (c *WSClient) interrupt(readErr error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.down = fmt.Errorf("connection lost, reconnecting: %w", readErr)
+	c.failPending(c.down)
+}
 
-	// counter is atomic so the increment itself is safe without the lock, but we
-	// still hold mu here so the ID is always assigned before the write goes out.
-	id := int(c.counter.Add(1))
+// reconnect re-dials with exponential backoff until it succeeds or the client
+// is closed, then replays every active subscription on the new connection. A
+// rejected token is permanent: retrying cannot fix it, so it ends the client.
+func (c *WSClient) reconnect() error {
+	delay := time.Duration(0) // first attempt is immediate
+	for {
+		select {
+		case <-c.lifetime.Done():
+			return ErrClosed
+		case <-time.After(delay):
+		}
+		conn, err := c.dial(c.lifetime)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.Code == CodeAuthInvalid {
+			return fmt.Errorf("reconnect: %w", err)
+		}
+		if err == nil {
+			c.writeMu.Lock()
+			if c.closed.Load() {
+				c.writeMu.Unlock()
+				conn.Close()
+				return ErrClosed
+			}
+			c.conn = conn
+			c.writeMu.Unlock()
+			if err := c.resubscribe(conn); err == nil {
+				return nil
+			}
+			conn.Close()
+		}
+		delay = min(max(2*delay, c.opts.backoffMin), c.opts.backoffMax)
+	}
+}
+
+// resubscribe replays subscriptions on a fresh connection under new message IDs
+// (HA IDs are per-connection), then marks the connection as up again. It runs on
+// the reader goroutine, so it reads the ACKs itself, dispatching any other frame
+// that arrives in the meantime.
+func (c *WSClient) resubscribe(conn *websocket.Conn) error {
+	c.mu.Lock()
+	subs := make([]*Subscription, 0, len(c.subs))
+	for id, sub := range c.subs {
+		subs = append(subs, sub)
+		delete(c.subs, id)
+	}
+	for _, sub := range subs {
+		sub.id = int(c.counter.Add(1))
+		c.subs[sub.id] = sub
+	}
+	c.mu.Unlock()
+
+	for _, sub := range subs {
+		c.mu.Lock()
+		_, live := c.subs[sub.id]
+		c.mu.Unlock()
+		if !live {
+			continue // ended while an earlier ACK was awaited
+		}
+		if err := c.write(command(sub.id, "subscribe_events", sub.extra())); err != nil {
+			return err
+		}
+		for {
+			var msg WSMessage
+			if err := c.opts.readFrame(conn, c.url, &msg); err != nil {
+				return err
+			}
+			if msg.Type != "result" || msg.ID != sub.id {
+				c.dispatch(&msg)
+				continue
+			}
+			if !msg.Success {
+				// The server no longer accepts this subscription; end it
+				// rather than retrying forever.
+				c.endSubscription(sub, fmt.Errorf("resubscribe failed: %w", newWSError("subscribe_events", msg.Error)))
+			}
+			break
+		}
+	}
+
+	c.mu.Lock()
+	c.down = nil
+	live := make([]*Subscription, 0, len(c.subs))
+	for _, sub := range c.subs {
+		live = append(live, sub)
+	}
+	c.mu.Unlock()
+	for _, sub := range live {
+		c.deliver(sub, reconnectedMarker)
+	}
+	return nil
+}
+
+func (c *WSClient) write(msg interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.opts.writeFrame(c.conn, c.url, msg)
+}
+
+// command builds the wire message for a command. id is set AFTER the merge so it
+// cannot be overwritten by caller-supplied fields.
+func command(id int, msgType string, extra map[string]interface{}) map[string]interface{} {
 	msg := map[string]interface{}{"type": msgType}
 	for k, v := range extra {
 		msg[k] = v
 	}
-	msg["id"] = id // set AFTER merge so it cannot be overwritten by config fields
+	msg["id"] = id
+	return msg
+}
+
+// send issues a command and waits for the "result" frame carrying its ID.
+// Any number of sends may be in flight at once; the read loop pairs each
+// response with its caller, so ordering on the wire does not matter.
+func (c *WSClient) send(ctx context.Context, msgType string, extra map[string]interface{}) (*WSMessage, error) {
+	id := int(c.counter.Add(1))
+	resp, err := c.roundTrip(ctx, id, command(id, msgType, extra), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", msgType, err)
+	}
+	if !resp.Success {
+		return nil, newWSError(msgType, resp.Error)
+	}
+	return resp, nil
+}
 
-	if err := c.conn.WriteJSON(msg); err != nil {
-		return nil, fmt.Errorf("send %s: %w", msgType, err)
+// roundTrip registers a waiter for id (and sub, if non-nil, so that no event
+// arriving straight after the ACK is missed), writes msg and waits for the reply
+// or for ctx to end, whichever comes first.
+func (c *WSClient) roundTrip(ctx context.Context, id int, msg map[string]interface{}, sub *Subscription) (*WSMessage, error) {
+	ch := make(chan wsReply, 1)
+	c.mu.Lock()
+	if err := c.unavailable(); err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	c.pending[id] = ch
+	if sub != nil {
+		c.subs[id] = sub
 	}
+	c.mu.Unlock()
 
-	var resp WSMessage
-	if err := c.conn.ReadJSON(&resp); err != nil {
-		return nil, fmt.Errorf("read response for %s: %w", msgType, err)
+	if err := c.write(msg); err != nil {
+		c.forget(id)
+		return nil, fmt.Errorf("send: %w", err)
 	}
-	if !resp.Success {
-		if resp.Error != nil {
-			return nil, fmt.Errorf("WS error %s: %s", resp.Error.Code, resp.Error.Message)
+
+	select {
+	case reply := <-ch:
+		if reply.err != nil {
+			return nil, fmt.Errorf("read response: %w", reply.err)
 		}
-		return nil, fmt.Errorf("command %s failed", msgType)
+		return reply.msg, nil
+	case <-ctx.Done():
+		// A late reply finds no waiter and is dropped by dispatch.
+		c.forget(id)
+		return nil, ctx.Err()
 	}
-	return &resp, nil
 }
 
-func (c *WSClient) ListAreas() ([]Area, error) {
-	resp, err := c.send("config/area_registry/list", nil)
+// unavailable reports why no command can be sent right now, if anything. Must hold mu.
+func (c *WSClient) unavailable() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.down
+}
+
+func (c *WSClient) forget(id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, id)
+	delete(c.subs, id)
+}
+
+func (c *WSClient) ListAreas(ctx context.Context) ([]Area, error) {
+	resp, err := c.send(ctx, "config/area_registry/list", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -105,8 +433,8 @@ func (c *WSClient) ListAreas() ([]Area, error) {
 	return areas, json.Unmarshal(resp.Result, &areas)
 }
 
-func (c *WSClient) CreateArea(name string) (*Area, error) {
-	resp, err := c.send("config/area_registry/create", map[string]interface{}{"name": name})
+func (c *WSClient) CreateArea(ctx context.Context, name string) (*Area, error) {
+	resp, err := c.send(ctx, "config/area_registry/create", map[string]interface{}{"name": name})
 	if err != nil {
 		return nil, err
 	}
@@ -114,13 +442,31 @@ func (c *WSClient) CreateArea(name string) (*Area, error) {
 	return &area, json.Unmarshal(resp.Result, &area)
 }
 
-func (c *WSClient) DeleteArea(areaID string) error {
-	_, err := c.send("config/area_registry/delete", map[string]interface{}{"area_id": areaID})
+func (c *WSClient) DeleteArea(ctx context.Context, areaID string) error {
+	_, err := c.send(ctx, "config/area_registry/delete", map[string]interface{}{"area_id": areaID})
 	return err
 }
 
-func (c *WSClient) ListDevices() ([]Device, error) {
-	resp, err := c.send("config/device_registry/list", nil)
+func (c *WSClient) ListFloors(ctx context.Context) ([]Floor, error) {
+	resp, err := c.send(ctx, "config/floor_registry/list", nil)
+	if err != nil {
+		return nil, err
+	}
+	var floors []Floor
+	return floors, json.Unmarshal(resp.Result, &floors)
+}
+
+func (c *WSClient) ListLabels(ctx context.Context) ([]Label, error) {
+	resp, err := c.send(ctx, "config/label_registry/list", nil)
+	if err != nil {
+		return nil, err
+	}
+	var labels []Label
+	return labels, json.Unmarshal(resp.Result, &labels)
+}
+
+func (c *WSClient) ListDevices(ctx context.Context) ([]Device, error) {
+	resp, err := c.send(ctx, "config/device_registry/list", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -128,8 +474,8 @@ func (c *WSClient) ListDevices() ([]Device, error) {
 	return devices, json.Unmarshal(resp.Result, &devices)
 }
 
-func (c *WSClient) ListEntities() ([]EntityEntry, error) {
-	resp, err := c.send("config/entity_registry/list", nil)
+func (c *WSClient) ListEntities(ctx context.Context) ([]EntityEntry, error) {
+	resp, err := c.send(ctx, "config/entity_registry/list", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -137,8 +483,8 @@ func (c *WSClient) ListEntities() ([]EntityEntry, error) {
 	return entities, json.Unmarshal(resp.Result, &entities)
 }
 
-func (c *WSClient) GetEntity(entityID string) (*EntityEntry, error) {
-	resp, err := c.send("config/entity_registry/get", map[string]interface{}{"entity_id": entityID})
+func (c *WSClient) GetEntity(ctx context.Context, entityID string) (*EntityEntry, error) {
+	resp, err := c.send(ctx, "config/entity_registry/get", map[string]interface{}{"entity_id": entityID})
 	if err != nil {
 		return nil, err
 	}
@@ -146,9 +492,57 @@ func (c *WSClient) GetEntity(entityID string) (*EntityEntry, error) {
 	return &entity, json.Unmarshal(resp.Result, &entity)
 }
 
+// CurrentUser returns the user the connection is authenticated as.
+func (c *WSClient) CurrentUser(ctx context.Context) (*User, error) {
+	resp, err := c.send(ctx, "auth/current_user", nil)
+	if err != nil {
+		return nil, err
+	}
+	var user User
+	return &user, json.Unmarshal(resp.Result, &user)
+}
+
+// ListUsers returns all users with their groups. It requires an admin user.
+func (c *WSClient) ListUsers(ctx context.Context) ([]User, error) {
+	resp, err := c.send(ctx, "config/auth/list", nil)
+	if err != nil {
+		return nil, err
+	}
+	var users []User
+	return users, json.Unmarshal(resp.Result, &users)
+}
+
+// ListRefreshTokens returns the current user's refresh tokens, including
+// long-lived access tokens.
+func (c *WSClient) ListRefreshTokens(ctx context.Context) ([]RefreshToken, error) {
+	resp, err := c.send(ctx, "auth/refresh_tokens", nil)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []RefreshToken
+	return tokens, json.Unmarshal(resp.Result, &tokens)
+}
+
+// CreateLongLivedToken creates a long-lived access token valid for lifespanDays
+// and returns it. Home Assistant shows the token only this once.
+func (c *WSClient) CreateLongLivedToken(ctx context.Context, name string, lifespanDays int) (string, error) {
+	resp, err := c.send(ctx, "auth/long_lived_access_token", map[string]interface{}{"client_name": name, "lifespan": lifespanDays})
+	if err != nil {
+		return "", err
+	}
+	var token string
+	return token, json.Unmarshal(resp.Result, &token)
+}
+
+// DeleteRefreshToken revokes a refresh token (or long-lived access token) by ID.
+func (c *WSClient) DeleteRefreshToken(ctx context.Context, id string) error {
+	_, err := c.send(ctx, "auth/delete_refresh_token", map[string]interface{}{"refresh_token_id": id})
+	return err
+}
+
 // GetAutomationConfig fetches the automation config for the given HA entity ID (e.g. "automation.my_automation"); it resolves the entity ID to the storage ID internally via the entity registry.
-func (c *WSClient) GetAutomationConfig(entityID string) (map[string]interface{}, error) {
-	resp, err := c.send("automation/config", map[string]interface{}{"entity_id": entityID})
+func (c *WSClient) GetAutomationConfig(ctx context.Context, entityID string) (map[string]interface{}, error) {
+	resp, err := c.send(ctx, "automation/config", map[string]interface{}{"entity_id": entityID})
 	if err != nil {
 		return nil, err
 	}
@@ -167,48 +561,139 @@ func (c *WSClient) GetAutomationConfig(entityID string) (map[string]interface{},
 	return cfg, json.Unmarshal(resp.Result, &cfg)
 }
 
-// SubscribeEvents subscribes to events and calls handler for each event received.
-// Blocks until handler returns false or an error occurs.
-func (c *WSClient) SubscribeEvents(eventType string, handler func(json.RawMessage) bool) error {
-	c.mu.Lock()
+// subscriptionBuffer is how many events a Subscription holds for its consumer.
+const subscriptionBuffer = 64
+
+// Subscription is an active subscribe_events stream on a shared WSClient.
+type Subscription struct {
+	id        int // current message ID; changes on reconnect, guarded by client.mu
+	eventType string
+	client    *WSClient
+	events    chan json.RawMessage
+	err       error // why events was closed; read only after events is drained
+
+	stop     chan struct{} // closed by Unsubscribe to release a blocked reader
+	stopOnce sync.Once
+}
+
+// Subscribe starts an event subscription on the shared connection. Events are
+// delivered on the returned Subscription's Events channel until Unsubscribe is
+// called or the connection fails. An empty eventType subscribes to all events.
+// ctx bounds only the subscribe request, not the lifetime of the stream.
+func (c *WSClient) Subscribe(ctx context.Context, eventType string) (*Subscription, error) {
 	id := int(c.counter.Add(1))
-	msg := map[string]interface{}{"id": id, "type": "subscribe_events"}
-	if eventType != "" {
-		msg["event_type"] = eventType
+	sub := &Subscription{
+		id:        id,
+		eventType: eventType,
+		client:    c,
+		// Buffered to absorb a burst of events; a consumer that falls further
+		// behind loses the subscription (see ErrSubscriptionOverflow).
+		events: make(chan json.RawMessage, subscriptionBuffer),
+		stop:   make(chan struct{}),
 	}
-	if err := c.conn.WriteJSON(msg); err != nil {
-		c.mu.Unlock()
-		return err
+	ack, err := c.roundTrip(ctx, id, command(id, "subscribe_events", sub.extra()), sub)
+	if err != nil {
+		// A failed connection releases only the waiter; drop the subscription too
+		// so that a reconnect does not replay it with no one reading.
+		c.forget(id)
+		return nil, fmt.Errorf("subscribe_events: %w", err)
 	}
+	if !ack.Success {
+		c.forget(id)
+		return nil, fmt.Errorf("subscribe failed: %w", newWSError("subscribe_events", ack.Error))
+	}
+	return sub, nil
+}
 
-	// Read the ACK while holding mu — same reason as send(): we own the
-	// connection until we've matched this command to its response.
-	var ack WSMessage
-	if err := c.conn.ReadJSON(&ack); err != nil {
-		c.mu.Unlock()
-		return err
+func (s *Subscription) extra() map[string]interface{} {
+	if s.eventType == "" {
+		return nil
 	}
-	// After the ACK, HA pushes events unprompted, so there is no more
-	// request/response pairing to protect. Release mu so the caller is not
-	// locked out for the (potentially indefinite) lifetime of the stream.
-	c.mu.Unlock()
-	if !ack.Success {
-		if ack.Error != nil {
-			return fmt.Errorf("subscribe failed: %s: %s", ack.Error.Code, ack.Error.Message)
+	return map[string]interface{}{"event_type": s.eventType}
+}
+
+// Events returns the channel on which events are delivered. It is closed when
+// the connection fails for good or the consumer falls too far behind; Err then
+// reports why. With WithReconnect, a
+// {"type":"reconnected"} marker is delivered after each successful reconnect.
+func (s *Subscription) Events() <-chan json.RawMessage { return s.events }
+
+// Err returns the error that ended the subscription, once Events is closed.
+func (s *Subscription) Err() error { return s.err }
+
+// Unsubscribe stops event delivery and tells the server to end the subscription.
+func (s *Subscription) Unsubscribe(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	s.client.mu.Lock()
+	id := s.id
+	_, active := s.client.subs[id]
+	delete(s.client.subs, id)
+	s.client.mu.Unlock()
+	if !active {
+		return nil
+	}
+	_, err := s.client.send(ctx, "unsubscribe_events", map[string]interface{}{"subscription": id})
+	return err
+}
+
+// deliver hands an event to the subscriber without blocking the reader. If
+// the buffer is full the subscription is ended with ErrSubscriptionOverflow
+// rather than silently losing events. Only the reader calls it.
+func (c *WSClient) deliver(sub *Subscription, event json.RawMessage) {
+	select {
+	case sub.events <- event:
+	case <-sub.stop:
+	default:
+		id := sub.id
+		if c.endSubscription(sub, ErrSubscriptionOverflow) {
+			// Stop the server sending more; its reply has no waiter and is dropped.
+			_ = c.write(command(int(c.counter.Add(1)), "unsubscribe_events", map[string]interface{}{"subscription": id}))
 		}
-		return fmt.Errorf("subscribe_events failed")
 	}
+}
 
-	// Stream events
+// endSubscription removes sub and closes its events with err, reporting
+// whether it was still active. Only the reader calls it.
+func (c *WSClient) endSubscription(sub *Subscription, err error) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.subs[sub.id] != sub {
+		return false
+	}
+	delete(c.subs, sub.id)
+	sub.err = err
+	close(sub.events)
+	return true
+}
+
+// unsubscribeTimeout bounds the unsubscribe sent when SubscribeEvents returns.
+const unsubscribeTimeout = 2 * time.Second
+
+// SubscribeEvents subscribes to events and calls handler for each event received.
+// Blocks until handler returns false, ctx ends (returning ctx.Err()) or an error occurs.
+func (c *WSClient) SubscribeEvents(ctx context.Context, eventType string, handler func(json.RawMessage) bool) error {
+	sub, err := c.Subscribe(ctx, eventType)
+	if err != nil {
+		return err
+	}
+	// Failing to tell the server is not worth reporting, since no further
+	// events will be read either way. ctx may be done, so it is not used.
+	defer func() {
+		unsubCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), unsubscribeTimeout)
+		defer cancel()
+		_ = sub.Unsubscribe(unsubCtx)
+	}()
 	for {
-		var event WSMessage
-		if err := c.conn.ReadJSON(&event); err != nil {
-			return err
-		}
-		if event.Type == "event" {
-			if !handler(event.Event) {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				return sub.Err()
+			}
+			if !handler(event) {
 				return nil
 			}
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
 }
@@ -1,11 +1,15 @@
 package client_test
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/rnorth/ha-client/internal/client"
@@ -61,11 +65,11 @@ func TestListAreas(t *testing.T) {
 	srv := mockWSServer(t, "test-token", "config/area_registry/list", areas)
 	defer srv.Close()
 
-	wsc, err := client.NewWSClient(wsURL(srv), "test-token")
+	wsc, err := client.NewWSClient(context.Background(), wsURL(srv), "test-token")
 	require.NoError(t, err)
 	defer wsc.Close()
 
-	result, err := wsc.ListAreas()
+	result, err := wsc.ListAreas(context.Background())
 	require.NoError(t, err)
 	assert.Len(t, result, 1)
 	assert.Equal(t, "Living Room", result[0].Name)
@@ -76,26 +80,40 @@ func TestListDevices(t *testing.T) {
 	srv := mockWSServer(t, "test-token", "config/device_registry/list", devices)
 	defer srv.Close()
 
-	wsc, err := client.NewWSClient(wsURL(srv), "test-token")
+	wsc, err := client.NewWSClient(context.Background(), wsURL(srv), "test-token")
 	require.NoError(t, err)
 	defer wsc.Close()
 
-	result, err := wsc.ListDevices()
+	result, err := wsc.ListDevices(context.Background())
 	require.NoError(t, err)
 	assert.Len(t, result, 1)
 	assert.Equal(t, "Desk Lamp", result[0].Name)
 }
 
+func TestListLabels(t *testing.T) {
+	labels := []client.Label{{LabelID: "night", Name: "Night lights"}}
+	srv := mockWSServer(t, "test-token", "config/label_registry/list", labels)
+	defer srv.Close()
+
+	wsc, err := client.NewWSClient(context.Background(), wsURL(srv), "test-token")
+	require.NoError(t, err)
+	defer wsc.Close()
+
+	result, err := wsc.ListLabels(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, labels, result)
+}
+
 func TestListEntities(t *testing.T) {
 	entities := []client.EntityEntry{{EntityID: "light.desk", Platform: "hue"}}
 	srv := mockWSServer(t, "test-token", "config/entity_registry/list", entities)
 	defer srv.Close()
 
-	wsc, err := client.NewWSClient(wsURL(srv), "test-token")
+	wsc, err := client.NewWSClient(context.Background(), wsURL(srv), "test-token")
 	require.NoError(t, err)
 	defer wsc.Close()
 
-	result, err := wsc.ListEntities()
+	result, err := wsc.ListEntities(context.Background())
 	require.NoError(t, err)
 	assert.Len(t, result, 1)
 	assert.Equal(t, "light.desk", result[0].EntityID)
@@ -105,11 +123,11 @@ func TestGetEntityUniqueID(t *testing.T) {
 	srv := mockWSServer(t, "test-token", "config/entity_registry/get", entity)
 	defer srv.Close()
 
-	wsc, err := client.NewWSClient(wsURL(srv), "test-token")
+	wsc, err := client.NewWSClient(context.Background(), wsURL(srv), "test-token")
 	require.NoError(t, err)
 	defer wsc.Close()
 
-	result, err := wsc.GetEntity("automation.morning")
+	result, err := wsc.GetEntity(context.Background(), "automation.morning")
 	require.NoError(t, err)
 	assert.Equal(t, "abc-123", result.UniqueID)
 }
@@ -125,12 +143,519 @@ func TestWSClientGetAutomationConfig(t *testing.T) {
 	srv := mockWSServer(t, "test-token", "automation/config", cfg)
 	defer srv.Close()
 
-	wsc, err := client.NewWSClient(wsURL(srv), "test-token")
+	wsc, err := client.NewWSClient(context.Background(), wsURL(srv), "test-token")
 	require.NoError(t, err)
 	defer wsc.Close()
 
-	result, err := wsc.GetAutomationConfig("automation.morning")
+	result, err := wsc.GetAutomationConfig(context.Background(), "automation.morning")
 	require.NoError(t, err)
 	assert.Equal(t, "Morning routine", result["alias"])
 	assert.Equal(t, "abc-123", result["id"])
 }
+
+// mockMuxServer authenticates, then reads n commands before answering them in
+// reverse order, so a client that assumes the next frame is its reply fails.
+func mockMuxServer(t *testing.T, n int) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_ = conn.WriteJSON(map[string]string{"type": "auth_required"})
+		var authMsg map[string]string
+		_ = conn.ReadJSON(&authMsg)
+		_ = conn.WriteJSON(map[string]string{"type": "auth_ok"})
+
+		cmds := make([]client.WSMessage, n)
+		for i := range cmds {
+			if err := conn.ReadJSON(&cmds[i]); err != nil {
+				return
+			}
+		}
+		for i := n - 1; i >= 0; i-- {
+			result, _ := json.Marshal([]client.Area{{AreaID: fmt.Sprintf("area-%d", cmds[i].ID)}})
+			_ = conn.WriteJSON(map[string]interface{}{
+				"id": cmds[i].ID, "type": "result", "success": true, "result": json.RawMessage(result),
+			})
+		}
+		var ignored client.WSMessage
+		_ = conn.ReadJSON(&ignored) // hold the connection open until the client closes
+	}))
+}
+
+func TestWSClient_ConcurrentCommands(t *testing.T) {
+	const n = 5
+	srv := mockMuxServer(t, n)
+	defer srv.Close()
+
+	wsc, err := client.NewWSClient(context.Background(), wsURL(srv), "test-token")
+	require.NoError(t, err)
+	defer wsc.Close()
+
+	var wg sync.WaitGroup
+	results := make([][]client.Area, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = wsc.ListAreas(context.Background())
+		}(i)
+	}
+	wg.Wait()
+
+	seen := map[string]bool{}
+	for i := 0; i < n; i++ {
+		require.NoError(t, errs[i])
+		require.Len(t, results[i], 1)
+		seen[results[i][0].AreaID] = true
+	}
+	// Every caller got a distinct reply, i.e. each was routed by its own ID.
+	assert.Len(t, seen, n)
+}
+
+func TestWSClient_CommandsWhileSubscribed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_ = conn.WriteJSON(map[string]string{"type": "auth_required"})
+		var authMsg map[string]string
+		_ = conn.ReadJSON(&authMsg)
+		_ = conn.WriteJSON(map[string]string{"type": "auth_ok"})
+
+		var subID int
+		for {
+			var cmd client.WSMessage
+			if err := conn.ReadJSON(&cmd); err != nil {
+				return
+			}
+			switch cmd.Type {
+			case "subscribe_events":
+				subID = cmd.ID
+				_ = conn.WriteJSON(map[string]interface{}{"id": cmd.ID, "type": "result", "success": true})
+				_ = conn.WriteJSON(map[string]interface{}{"id": subID, "type": "event", "event": map[string]string{"event_type": "first"}})
+			default:
+				// Push an event before the reply, as HA does when both are in flight.
+				_ = conn.WriteJSON(map[string]interface{}{"id": subID, "type": "event", "event": map[string]string{"event_type": "second"}})
+				_ = conn.WriteJSON(map[string]interface{}{
+					"id": cmd.ID, "type": "result", "success": true,
+					"result": []client.Area{{AreaID: "kitchen"}},
+				})
+			}
+		}
+	}))
+	defer srv.Close()
+
+	wsc, err := client.NewWSClient(context.Background(), wsURL(srv), "test-token")
+	require.NoError(t, err)
+	defer wsc.Close()
+
+	sub, err := wsc.Subscribe(context.Background(), "")
+	require.NoError(t, err)
+
+	areas, err := wsc.ListAreas(context.Background())
+	require.NoError(t, err)
+	require.Len(t, areas, 1)
+	assert.Equal(t, "kitchen", areas[0].AreaID)
+
+	for _, want := range []string{"first", "second"} {
+		select {
+		case ev := <-sub.Events():
+			assert.Contains(t, string(ev), want)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q event", want)
+		}
+	}
+}
+
+func TestWSClient_SubscriptionOverflowDoesNotBlockCommands(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_ = conn.WriteJSON(map[string]string{"type": "auth_required"})
+		var authMsg map[string]string
+		_ = conn.ReadJSON(&authMsg)
+		_ = conn.WriteJSON(map[string]string{"type": "auth_ok"})
+
+		var subID int
+		for {
+			var cmd client.WSMessage
+			if err := conn.ReadJSON(&cmd); err != nil {
+				return
+			}
+			switch cmd.Type {
+			case "subscribe_events":
+				subID = cmd.ID
+				_ = conn.WriteJSON(map[string]interface{}{"id": cmd.ID, "type": "result", "success": true})
+				_ = conn.WriteJSON(map[string]interface{}{"id": subID, "type": "event", "event": map[string]int{"n": 0}})
+			case "config/area_registry/list":
+				// A burst larger than the subscription's buffer, ahead of the reply.
+				for i := 1; i <= 200; i++ {
+					_ = conn.WriteJSON(map[string]interface{}{"id": subID, "type": "event", "event": map[string]int{"n": i}})
+				}
+				_ = conn.WriteJSON(map[string]interface{}{"id": cmd.ID, "type": "result", "success": true, "result": []client.Area{}})
+			default:
+				_ = conn.WriteJSON(map[string]interface{}{"id": cmd.ID, "type": "result", "success": true})
+			}
+		}
+	}))
+	defer srv.Close()
+
+	wsc, err := client.NewWSClient(context.Background(), wsURL(srv), "test-token")
+	require.NoError(t, err)
+	defer wsc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var cmdErr error
+	calls := 0
+	err = wsc.SubscribeEvents(ctx, "", func(json.RawMessage) bool {
+		if calls++; calls == 1 {
+			// The handler issues a command on the same client while events flood in.
+			_, cmdErr = wsc.ListAreas(ctx)
+		}
+		return true
+	})
+	require.NoError(t, cmdErr, "the command's reply must not be stuck behind undelivered events")
+	assert.ErrorIs(t, err, client.ErrSubscriptionOverflow)
+
+	// The client is still usable afterwards.
+	_, err = wsc.ListAreas(ctx)
+	assert.NoError(t, err)
+}
+
+func TestWSClient_SubscribeInterruptedIsNotReplayed(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		conns int
+		seen  []string // commands received on the second connection
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		mu.Lock()
+		conns++
+		n := conns
+		mu.Unlock()
+
+		_ = conn.WriteJSON(map[string]string{"type": "auth_required"})
+		var authMsg map[string]string
+		_ = conn.ReadJSON(&authMsg)
+		_ = conn.WriteJSON(map[string]string{"type": "auth_ok"})
+		for {
+			var cmd client.WSMessage
+			if err := conn.ReadJSON(&cmd); err != nil {
+				return
+			}
+			if n == 1 {
+				return // drop the connection before acknowledging the subscribe
+			}
+			mu.Lock()
+			seen = append(seen, cmd.Type)
+			mu.Unlock()
+			_ = conn.WriteJSON(map[string]interface{}{"id": cmd.ID, "type": "result", "success": true, "result": []client.Area{}})
+		}
+	}))
+	defer srv.Close()
+
+	wsc, err := client.NewWSClient(context.Background(), wsURL(srv), "test-token", client.WithReconnect(true))
+	require.NoError(t, err)
+	defer wsc.Close()
+
+	_, err = wsc.Subscribe(context.Background(), "state_changed")
+	require.Error(t, err)
+
+	require.Eventually(t, func() bool {
+		_, err := wsc.ListAreas(context.Background())
+		return err == nil
+	}, 5*time.Second, 20*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.NotContains(t, seen, "subscribe_events", "a failed subscribe must not be replayed")
+}
+
+func TestWSClient_SubscribeEventsUnsubscribesOnCancel(t *testing.T) {
+	got := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.WriteJSON(map[string]string{"type": "auth_required"})
+		var authMsg map[string]string
+		_ = conn.ReadJSON(&authMsg)
+		_ = conn.WriteJSON(map[string]string{"type": "auth_ok"})
+		for {
+			var cmd client.WSMessage
+			if err := conn.ReadJSON(&cmd); err != nil {
+				return
+			}
+			if cmd.Type != "subscribe_events" {
+				got <- cmd.Type
+			}
+			_ = conn.WriteJSON(map[string]interface{}{"id": cmd.ID, "type": "result", "success": true})
+		}
+	}))
+	defer srv.Close()
+
+	wsc, err := client.NewWSClient(context.Background(), wsURL(srv), "test-token")
+	require.NoError(t, err)
+	defer wsc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = wsc.SubscribeEvents(ctx, "", func(json.RawMessage) bool { return true })
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	select {
+	case cmd := <-got:
+		assert.Equal(t, "unsubscribe_events", cmd)
+	case <-time.After(2 * time.Second):
+		t.Fatal("the server subscription was not ended")
+	}
+}
+
+func TestWSClient_CloseFailsPendingCommands(t *testing.T) {
+	srv := mockMuxServer(t, 2) // never answers a single command
+	defer srv.Close()
+
+	wsc, err := client.NewWSClient(context.Background(), wsURL(srv), "test-token")
+	require.NoError(t, err)
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := wsc.ListAreas(context.Background())
+		errCh <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, wsc.Close())
+
+	select {
+	case err := <-errCh:
+		assert.ErrorIs(t, err, client.ErrClosed)
+	case <-time.After(2 * time.Second):
+		t.Fatal("pending command was not released by Close")
+	}
+}
+
+func TestWSClient_ReconnectReplaysSubscriptions(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		conns  int
+		subIDs []int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		mu.Lock()
+		conns++
+		n := conns
+		mu.Unlock()
+
+		_ = conn.WriteJSON(map[string]string{"type": "auth_required"})
+		var authMsg map[string]string
+		_ = conn.ReadJSON(&authMsg)
+		_ = conn.WriteJSON(map[string]string{"type": "auth_ok"})
+
+		var cmd client.WSMessage
+		if err := conn.ReadJSON(&cmd); err != nil {
+			return
+		}
+		mu.Lock()
+		subIDs = append(subIDs, cmd.ID)
+		mu.Unlock()
+		_ = conn.WriteJSON(map[string]interface{}{"id": cmd.ID, "type": "result", "success": true})
+		_ = conn.WriteJSON(map[string]interface{}{"id": cmd.ID, "type": "event", "event": map[string]int{"conn": n}})
+		if n == 1 {
+			return // simulate HA restarting: drop the first connection
+		}
+		_ = conn.ReadJSON(&cmd) // hold the second connection open
+	}))
+	defer srv.Close()
+
+	wsc, err := client.NewWSClient(context.Background(), wsURL(srv), "test-token", client.WithReconnect(true))
+	require.NoError(t, err)
+	defer wsc.Close()
+
+	sub, err := wsc.Subscribe(context.Background(), "state_changed")
+	require.NoError(t, err)
+
+	var got []string
+	for len(got) < 3 {
+		select {
+		case ev, ok := <-sub.Events():
+			require.True(t, ok, "subscription ended: %v", sub.Err())
+			got = append(got, string(ev))
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out; got %v", got)
+		}
+	}
+	assert.JSONEq(t, `{"conn":1}`, got[0])
+	assert.JSONEq(t, `{"type":"reconnected"}`, got[1])
+	assert.JSONEq(t, `{"conn":2}`, got[2])
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, subIDs, 2)
+	assert.NotEqual(t, subIDs[0], subIDs[1], "replayed subscription must use a new message ID")
+}
+
+func TestWSClient_ReconnectStopsOnAuthInvalid(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		conns int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		mu.Lock()
+		conns++
+		n := conns
+		mu.Unlock()
+
+		_ = conn.WriteJSON(map[string]string{"type": "auth_required"})
+		var authMsg map[string]string
+		_ = conn.ReadJSON(&authMsg)
+		if n > 1 {
+			// The token was revoked while the connection was down.
+			_ = conn.WriteJSON(map[string]string{"type": "auth_invalid", "message": "Invalid access token"})
+			return
+		}
+		_ = conn.WriteJSON(map[string]string{"type": "auth_ok"})
+		var cmd client.WSMessage
+		_ = conn.ReadJSON(&cmd)
+		_ = conn.WriteJSON(map[string]interface{}{"id": cmd.ID, "type": "result", "success": true})
+	}))
+	defer srv.Close()
+
+	wsc, err := client.NewWSClient(context.Background(), wsURL(srv), "test-token", client.WithReconnect(true))
+	require.NoError(t, err)
+	defer wsc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = wsc.SubscribeEvents(ctx, "", func(json.RawMessage) bool { return true })
+	var apiErr *client.APIError
+	require.ErrorAs(t, err, &apiErr, "got %v", err)
+	assert.Equal(t, client.CodeAuthInvalid, apiErr.Code)
+
+	_, err = wsc.ListAreas(ctx)
+	assert.ErrorAs(t, err, &apiErr, "the client is closed for good")
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 2, conns, "an auth failure is not retried")
+}
+
+func TestWSClient_NoReconnectEndsSubscription(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.WriteJSON(map[string]string{"type": "auth_required"})
+		var authMsg map[string]string
+		_ = conn.ReadJSON(&authMsg)
+		_ = conn.WriteJSON(map[string]string{"type": "auth_ok"})
+		var cmd client.WSMessage
+		_ = conn.ReadJSON(&cmd)
+		_ = conn.WriteJSON(map[string]interface{}{"id": cmd.ID, "type": "result", "success": true})
+	}))
+	defer srv.Close()
+
+	wsc, err := client.NewWSClient(context.Background(), wsURL(srv), "test-token")
+	require.NoError(t, err)
+	defer wsc.Close()
+
+	err = wsc.SubscribeEvents(context.Background(), "", func(json.RawMessage) bool { return true })
+	assert.Error(t, err)
+}
+
+func TestWSClient_ContextDeadline(t *testing.T) {
+	srv := mockMuxServer(t, 2) // never answers a single command
+	defer srv.Close()
+
+	wsc, err := client.NewWSClient(context.Background(), wsURL(srv), "test-token")
+	require.NoError(t, err)
+	defer wsc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = wsc.ListAreas(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestWSClient_APIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.WriteJSON(map[string]string{"type": "auth_required"})
+		var authMsg map[string]string
+		_ = conn.ReadJSON(&authMsg)
+		_ = conn.WriteJSON(map[string]string{"type": "auth_ok"})
+		var cmd client.WSMessage
+		_ = conn.ReadJSON(&cmd)
+		_ = conn.WriteJSON(map[string]interface{}{
+			"id": cmd.ID, "type": "result", "success": false,
+			"error": map[string]string{"code": "not_found", "message": "Entity not found"},
+		})
+	}))
+	defer srv.Close()
+
+	wsc, err := client.NewWSClient(context.Background(), wsURL(srv), "test-token")
+	require.NoError(t, err)
+	defer wsc.Close()
+
+	_, err = wsc.GetEntity(context.Background(), "light.nope")
+	var apiErr *client.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, client.CodeNotFound, apiErr.Code)
+	assert.Equal(t, "config/entity_registry/get", apiErr.Request)
+	assert.ErrorIs(t, err, client.ErrNotFound)
+}
+
+func TestWSClient_AuthInvalid(t *testing.T) {
+	srv := mockWSServer(t, "right-token", "config/area_registry/list", nil)
+	defer srv.Close()
+
+	_, err := client.NewWSClient(context.Background(), wsURL(srv), "wrong-token")
+	var apiErr *client.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, client.CodeAuthInvalid, apiErr.Code)
+}
+
+func TestCreateLongLivedToken(t *testing.T) {
+	srv := mockWSServer(t, "test-token", "auth/long_lived_access_token", "abc.def.ghi")
+	defer srv.Close()
+
+	wsc, err := client.NewWSClient(context.Background(), wsURL(srv), "test-token")
+	require.NoError(t, err)
+	defer wsc.Close()
+
+	token, err := wsc.CreateLongLivedToken(context.Background(), "ci", 365)
+	require.NoError(t, err)
+	assert.Equal(t, "abc.def.ghi", token)
+}
@@ -1,129 +1,398 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"time"
 
 	"github.com/zalando/go-keyring"
-	"gopkg.in/yaml.v3"
 )
 
 const (
 	keychainService = "ha-client"
 	keychainServer  = "server"
 	keychainToken   = "token"
+	// keychainRefreshToken holds the refresh token from a username/password
+	// login, used instead of a long-lived token to obtain access tokens.
+	keychainRefreshToken = "refresh_token"
+
+	// DefaultContext is used when no context is selected. It always exists,
+	// even if the config file does not mention it, and its keychain entries keep
+	// the pre-contexts key names so that existing logins carry over.
+	DefaultContext = "default"
+
+	// SupervisorCoreURL is the Supervisor's proxy for Home Assistant Core, as
+	// seen from inside an add-on.
+	SupervisorCoreURL = "http://supervisor/core"
+
+	defaultServerCacheTTL = 5 * time.Minute
 )
 
+// Config is the resolved connection configuration for a single command.
 type Config struct {
-	Server string `yaml:"server"`
-	Token  string `yaml:"token"`
+	Context string
+	Server  string
+	Token   string
+
+	// RefreshToken is set for contexts logged in with a username and password.
+	// It is only used when no Token is configured.
+	RefreshToken string
+
+	// Servers are the candidate URLs, in order, when the context lists several.
+	// Server is the first of them until the caller has probed for a reachable
+	// one (see CachedServer/CacheServer).
+	Servers        []string
+	ServerCacheTTL time.Duration
+
+	// Supervisor is set when running inside an add-on and connecting through
+	// the Supervisor with SUPERVISOR_TOKEN, which also grants the Supervisor API.
+	Supervisor bool
+
+	Transport Transport
+
+	// tokenCommand is the token_command Token came from when its output is
+	// cached, and tokenCached whether Token was read from that cache rather
+	// than from running it (see ForgetCachedToken).
+	tokenCommand string
+	tokenCached  bool
 }
 
-// Resolve returns config using the full resolution chain:
-// CLI flags > env vars > OS keychain > config file
-func Resolve(serverFlag, tokenFlag string) (*Config, error) {
-	return ResolveWithFile(serverFlag, tokenFlag, DefaultConfigPath())
+// Overrides are per-invocation settings (CLI flags). Empty fields are unset.
+type Overrides struct {
+	Context    string
+	Server     string
+	Token      string
+	Supervisor bool // --supervisor: connect through the Supervisor regardless of other settings
+	Transport  Transport
 }
 
-func ResolveWithFile(serverFlag, tokenFlag, configFile string) (*Config, error) {
-	cfg := &Config{}
+// Resolve returns config using the full resolution chain. The context is
+// selected by --context > HASS_CONTEXT > current-context > "default"; then
+// within that context: CLI flags > env vars > credential helpers
+// (token_command, token_file, server_command) > OS keychain > config file.
+// If none of those yields a server or token and SUPERVISOR_TOKEN is set (as it
+// is inside an add-on), core is reached through the Supervisor.
+// Credential helpers are bound by ctx.
+func Resolve(ctx context.Context, o Overrides) (*Config, error) {
+	return ResolveWithFile(ctx, o, DefaultConfigPath())
+}
+
+func ResolveWithFile(ctx context.Context, o Overrides, configFile string) (*Config, error) {
+	file, err := LoadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	name := SelectContext(o.Context, file)
+	cfg := &Config{Context: name}
+
+	supervisorToken := os.Getenv("SUPERVISOR_TOKEN")
+	if o.Supervisor {
+		if supervisorToken == "" {
+			return nil, fmt.Errorf("--supervisor: SUPERVISOR_TOKEN is not set (is ha-client running inside an add-on?)")
+		}
+		// The context's settings are for its own server, but transport flags
+		// such as --header apply to whichever server is used.
+		cfg.Server, cfg.Token, cfg.Supervisor = SupervisorCoreURL, supervisorToken, true
+		cfg.Transport = cfg.Transport.Merge(o.Transport)
+		return cfg, nil
+	}
 
-	// Layer 4: config file (lowest priority)
-	if fileCfg, err := loadFile(configFile); err == nil {
-		cfg.Server = fileCfg.Server
-		cfg.Token = fileCfg.Token
+	// Layer 5: config file (lowest priority)
+	c := file.Context(name)
+	if c != nil {
+		cfg.Server = c.Server
+		cfg.Token = c.Token
+		cfg.RefreshToken = c.RefreshToken
+		cfg.Transport = c.Transport
+	} else if name != DefaultContext {
+		return nil, fmt.Errorf("context %q: %w (see 'ha-client config get-contexts')", name, ErrContextNotFound)
 	}
 
-	// Layer 3: OS keychain
-	if server, err := keyring.Get(keychainService, keychainServer); err == nil && server != "" {
+	// Layer 4: OS keychain
+	if server, err := keyring.Get(keychainService, keychainKey(name, keychainServer)); err == nil && server != "" {
 		cfg.Server = server
 	}
-	if token, err := keyring.Get(keychainService, keychainToken); err == nil && token != "" {
+	if token, err := keyring.Get(keychainService, keychainKey(name, keychainToken)); err == nil && token != "" {
 		cfg.Token = token
 	}
+	if token, err := keyring.Get(keychainService, keychainKey(name, keychainRefreshToken)); err == nil && token != "" {
+		cfg.RefreshToken = token
+	}
+	// A list of servers in the file outranks the single server login saved.
+	if c != nil && len(c.Servers) > 0 {
+		cfg.Server, cfg.Servers, cfg.ServerCacheTTL = c.Servers[0], c.Servers, defaultServerCacheTTL
+		if c.ServerCacheTTL != "" {
+			d, err := time.ParseDuration(c.ServerCacheTTL)
+			if err != nil {
+				return nil, fmt.Errorf("context %q: invalid server_cache_ttl %q: %w", name, c.ServerCacheTTL, err)
+			}
+			cfg.ServerCacheTTL = d
+		}
+	}
+
+	// Layer 3: credential helpers from the config file. They outrank stored
+	// credentials, but are not run at all when env vars or flags take over.
+	if c != nil {
+		if err := applyCredentialHelpers(ctx, cfg, c, o); err != nil {
+			return nil, fmt.Errorf("context %q: %w", name, err)
+		}
+	}
 
 	// Layer 2: environment variables
 	if v := os.Getenv("HASS_SERVER"); v != "" {
-		cfg.Server = v
+		cfg.Server, cfg.Servers = v, nil
 	}
 	if v := os.Getenv("HASS_TOKEN"); v != "" {
 		cfg.Token = v
 	}
 
 	// Layer 1: CLI flags (highest priority)
-	if serverFlag != "" {
-		cfg.Server = serverFlag
+	if o.Server != "" {
+		cfg.Server, cfg.Servers = o.Server, nil
 	}
-	if tokenFlag != "" {
-		cfg.Token = tokenFlag
+	if o.Token != "" {
+		cfg.Token = o.Token
+	}
+	cfg.Transport = cfg.Transport.Merge(o.Transport)
+
+	// Fallback: inside an add-on with nothing else configured.
+	if cfg.Server == "" && cfg.Token == "" && supervisorToken != "" {
+		cfg.Server, cfg.Token, cfg.Supervisor = SupervisorCoreURL, supervisorToken, true
 	}
 
 	return cfg, nil
 }
 
+// applyCredentialHelpers fills cfg from the context's server_command,
+// token_command or token_file, skipping any value an override will replace.
+func applyCredentialHelpers(ctx context.Context, cfg *Config, c *Context, o Overrides) error {
+	var ttl time.Duration
+	if c.CacheTTL != "" {
+		d, err := time.ParseDuration(c.CacheTTL)
+		if err != nil {
+			return fmt.Errorf("invalid cache_ttl %q: %w", c.CacheTTL, err)
+		}
+		ttl = d
+	}
+	if c.ServerCommand != "" && o.Server == "" && os.Getenv("HASS_SERVER") == "" {
+		server, _, err := runCredentialCommand(ctx, c.ServerCommand, ttl)
+		if err != nil {
+			return fmt.Errorf("server_command: %w", err)
+		}
+		cfg.Server, cfg.Servers = server, nil
+	}
+	if o.Token != "" || os.Getenv("HASS_TOKEN") != "" {
+		return nil
+	}
+	switch {
+	case c.TokenCommand != "":
+		token, cached, err := runCredentialCommand(ctx, c.TokenCommand, ttl)
+		if err != nil {
+			return fmt.Errorf("token_command: %w", err)
+		}
+		cfg.Token = token
+		if ttl > 0 {
+			cfg.tokenCommand, cfg.tokenCached = c.TokenCommand, cached
+		}
+	case c.TokenFile != "":
+		token, err := readTokenFile(c.TokenFile)
+		if err != nil {
+			return err
+		}
+		cfg.Token = token
+	}
+	return nil
+}
+
+// SelectContext returns the name of the context to use:
+// the override (--context) > HASS_CONTEXT > the file's current-context > "default".
+func SelectContext(override string, file *File) string {
+	if override != "" {
+		return override
+	}
+	if v := os.Getenv("HASS_CONTEXT"); v != "" {
+		return v
+	}
+	if file.CurrentContext != "" {
+		return file.CurrentContext
+	}
+	return DefaultContext
+}
+
 func (c *Config) Validate() error {
 	if c.Server == "" {
 		return fmt.Errorf("no server configured: use 'ha-client login', set HASS_SERVER, or use --server")
 	}
-	if c.Token == "" {
+	if c.Token == "" && c.RefreshToken == "" {
 		return fmt.Errorf("no token configured: use 'ha-client login', set HASS_TOKEN, or use --token")
 	}
 	return nil
 }
 
-// SaveToKeychain saves credentials to the OS keychain, falling back to the
-// config file if the keychain is unavailable (e.g. CI/headless environments).
-// The two writes are treated as all-or-nothing: if the token write fails after
-// the server write succeeded, we delete the server entry before falling back so
-// we never leave partial credentials in the keychain.
-func SaveToKeychain(server, token string) error {
-	if err := keyring.Set(keychainService, keychainServer, server); err != nil {
-		return SaveToFile(server, token, DefaultConfigPath())
+// keychainKey namespaces a keychain entry by context. The default context uses
+// the bare key so credentials stored before contexts existed still resolve.
+func keychainKey(context, key string) string {
+	if context == DefaultContext {
+		return key
 	}
-	if err := keyring.Set(keychainService, keychainToken, token); err != nil {
+	return context + "/" + key
+}
+
+// SaveToKeychain saves a context's credentials to the OS keychain and records
+// the context (without its token) in the config file, falling back to storing
+// the token in the file if the keychain is unavailable (e.g. CI/headless
+// environments). The two keychain writes are treated as all-or-nothing: if the
+// token write fails after the server write succeeded, we delete the server entry
+// before falling back so we never leave partial credentials in the keychain.
+// A refresh token stored by an earlier username/password login is discarded.
+func SaveToKeychain(context, server, token string) error {
+	return saveCredentials(context, server, keychainToken, token)
+}
+
+// SaveRefreshToken is SaveToKeychain for a refresh token obtained by logging in
+// with a username and password. It replaces any stored long-lived token.
+func SaveRefreshToken(context, server, refreshToken string) error {
+	return saveCredentials(context, server, keychainRefreshToken, refreshToken)
+}
+
+func saveCredentials(context, server, key, secret string) error {
+	path := DefaultConfigPath()
+	inFile := Context{Name: context, Server: server}
+	superseded := keychainRefreshToken
+	if key == keychainToken {
+		inFile.Token = secret
+	} else {
+		inFile.RefreshToken = secret
+		superseded = keychainToken
+	}
+	if err := keyring.Set(keychainService, keychainKey(context, keychainServer), server); err != nil {
+		return saveContextToFile(path, inFile)
+	}
+	if err := keyring.Set(keychainService, keychainKey(context, key), secret); err != nil {
 		// Roll back the server write so the keychain is not left half-populated.
-		_ = keyring.Delete(keychainService, keychainServer)
-		return SaveToFile(server, token, DefaultConfigPath())
+		_ = keyring.Delete(keychainService, keychainKey(context, keychainServer))
+		return saveContextToFile(path, inFile)
+	}
+	_ = keyring.Delete(keychainService, keychainKey(context, superseded))
+	// The secret lives in the keychain now; drop any stale copy from the file.
+	return saveContextToFile(path, Context{Name: context, Server: server})
+}
+
+// DeleteFromKeychain removes a context's stored credentials from the keychain
+// and the config file. The context itself stays defined. Safe to call when
+// already logged out.
+func DeleteFromKeychain(context string) error {
+	if err := DeleteKeychainEntries(context); err != nil {
+		return err
+	}
+	path := DefaultConfigPath()
+	file, err := LoadFile(path)
+	if err != nil {
+		return err
+	}
+	if c := file.Context(context); c != nil && (c.Token != "" || c.RefreshToken != "") {
+		c.Token, c.RefreshToken = "", ""
+		return file.Save(path)
 	}
 	return nil
 }
 
-// DeleteFromKeychain removes stored credentials. Safe to call when already logged out.
-func DeleteFromKeychain() error {
-	for _, key := range []string{keychainServer, keychainToken} {
-		if err := keyring.Delete(keychainService, key); err != nil && err != keyring.ErrNotFound {
+// keychainKeys are all the entries stored per context.
+var keychainKeys = []string{keychainServer, keychainToken, keychainRefreshToken}
+
+// KeychainCredentials reports whether the keychain holds credentials for a
+// context, and the server stored with them.
+func KeychainCredentials(context string) (server string, ok bool) {
+	for _, key := range keychainKeys {
+		v, err := keyring.Get(keychainService, keychainKey(context, key))
+		if err != nil || v == "" {
+			continue
+		}
+		ok = true
+		if key == keychainServer {
+			server = v
+		}
+	}
+	return server, ok
+}
+
+// Contexts returns the contexts defined in file, preceded by the default
+// context when it is defined only by a login saved in the keychain.
+func Contexts(file *File) []Context {
+	var contexts []Context
+	if file.Context(DefaultContext) == nil {
+		if server, ok := KeychainCredentials(DefaultContext); ok {
+			contexts = append(contexts, Context{Name: DefaultContext, Server: server})
+		}
+	}
+	return append(contexts, file.Contexts...)
+}
+
+// UpdateKeychainServer replaces the server stored in the keychain for a
+// context, so that it does not shadow a server changed in the config file.
+// Contexts with no server in the keychain are left alone.
+func UpdateKeychainServer(context, server string) error {
+	key := keychainKey(context, keychainServer)
+	if _, err := keyring.Get(keychainService, key); err != nil {
+		// Not found, or no usable keychain: nothing to shadow the file.
+		return nil
+	}
+	return keyring.Set(keychainService, key, server)
+}
+
+// RenameKeychainEntries moves a context's keychain entries to a new name.
+func RenameKeychainEntries(oldName, newName string) error {
+	for _, key := range keychainKeys {
+		v, err := keyring.Get(keychainService, keychainKey(oldName, key))
+		if err == keyring.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			// No usable keychain: nothing can have been stored there.
+			return nil
+		}
+		if err := keyring.Set(keychainService, keychainKey(newName, key), v); err != nil {
 			return err
 		}
 	}
-	// Also clear config file (ignore missing file)
-	_ = os.Remove(DefaultConfigPath())
-	return nil
+	return DeleteKeychainEntries(oldName)
 }
 
-func SaveToFile(server, token, path string) error {
-	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
-		return err
+// DeleteKeychainEntries removes a context's keychain entries, if any.
+func DeleteKeychainEntries(context string) error {
+	for _, key := range keychainKeys {
+		if err := keyring.Delete(keychainService, keychainKey(context, key)); err != nil && err != keyring.ErrNotFound {
+			return err
+		}
 	}
-	cfg := Config{Server: server, Token: token}
-	data, err := yaml.Marshal(cfg)
+	return nil
+}
+
+// saveContextToFile upserts a context's server and tokens in the config file,
+// keeping any other settings (such as credential helpers) it already has.
+func saveContextToFile(path string, c Context) error {
+	file, err := LoadFile(path)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, data, 0600)
+	if existing := file.Context(c.Name); existing != nil {
+		existing.Server, existing.Token, existing.RefreshToken = c.Server, c.Token, c.RefreshToken
+	} else {
+		file.SetContext(c)
+	}
+	return file.Save(path)
 }
 
-func loadFile(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, err
+// AuditLogPath returns the audit log's path: the file's audit_log, or
+// audit.log in the config directory.
+func (f *File) AuditLogPath() string {
+	if f.AuditLog != "" {
+		return f.AuditLog
 	}
-	return &cfg, nil
+	return filepath.Join(filepath.Dir(DefaultConfigPath()), "audit.log")
 }
 
 func DefaultConfigPath() string {
@@ -1,8 +1,10 @@
 package config_test
 
 import (
+	"context"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/rnorth/ha-client/internal/config"
 	"github.com/stretchr/testify/assert"
@@ -14,7 +16,7 @@ func TestFlagsTakePriority(t *testing.T) {
 	t.Setenv("HASS_SERVER", "http://from-env:8123")
 	t.Setenv("HASS_TOKEN", "env-token")
 
-	cfg, err := config.Resolve("http://from-flags:8123", "flag-token")
+	cfg, err := config.Resolve(context.Background(), config.Overrides{Server: "http://from-flags:8123", Token: "flag-token"})
 	require.NoError(t, err)
 	assert.Equal(t, "http://from-flags:8123", cfg.Server)
 	assert.Equal(t, "flag-token", cfg.Token)
@@ -24,7 +26,7 @@ func TestEnvVarsFallback(t *testing.T) {
 	t.Setenv("HASS_SERVER", "http://from-env:8123")
 	t.Setenv("HASS_TOKEN", "env-token")
 
-	cfg, err := config.Resolve("", "")
+	cfg, err := config.Resolve(context.Background(), config.Overrides{})
 	require.NoError(t, err)
 	assert.Equal(t, "http://from-env:8123", cfg.Server)
 	assert.Equal(t, "env-token", cfg.Token)
@@ -34,7 +36,7 @@ func TestPartialFlagOverride(t *testing.T) {
 	t.Setenv("HASS_SERVER", "http://from-env:8123")
 	t.Setenv("HASS_TOKEN", "env-token")
 
-	cfg, err := config.Resolve("http://override:8123", "")
+	cfg, err := config.Resolve(context.Background(), config.Overrides{Server: "http://override:8123"})
 	require.NoError(t, err)
 	assert.Equal(t, "http://override:8123", cfg.Server)
 	assert.Equal(t, "env-token", cfg.Token)
@@ -55,8 +57,303 @@ func TestConfigFileFallback(t *testing.T) {
 	err := os.WriteFile(cfgFile, []byte("server: http://from-file:8123\ntoken: file-token\n"), 0600)
 	require.NoError(t, err)
 
-	cfg, err := config.ResolveWithFile("", "", cfgFile)
+	cfg, err := config.ResolveWithFile(context.Background(), config.Overrides{}, cfgFile)
 	require.NoError(t, err)
 	assert.Equal(t, "http://from-file:8123", cfg.Server)
 	assert.Equal(t, "file-token", cfg.Token)
 }
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := t.TempDir() + "/config.yaml"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+const multiContextYAML = `current-context: home
+contexts:
+  - name: home
+    server: http://home:8123
+    token: home-token
+  - name: cabin
+    server: http://cabin:8123
+    token: cabin-token
+`
+
+func TestContextSelection(t *testing.T) {
+	keyring.MockInit()
+	t.Setenv("HASS_SERVER", "")
+	t.Setenv("HASS_TOKEN", "")
+	path := writeConfig(t, multiContextYAML)
+
+	t.Run("current-context", func(t *testing.T) {
+		t.Setenv("HASS_CONTEXT", "")
+		cfg, err := config.ResolveWithFile(context.Background(), config.Overrides{}, path)
+		require.NoError(t, err)
+		assert.Equal(t, "home", cfg.Context)
+		assert.Equal(t, "http://home:8123", cfg.Server)
+		assert.Equal(t, "home-token", cfg.Token)
+	})
+
+	t.Run("env beats current-context", func(t *testing.T) {
+		t.Setenv("HASS_CONTEXT", "cabin")
+		cfg, err := config.ResolveWithFile(context.Background(), config.Overrides{}, path)
+		require.NoError(t, err)
+		assert.Equal(t, "cabin", cfg.Context)
+		assert.Equal(t, "http://cabin:8123", cfg.Server)
+	})
+
+	t.Run("flag beats env", func(t *testing.T) {
+		t.Setenv("HASS_CONTEXT", "cabin")
+		cfg, err := config.ResolveWithFile(context.Background(), config.Overrides{Context: "home"}, path)
+		require.NoError(t, err)
+		assert.Equal(t, "home", cfg.Context)
+	})
+
+	t.Run("unknown context", func(t *testing.T) {
+		t.Setenv("HASS_CONTEXT", "")
+		_, err := config.ResolveWithFile(context.Background(), config.Overrides{Context: "office"}, path)
+		assert.ErrorIs(t, err, config.ErrContextNotFound)
+	})
+
+	t.Run("resolution order applies within the context", func(t *testing.T) {
+		t.Setenv("HASS_CONTEXT", "")
+		t.Setenv("HASS_TOKEN", "env-token")
+		cfg, err := config.ResolveWithFile(context.Background(), config.Overrides{Context: "cabin"}, path)
+		require.NoError(t, err)
+		assert.Equal(t, "http://cabin:8123", cfg.Server)
+		assert.Equal(t, "env-token", cfg.Token)
+	})
+}
+
+func TestKeychainIsPerContext(t *testing.T) {
+	keyring.MockInit()
+	t.Setenv("HASS_SERVER", "")
+	t.Setenv("HASS_TOKEN", "")
+	t.Setenv("HASS_CONTEXT", "")
+	path := writeConfig(t, multiContextYAML)
+
+	require.NoError(t, keyring.Set("ha-client", "cabin/token", "keychain-cabin-token"))
+	require.NoError(t, keyring.Set("ha-client", "token", "keychain-default-token"))
+
+	cabin, err := config.ResolveWithFile(context.Background(), config.Overrides{Context: "cabin"}, path)
+	require.NoError(t, err)
+	assert.Equal(t, "keychain-cabin-token", cabin.Token)
+
+	home, err := config.ResolveWithFile(context.Background(), config.Overrides{Context: "home"}, path)
+	require.NoError(t, err)
+	assert.Equal(t, "home-token", home.Token, "another context's keychain entry must not leak")
+
+	def, err := config.ResolveWithFile(context.Background(), config.Overrides{Context: config.DefaultContext}, path)
+	require.NoError(t, err)
+	assert.Equal(t, "keychain-default-token", def.Token, "default context uses the pre-contexts keychain keys")
+}
+
+func TestCredentialHelpers(t *testing.T) {
+	keyring.MockInit()
+	t.Setenv("HASS_SERVER", "")
+	t.Setenv("HASS_TOKEN", "")
+	t.Setenv("HASS_CONTEXT", "")
+	cacheDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheDir)
+	dir := t.TempDir()
+	counter := dir + "/runs"
+
+	require.NoError(t, keyring.Set("ha-client", "vault/token", "stale-keychain-token"))
+	tokenFile := dir + "/token"
+	require.NoError(t, os.WriteFile(tokenFile, []byte("file-token-1\n"), 0600))
+
+	path := writeConfig(t, `contexts:
+  - name: vault
+    server_command: echo http://vault:8123
+    token_command: echo x >> `+counter+`; echo vault-token
+    cache_ttl: 1h
+  - name: secret
+    server: http://secret:8123
+    token_file: `+tokenFile+`
+  - name: broken
+    server: http://broken:8123
+    token_command: echo locked >&2; exit 3
+  - name: hung
+    server: http://hung:8123
+    token_command: sleep 10
+`)
+
+	t.Run("token_command beats keychain and is cached", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			cfg, err := config.ResolveWithFile(context.Background(), config.Overrides{Context: "vault"}, path)
+			require.NoError(t, err)
+			assert.Equal(t, "http://vault:8123", cfg.Server)
+			assert.Equal(t, "vault-token", cfg.Token)
+		}
+		runs, err := os.ReadFile(counter)
+		require.NoError(t, err)
+		assert.Equal(t, "x\n", string(runs), "second resolve should use the cache")
+		assert.NoDirExists(t, cacheDir+"/ha-client/credentials", "helper output is not cached on disk")
+	})
+
+	t.Run("token_command is bound by ctx", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := config.ResolveWithFile(ctx, config.Overrides{Context: "hung"}, path)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("env var skips token_command", func(t *testing.T) {
+		t.Setenv("HASS_TOKEN", "env-token")
+		cfg, err := config.ResolveWithFile(context.Background(), config.Overrides{Context: "broken"}, path)
+		require.NoError(t, err)
+		assert.Equal(t, "env-token", cfg.Token)
+	})
+
+	t.Run("command failure", func(t *testing.T) {
+		_, err := config.ResolveWithFile(context.Background(), config.Overrides{Context: "broken"}, path)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "token_command")
+		assert.Contains(t, err.Error(), "locked")
+	})
+
+	t.Run("token_file is re-read each run", func(t *testing.T) {
+		cfg, err := config.ResolveWithFile(context.Background(), config.Overrides{Context: "secret"}, path)
+		require.NoError(t, err)
+		assert.Equal(t, "file-token-1", cfg.Token)
+
+		require.NoError(t, os.WriteFile(tokenFile, []byte("file-token-2"), 0600))
+		cfg, err = config.ResolveWithFile(context.Background(), config.Overrides{Context: "secret"}, path)
+		require.NoError(t, err)
+		assert.Equal(t, "file-token-2", cfg.Token)
+	})
+}
+
+func TestSupervisorFallback(t *testing.T) {
+	keyring.MockInit()
+	t.Setenv("HASS_SERVER", "")
+	t.Setenv("HASS_TOKEN", "")
+	t.Setenv("HASS_CONTEXT", "")
+	t.Setenv("SUPERVISOR_TOKEN", "supervisor-token")
+	empty := writeConfig(t, "")
+
+	t.Run("used when nothing is configured", func(t *testing.T) {
+		cfg, err := config.ResolveWithFile(context.Background(), config.Overrides{}, empty)
+		require.NoError(t, err)
+		assert.True(t, cfg.Supervisor)
+		assert.Equal(t, config.SupervisorCoreURL, cfg.Server)
+		assert.Equal(t, "supervisor-token", cfg.Token)
+	})
+
+	t.Run("configured credentials win", func(t *testing.T) {
+		cfg, err := config.ResolveWithFile(context.Background(), config.Overrides{}, writeConfig(t, multiContextYAML))
+		require.NoError(t, err)
+		assert.False(t, cfg.Supervisor)
+		assert.Equal(t, "http://home:8123", cfg.Server)
+	})
+
+	t.Run("--supervisor forces it", func(t *testing.T) {
+		cfg, err := config.ResolveWithFile(context.Background(), config.Overrides{Supervisor: true}, writeConfig(t, multiContextYAML))
+		require.NoError(t, err)
+		assert.True(t, cfg.Supervisor)
+		assert.Equal(t, config.SupervisorCoreURL, cfg.Server)
+	})
+
+	t.Run("--supervisor keeps transport flags", func(t *testing.T) {
+		o := config.Overrides{Supervisor: true, Transport: config.Transport{InsecureSkipTLSVerify: true, Headers: map[string]string{"X-Trace": "1"}}}
+		cfg, err := config.ResolveWithFile(context.Background(), o, empty)
+		require.NoError(t, err)
+		assert.True(t, cfg.Transport.InsecureSkipTLSVerify)
+		assert.Equal(t, map[string]string{"X-Trace": "1"}, cfg.Transport.Headers)
+	})
+
+	t.Run("--supervisor outside an add-on", func(t *testing.T) {
+		t.Setenv("SUPERVISOR_TOKEN", "")
+		_, err := config.ResolveWithFile(context.Background(), config.Overrides{Supervisor: true}, empty)
+		assert.ErrorContains(t, err, "SUPERVISOR_TOKEN")
+	})
+}
+
+func TestTransportSettings(t *testing.T) {
+	keyring.MockInit()
+	t.Setenv("HASS_SERVER", "")
+	t.Setenv("HASS_TOKEN", "")
+	t.Setenv("HASS_CONTEXT", "")
+	path := writeConfig(t, `contexts:
+  - name: office
+    server: https://ha.office.internal
+    token: office-token
+    certificate_authority: /etc/office-ca.pem
+    client_certificate: /etc/client.pem
+    client_key: /etc/client-key.pem
+    proxy_url: http://proxy.office:3128
+    headers:
+      CF-Access-Client-Id: abc
+      CF-Access-Client-Secret: s3cret
+`)
+
+	cfg, err := config.ResolveWithFile(context.Background(), config.Overrides{Context: "office"}, path)
+	require.NoError(t, err)
+	assert.Equal(t, "/etc/office-ca.pem", cfg.Transport.CertificateAuthority)
+	assert.Equal(t, "/etc/client-key.pem", cfg.Transport.ClientKey)
+	assert.Equal(t, "http://proxy.office:3128", cfg.Transport.ProxyURL)
+	assert.Equal(t, "abc", cfg.Transport.Headers["CF-Access-Client-Id"])
+
+	cfg, err = config.ResolveWithFile(context.Background(), config.Overrides{Context: "office", Transport: config.Transport{
+		ProxyURL:              "http://other:8080",
+		InsecureSkipTLSVerify: true,
+		Headers:               map[string]string{"CF-Access-Client-Secret": "rotated"},
+	}}, path)
+	require.NoError(t, err)
+	assert.Equal(t, "http://other:8080", cfg.Transport.ProxyURL, "flags override the config")
+	assert.True(t, cfg.Transport.InsecureSkipTLSVerify)
+	assert.Equal(t, "/etc/office-ca.pem", cfg.Transport.CertificateAuthority, "unset flags leave the config alone")
+	assert.Equal(t, map[string]string{"CF-Access-Client-Id": "abc", "CF-Access-Client-Secret": "rotated"}, cfg.Transport.Headers)
+}
+
+func TestServersList(t *testing.T) {
+	keyring.MockInit()
+	t.Setenv("HASS_SERVER", "")
+	t.Setenv("HASS_TOKEN", "")
+	t.Setenv("HASS_CONTEXT", "")
+	path := writeConfig(t, `contexts:
+  - name: default
+    token: t
+    servers: [http://homeassistant.local:8123, https://example.ui.nabu.casa]
+    server_cache_ttl: 1h
+`)
+	require.NoError(t, keyring.Set("ha-client", "server", "http://from-login:8123"))
+
+	cfg, err := config.ResolveWithFile(context.Background(), config.Overrides{}, path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://homeassistant.local:8123", "https://example.ui.nabu.casa"}, cfg.Servers)
+	assert.Equal(t, "http://homeassistant.local:8123", cfg.Server, "servers outrank the keychain server")
+	assert.Equal(t, time.Hour, cfg.ServerCacheTTL)
+
+	t.Setenv("HASS_SERVER", "http://explicit:8123")
+	cfg, err = config.ResolveWithFile(context.Background(), config.Overrides{}, path)
+	require.NoError(t, err)
+	assert.Equal(t, "http://explicit:8123", cfg.Server)
+	assert.Empty(t, cfg.Servers, "an explicit server disables failover")
+}
+
+func TestRefreshToken(t *testing.T) {
+	keyring.MockInit()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("HASS_SERVER", "")
+	t.Setenv("HASS_TOKEN", "")
+	t.Setenv("HASS_CONTEXT", "")
+	t.Setenv("SUPERVISOR_TOKEN", "")
+
+	require.NoError(t, config.SaveToKeychain("cabin", "http://cabin:8123", "long-lived"))
+	require.NoError(t, config.SaveRefreshToken("cabin", "http://cabin:8123", "refresh-1"))
+
+	cfg, err := config.Resolve(context.Background(), config.Overrides{Context: "cabin"})
+	require.NoError(t, err)
+	assert.Equal(t, "refresh-1", cfg.RefreshToken)
+	assert.Empty(t, cfg.Token, "a password login replaces the long-lived token")
+	assert.NoError(t, cfg.Validate())
+
+	require.NoError(t, config.DeleteFromKeychain("cabin"))
+	cfg, err = config.Resolve(context.Background(), config.Overrides{Context: "cabin"})
+	require.NoError(t, err)
+	assert.Empty(t, cfg.RefreshToken)
+}
@@ -0,0 +1,202 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrContextNotFound is returned when a named context is not in the config file.
+var ErrContextNotFound = errors.New("context not found")
+
+// File is the on-disk layout of config.yaml.
+type File struct {
+	CurrentContext string    `yaml:"current-context,omitempty"`
+	Contexts       []Context `yaml:"contexts,omitempty"`
+
+	// Policy applies to every context.
+	Policy *Policy `yaml:"policy,omitempty"`
+
+	// AuditLog is where changes made to Home Assistant are logged; by default
+	// audit.log next to this file.
+	AuditLog string `yaml:"audit_log,omitempty"`
+
+	// Server and Token are the single-instance layout written before contexts
+	// existed. LoadFile moves them into the "default" context, so they are
+	// never written back.
+	Server string `yaml:"server,omitempty"`
+	Token  string `yaml:"token,omitempty"`
+}
+
+// Context is one named Home Assistant instance.
+type Context struct {
+	Name   string `yaml:"name"`
+	Server string `yaml:"server,omitempty"`
+	Token  string `yaml:"token,omitempty"`
+	// RefreshToken is only written here when the keychain is unavailable.
+	RefreshToken string `yaml:"refresh_token,omitempty"`
+
+	// Servers lists alternative URLs for the same instance (e.g. LAN first,
+	// then remote) in order of preference. The first reachable one is used and
+	// remembered for ServerCacheTTL (default 5m).
+	Servers        []string `yaml:"servers,omitempty"`
+	ServerCacheTTL string   `yaml:"server_cache_ttl,omitempty"`
+
+	// Credential helpers, for tokens kept in a vault or mounted as a secret.
+	// The commands are run with the shell and their trimmed stdout is used;
+	// CacheTTL (e.g. "15m") caches their output between runs.
+	ServerCommand string `yaml:"server_command,omitempty"`
+	TokenCommand  string `yaml:"token_command,omitempty"`
+	TokenFile     string `yaml:"token_file,omitempty"`
+	CacheTTL      string `yaml:"cache_ttl,omitempty"`
+
+	// Policy applies to this context, on top of the file's.
+	Policy *Policy `yaml:"policy,omitempty"`
+
+	Transport `yaml:",inline"`
+}
+
+// Transport holds how to reach a server: TLS trust and client certificates,
+// an HTTP proxy, extra headers, and how often to retry. It applies to REST and
+// WebSocket alike.
+type Transport struct {
+	CertificateAuthority  string            `yaml:"certificate_authority,omitempty"`
+	ClientCertificate     string            `yaml:"client_certificate,omitempty"`
+	ClientKey             string            `yaml:"client_key,omitempty"`
+	InsecureSkipTLSVerify bool              `yaml:"insecure_skip_tls_verify,omitempty"`
+	ProxyURL              string            `yaml:"proxy_url,omitempty"`
+	Headers               map[string]string `yaml:"headers,omitempty"`
+	// Retries is how often a failed read (or, with --retry-actions, an action
+	// call) is retried; nil means the built-in default of none.
+	Retries *int `yaml:"retries,omitempty"`
+}
+
+// Merge overlays the fields set in o onto t. Headers are merged by name.
+func (t Transport) Merge(o Transport) Transport {
+	if o.CertificateAuthority != "" {
+		t.CertificateAuthority = o.CertificateAuthority
+	}
+	if o.ClientCertificate != "" {
+		t.ClientCertificate = o.ClientCertificate
+	}
+	if o.ClientKey != "" {
+		t.ClientKey = o.ClientKey
+	}
+	if o.InsecureSkipTLSVerify {
+		t.InsecureSkipTLSVerify = true
+	}
+	if o.ProxyURL != "" {
+		t.ProxyURL = o.ProxyURL
+	}
+	if len(o.Headers) > 0 {
+		merged := make(map[string]string, len(t.Headers)+len(o.Headers))
+		for k, v := range t.Headers {
+			merged[k] = v
+		}
+		for k, v := range o.Headers {
+			merged[k] = v
+		}
+		t.Headers = merged
+	}
+	if o.Retries != nil {
+		t.Retries = o.Retries
+	}
+	return t
+}
+
+// LoadFile reads a config file. A missing file is not an error: it yields an
+// empty File so that callers can populate and save it.
+func LoadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &File{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f File
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if f.Policy != nil {
+		if err := f.Policy.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	for _, c := range f.Contexts {
+		if c.Policy != nil {
+			if err := c.Policy.Validate(); err != nil {
+				return nil, fmt.Errorf("%s: context %q: %w", path, c.Name, err)
+			}
+		}
+	}
+	if (f.Server != "" || f.Token != "") && f.Context(DefaultContext) == nil {
+		f.Contexts = append(f.Contexts, Context{Name: DefaultContext, Server: f.Server, Token: f.Token})
+	}
+	f.Server, f.Token = "", ""
+	return &f, nil
+}
+
+// Save writes the file with owner-only permissions, since it may hold tokens.
+func (f *File) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(f)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// Context returns the named context, or nil if there is none.
+func (f *File) Context(name string) *Context {
+	for i := range f.Contexts {
+		if f.Contexts[i].Name == name {
+			return &f.Contexts[i]
+		}
+	}
+	return nil
+}
+
+// SetContext adds c, or replaces the context with the same name.
+func (f *File) SetContext(c Context) {
+	if existing := f.Context(c.Name); existing != nil {
+		*existing = c
+		return
+	}
+	f.Contexts = append(f.Contexts, c)
+}
+
+// RenameContext renames a context, following it with current-context.
+func (f *File) RenameContext(oldName, newName string) error {
+	c := f.Context(oldName)
+	if c == nil {
+		return fmt.Errorf("context %q: %w", oldName, ErrContextNotFound)
+	}
+	if f.Context(newName) != nil {
+		return fmt.Errorf("context %q already exists", newName)
+	}
+	c.Name = newName
+	if f.CurrentContext == oldName {
+		f.CurrentContext = newName
+	}
+	return nil
+}
+
+// DeleteContext removes a context. If it was current, no context is current afterwards.
+func (f *File) DeleteContext(name string) error {
+	for i := range f.Contexts {
+		if f.Contexts[i].Name == name {
+			f.Contexts = append(f.Contexts[:i], f.Contexts[i+1:]...)
+			if f.CurrentContext == name {
+				f.CurrentContext = ""
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("context %q: %w", name, ErrContextNotFound)
+}
@@ -0,0 +1,59 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rnorth/ha-client/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadFile_Missing(t *testing.T) {
+	f, err := config.LoadFile(filepath.Join(t.TempDir(), "nope.yaml"))
+	require.NoError(t, err)
+	assert.Empty(t, f.Contexts)
+}
+
+func TestLoadFile_MigratesLegacyLayout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("server: http://old:8123\ntoken: old-token\n"), 0600))
+
+	f, err := config.LoadFile(path)
+	require.NoError(t, err)
+	c := f.Context(config.DefaultContext)
+	require.NotNil(t, c)
+	assert.Equal(t, "http://old:8123", c.Server)
+	assert.Equal(t, "old-token", c.Token)
+
+	require.NoError(t, f.Save(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "\nserver:", "legacy top-level keys are not written back")
+	assert.Contains(t, string(data), "name: default")
+}
+
+func TestFile_RenameAndDeleteContext(t *testing.T) {
+	f := &config.File{CurrentContext: "home"}
+	f.SetContext(config.Context{Name: "home", Server: "http://home:8123"})
+	f.SetContext(config.Context{Name: "cabin", Server: "http://cabin:8123"})
+
+	require.NoError(t, f.RenameContext("home", "house"))
+	assert.Equal(t, "house", f.CurrentContext)
+	assert.Nil(t, f.Context("home"))
+	assert.Error(t, f.RenameContext("house", "cabin"), "cannot rename onto an existing context")
+
+	require.NoError(t, f.DeleteContext("house"))
+	assert.Empty(t, f.CurrentContext)
+	assert.Len(t, f.Contexts, 1)
+	assert.ErrorIs(t, f.DeleteContext("house"), config.ErrContextNotFound)
+}
+
+func TestFile_SetContextReplaces(t *testing.T) {
+	f := &config.File{}
+	f.SetContext(config.Context{Name: "home", Server: "http://a"})
+	f.SetContext(config.Context{Name: "home", Server: "http://b"})
+	require.Len(t, f.Contexts, 1)
+	assert.Equal(t, "http://b", f.Contexts[0].Server)
+}
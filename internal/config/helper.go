@@ -0,0 +1,191 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+// cachedCredential is a cached credential helper output, kept in the OS
+// keychain, or a selected server URL, kept on disk.
+type cachedCredential struct {
+	Value   string    `json:"value"`
+	Expires time.Time `json:"expires"`
+}
+
+// runCredentialCommand runs a token_command/server_command and returns its
+// trimmed stdout. The command is killed if ctx is done first. With a positive
+// ttl the result is cached in the OS keychain, keyed by the command itself so
+// that editing the command invalidates the cache; helper output is never
+// written to disk, so without a usable keychain the command runs every time.
+// cached reports whether the value came from the cache rather than the command.
+func runCredentialCommand(ctx context.Context, command string, ttl time.Duration) (v string, cached bool, err error) {
+	if ttl > 0 {
+		if data, err := keyring.Get(keychainService, helperCacheKey(command)); err == nil {
+			var c cachedCredential
+			if json.Unmarshal([]byte(data), &c) == nil && c.Value != "" && time.Now().Before(c.Expires) {
+				return c.Value, true, nil
+			}
+		}
+	}
+
+	var c *exec.Cmd
+	if runtime.GOOS == "windows" {
+		c = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		c = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	var stdout, stderr bytes.Buffer
+	c.Stdout, c.Stderr = &stdout, &stderr
+	c.Stdin = os.Stdin // helpers may prompt, e.g. to unlock a vault
+	// Killing the shell leaves its children holding stdout open; stop waiting
+	// for them shortly after.
+	c.WaitDelay = time.Second
+	if err := c.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", false, fmt.Errorf("running %q: %w", command, ctxErr)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", false, fmt.Errorf("running %q: %w: %s", command, err, msg)
+		}
+		return "", false, fmt.Errorf("running %q: %w", command, err)
+	}
+	v = strings.TrimSpace(stdout.String())
+	if v == "" {
+		return "", false, fmt.Errorf("running %q: no output", command)
+	}
+
+	if ttl > 0 {
+		// A cache write failure only costs a re-run next time.
+		if data, err := json.Marshal(cachedCredential{Value: v, Expires: time.Now().Add(ttl)}); err == nil {
+			_ = keyring.Set(keychainService, helperCacheKey(command), string(data))
+		}
+	}
+	return v, false, nil
+}
+
+// helperCacheKey is the keychain entry caching the output of command.
+func helperCacheKey(command string) string {
+	return "cache/" + hashKey(command)
+}
+
+// ForgetCachedToken drops the cached token_command output cfg.Token came from,
+// e.g. because the server rejected it, so that the command is run again next
+// time. It reports whether cfg.Token was read from the cache, in which case
+// running the command now may give a token that is accepted.
+func ForgetCachedToken(cfg *Config) bool {
+	if cfg.tokenCommand == "" {
+		return false
+	}
+	_ = keyring.Delete(keychainService, helperCacheKey(cfg.tokenCommand))
+	return cfg.tokenCached
+}
+
+// readTokenFile returns the trimmed contents of a token_file. It is read on
+// every run so that rotated secrets are picked up.
+func readTokenFile(path string) (string, error) {
+	if strings.HasPrefix(path, "~/") {
+		home, _ := os.UserHomeDir()
+		path = filepath.Join(home, path[2:])
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading token_file: %w", err)
+	}
+	v := strings.TrimSpace(string(data))
+	if v == "" {
+		return "", fmt.Errorf("token_file %s is empty", path)
+	}
+	return v, nil
+}
+
+// cacheFile returns the path of a cache entry, named by a hash of key, or ""
+// if there is no user cache directory.
+func cacheFile(kind, key string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ha-client", kind, hashKey(key)+".json")
+}
+
+// hashKey returns a short hash of key for naming cache entries.
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// serverCacheKey identifies a context's list of server URLs, so that editing
+// the list invalidates the cached selection.
+func serverCacheKey(cfg *Config) string {
+	return cfg.Context + "\n" + strings.Join(cfg.Servers, "\n")
+}
+
+// CachedServer returns the URL previously selected from cfg.Servers, if that
+// selection has not expired.
+func CachedServer(cfg *Config) (string, bool) {
+	path := cacheFile("servers", serverCacheKey(cfg))
+	if path == "" {
+		return "", false
+	}
+	return readCachedCredential(path)
+}
+
+// CacheServer records the URL selected from cfg.Servers for cfg.ServerCacheTTL.
+func CacheServer(cfg *Config, server string) error {
+	path := cacheFile("servers", serverCacheKey(cfg))
+	if path == "" || cfg.ServerCacheTTL <= 0 {
+		return nil
+	}
+	return writeCachedCredential(path, cachedCredential{Value: server, Expires: time.Now().Add(cfg.ServerCacheTTL)})
+}
+
+// ForgetServer drops the URL selected from cfg.Servers, e.g. because it has
+// stopped answering.
+func ForgetServer(cfg *Config) error {
+	path := cacheFile("servers", serverCacheKey(cfg))
+	if path == "" {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func readCachedCredential(path string) (string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	var c cachedCredential
+	if json.Unmarshal(data, &c) != nil || c.Value == "" || time.Now().After(c.Expires) {
+		return "", false
+	}
+	return c.Value, true
+}
+
+// writeCachedCredential stores a cache entry with owner-only permissions.
+func writeCachedCredential(path string, c cachedCredential) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrPolicyDenied is returned when a policy forbids a command, an action or an
+// entity.
+var ErrPolicyDenied = errors.New("denied by policy")
+
+// Policy restricts what ha-client may do, for handing it to agents and scripts.
+// Actions ("light.turn_on") and entity IDs are matched against glob patterns
+// such as "lock.*". A deny pattern always wins; a non-empty allow list denies
+// everything it does not match.
+type Policy struct {
+	// ReadOnly denies every command that changes Home Assistant. Dry runs are
+	// still allowed.
+	ReadOnly bool `yaml:"read_only,omitempty"`
+
+	AllowActions  []string `yaml:"allow_actions,omitempty"`
+	DenyActions   []string `yaml:"deny_actions,omitempty"`
+	AllowEntities []string `yaml:"allow_entities,omitempty"`
+	DenyEntities  []string `yaml:"deny_entities,omitempty"`
+
+	// DenyCommands lists commands by name, e.g. "state set" or "area delete".
+	// A group such as "supervisor" denies all of its subcommands.
+	DenyCommands []string `yaml:"deny_commands,omitempty"`
+}
+
+// LoadPolicy reads a policy file (the --policy flag).
+func LoadPolicy(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var p Policy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", file, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return &p, nil
+}
+
+// Validate checks that every pattern is a valid glob.
+func (p *Policy) Validate() error {
+	for key, patterns := range map[string][]string{
+		"allow_actions":  p.AllowActions,
+		"deny_actions":   p.DenyActions,
+		"allow_entities": p.AllowEntities,
+		"deny_entities":  p.DenyEntities,
+	} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("policy %s: invalid pattern %q", key, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// Policies are all the policies in force. A request must satisfy each one, so
+// a policy given with --policy can add restrictions but never lift them.
+type Policies []Policy
+
+// Policies returns the config file's policy and the context's, if any.
+func (f *File) Policies(context string) Policies {
+	var ps Policies
+	if f.Policy != nil {
+		ps = append(ps, *f.Policy)
+	}
+	if c := f.Context(context); c != nil && c.Policy != nil {
+		ps = append(ps, *c.Policy)
+	}
+	return ps
+}
+
+// HasEntityRules reports whether any policy restricts entities.
+func (ps Policies) HasEntityRules() bool {
+	for _, p := range ps {
+		if len(p.AllowEntities)+len(p.DenyEntities) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckCommand checks a command by name ("state set"); mutates is whether this
+// invocation would change Home Assistant.
+func (ps Policies) CheckCommand(name string, mutates bool) error {
+	for _, p := range ps {
+		if mutates && p.ReadOnly {
+			return fmt.Errorf("%s: %w (read_only)", name, ErrPolicyDenied)
+		}
+		for _, denied := range p.DenyCommands {
+			if name == denied || strings.HasPrefix(name, denied+" ") {
+				return fmt.Errorf("%s: %w (deny_commands %q)", name, ErrPolicyDenied, denied)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckAction checks an action by name ("domain.action").
+func (ps Policies) CheckAction(action string) error {
+	for _, p := range ps {
+		if err := check("action", action, p.AllowActions, "allow_actions", p.DenyActions, "deny_actions"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckEntities checks each entity ID.
+func (ps Policies) CheckEntities(ids ...string) error {
+	for _, p := range ps {
+		for _, id := range ids {
+			if err := check("entity", id, p.AllowEntities, "allow_entities", p.DenyEntities, "deny_entities"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func check(kind, name string, allow []string, allowKey string, deny []string, denyKey string) error {
+	if pattern, ok := matchAny(deny, name); ok {
+		return fmt.Errorf("%s %s: %w (%s %q)", kind, name, ErrPolicyDenied, denyKey, pattern)
+	}
+	if len(allow) > 0 {
+		if _, ok := matchAny(allow, name); !ok {
+			return fmt.Errorf("%s %s: %w (not in %s)", kind, name, ErrPolicyDenied, allowKey)
+		}
+	}
+	return nil
+}
+
+func matchAny(patterns []string, name string) (string, bool) {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
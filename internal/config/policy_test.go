@@ -0,0 +1,69 @@
+package config_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rnorth/ha-client/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+policy:
+  deny_actions: ["lock.*"]
+  deny_commands: ["area delete", "supervisor"]
+contexts:
+  - name: home
+    server: http://home:8123
+    policy:
+      allow_entities: ["light.*", "switch.kitchen_*"]
+  - name: cabin
+    server: http://cabin:8123
+`), 0600))
+	f, err := config.LoadFile(path)
+	require.NoError(t, err)
+
+	home := f.Policies("home")
+	require.Len(t, home, 2)
+	assert.True(t, home.HasEntityRules())
+	assert.False(t, f.Policies("cabin").HasEntityRules())
+
+	for _, err := range []error{
+		home.CheckAction("lock.unlock"),
+		home.CheckCommand("area delete", true),
+		home.CheckCommand("supervisor addon stop", true),
+		home.CheckEntities("light.desk", "switch.garage"),
+	} {
+		assert.True(t, errors.Is(err, config.ErrPolicyDenied), err)
+	}
+	assert.ErrorContains(t, home.CheckAction("lock.unlock"), `action lock.unlock: denied by policy (deny_actions "lock.*")`)
+	assert.ErrorContains(t, home.CheckEntities("switch.garage"), "entity switch.garage: denied by policy (not in allow_entities)")
+
+	assert.NoError(t, home.CheckAction("light.turn_on"))
+	assert.NoError(t, home.CheckCommand("area create", true))
+	assert.NoError(t, home.CheckCommand("areas", true))
+	assert.NoError(t, home.CheckEntities("light.desk", "switch.kitchen_fan"))
+
+	readOnly := config.Policies{{ReadOnly: true}}
+	assert.ErrorIs(t, readOnly.CheckCommand("state set", true), config.ErrPolicyDenied)
+	assert.NoError(t, readOnly.CheckCommand("state get", false))
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.yaml")
+	require.NoError(t, os.WriteFile(good, []byte("read_only: true\nallow_actions: [\"light.*\"]\n"), 0600))
+	p, err := config.LoadPolicy(good)
+	require.NoError(t, err)
+	assert.Equal(t, &config.Policy{ReadOnly: true, AllowActions: []string{"light.*"}}, p)
+
+	bad := filepath.Join(dir, "bad.yaml")
+	require.NoError(t, os.WriteFile(bad, []byte("deny_entities: [\"light.[\"]\n"), 0600))
+	_, err = config.LoadPolicy(bad)
+	assert.ErrorContains(t, err, `policy deny_entities: invalid pattern "light.["`)
+}
@@ -1,8 +1,13 @@
 package errors
 
 import (
+	"context"
 	"errors"
-	"strings"
+	"net/http"
+
+	"github.com/rnorth/ha-client/internal/client"
+	"github.com/rnorth/ha-client/internal/config"
+	"github.com/rnorth/ha-client/internal/output"
 )
 
 const (
@@ -11,12 +16,22 @@ const (
 	ExitAuth     = 3
 	ExitNotFound = 4
 	ExitServer   = 5
+	ExitTimeout  = 6
+	// ExitPolicyDenied means a policy forbade the command before anything was sent.
+	ExitPolicyDenied = 7
+	// ExitInterrupted follows the shell convention of 128 + SIGINT.
+	ExitInterrupted = 130
 )
 
 type CLIError struct {
 	Err      error
 	ExitCode int
-	Code     string // machine-readable: "auth_failed", "not_found", "server_error", "usage_error", "error"
+	Code     string // machine-readable: "auth_failed", "not_found", "server_error", "usage_error", "timeout", "interrupted", "policy_denied", "error"
+
+	// Populated from a client.APIError when Home Assistant rejected the request.
+	Status  int    // HTTP status
+	HACode  string // HA WebSocket error code
+	Request string // request path or WebSocket command type
 }
 
 func (e *CLIError) Error() string { return e.Err.Error() }
@@ -32,15 +47,41 @@ func Classify(err error) *CLIError {
 	if errors.As(err, &ce) {
 		return ce
 	}
-	msg := err.Error()
 	switch {
-	case strings.Contains(msg, "unauthorized"):
-		return &CLIError{Err: err, ExitCode: ExitAuth, Code: "auth_failed"}
-	case strings.Contains(msg, "not found"):
+	case errors.Is(err, config.ErrPolicyDenied):
+		return &CLIError{Err: err, ExitCode: ExitPolicyDenied, Code: "policy_denied"}
+	case errors.Is(err, output.ErrTemplate):
+		return &CLIError{Err: err, ExitCode: ExitUsage, Code: "usage_error"}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &CLIError{Err: err, ExitCode: ExitTimeout, Code: "timeout"}
+	case errors.Is(err, context.Canceled):
+		return &CLIError{Err: err, ExitCode: ExitInterrupted, Code: "interrupted"}
+	}
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		ce := classifyAPIError(apiErr)
+		ce.Err = err
+		return ce
+	}
+	if errors.Is(err, client.ErrNotFound) {
 		return &CLIError{Err: err, ExitCode: ExitNotFound, Code: "not_found"}
-	case strings.Contains(msg, "HTTP 5"):
-		return &CLIError{Err: err, ExitCode: ExitServer, Code: "server_error"}
+	}
+	return &CLIError{Err: err, ExitCode: ExitGeneral, Code: "error"}
+}
+
+func classifyAPIError(e *client.APIError) *CLIError {
+	ce := &CLIError{Status: e.StatusCode, HACode: e.Code, Request: e.Request}
+	switch {
+	case e.StatusCode == http.StatusUnauthorized || e.Code == client.CodeUnauthorized || e.Code == client.CodeAuthInvalid:
+		ce.ExitCode, ce.Code = ExitAuth, "auth_failed"
+	case e.StatusCode == http.StatusNotFound || e.Code == client.CodeNotFound:
+		ce.ExitCode, ce.Code = ExitNotFound, "not_found"
+	case e.StatusCode >= 500 || e.Code == client.CodeHomeAssistantError:
+		ce.ExitCode, ce.Code = ExitServer, "server_error"
+	case e.StatusCode == http.StatusBadRequest || e.Code == client.CodeInvalidFormat:
+		ce.ExitCode, ce.Code = ExitUsage, "usage_error"
 	default:
-		return &CLIError{Err: err, ExitCode: ExitGeneral, Code: "error"}
+		ce.ExitCode, ce.Code = ExitGeneral, "error"
 	}
+	return ce
 }
@@ -1,35 +1,95 @@
 package errors
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"testing"
 
+	"github.com/rnorth/ha-client/internal/client"
+	"github.com/rnorth/ha-client/internal/config"
+	"github.com/rnorth/ha-client/internal/output"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestClassify_AuthError(t *testing.T) {
-	ce := Classify(fmt.Errorf("unauthorized"))
+	ce := Classify(&client.APIError{StatusCode: http.StatusUnauthorized, Request: "GET /api/states"})
 	require.NotNil(t, ce)
 	assert.Equal(t, ExitAuth, ce.ExitCode)
 	assert.Equal(t, "auth_failed", ce.Code)
-	assert.Equal(t, "unauthorized", ce.Error())
+	assert.Equal(t, "unauthorized: check your token", ce.Error())
+	assert.Equal(t, http.StatusUnauthorized, ce.Status)
+	assert.Equal(t, "GET /api/states", ce.Request)
+}
+
+func TestClassify_WSAuthError(t *testing.T) {
+	ce := Classify(&client.APIError{Code: client.CodeAuthInvalid, Message: "invalid token", Request: "auth"})
+	require.NotNil(t, ce)
+	assert.Equal(t, ExitAuth, ce.ExitCode)
+	assert.Equal(t, client.CodeAuthInvalid, ce.HACode)
 }
 
 func TestClassify_NotFoundError(t *testing.T) {
-	ce := Classify(fmt.Errorf("entity not found"))
+	ce := Classify(&client.APIError{StatusCode: http.StatusNotFound, Request: "GET /api/states/light.nope"})
+	require.NotNil(t, ce)
+	assert.Equal(t, ExitNotFound, ce.ExitCode)
+	assert.Equal(t, "not_found", ce.Code)
+}
+
+func TestClassify_WSNotFoundError(t *testing.T) {
+	err := fmt.Errorf("loading: %w", &client.APIError{Code: client.CodeNotFound, Message: "Entity not found", Request: "config/entity_registry/get"})
+	ce := Classify(err)
 	require.NotNil(t, ce)
 	assert.Equal(t, ExitNotFound, ce.ExitCode)
 	assert.Equal(t, "not_found", ce.Code)
+	assert.Equal(t, "config/entity_registry/get", ce.Request)
+}
+
+func TestClassify_WrappedErrNotFound(t *testing.T) {
+	ce := Classify(fmt.Errorf("area %q: %w", "attic", client.ErrNotFound))
+	require.NotNil(t, ce)
+	assert.Equal(t, ExitNotFound, ce.ExitCode)
+}
+
+func TestClassify_PolicyDenied(t *testing.T) {
+	ce := Classify(fmt.Errorf("state set: %w (read_only)", config.ErrPolicyDenied))
+	require.NotNil(t, ce)
+	assert.Equal(t, ExitPolicyDenied, ce.ExitCode)
+	assert.Equal(t, "policy_denied", ce.Code)
+}
+
+func TestClassify_OutputTemplate(t *testing.T) {
+	ce := Classify(fmt.Errorf("%w: jsonpath {.a: unclosed {", output.ErrTemplate))
+	require.NotNil(t, ce)
+	assert.Equal(t, ExitUsage, ce.ExitCode)
+	assert.Equal(t, "usage_error", ce.Code)
 }
 
 func TestClassify_ServerError(t *testing.T) {
-	ce := Classify(fmt.Errorf("HTTP 500 Internal Server Error"))
+	ce := Classify(&client.APIError{StatusCode: http.StatusInternalServerError, Body: "Internal Server Error"})
 	require.NotNil(t, ce)
 	assert.Equal(t, ExitServer, ce.ExitCode)
 	assert.Equal(t, "server_error", ce.Code)
 }
 
+func TestClassify_InvalidFormat(t *testing.T) {
+	ce := Classify(&client.APIError{Code: client.CodeInvalidFormat, Message: "extra keys not allowed"})
+	require.NotNil(t, ce)
+	assert.Equal(t, ExitUsage, ce.ExitCode)
+	assert.Equal(t, "usage_error", ce.Code)
+}
+
+func TestClassify_MessageTextIsNotInspected(t *testing.T) {
+	// An area called "not found" or a template that prints "unauthorized" must
+	// not change the exit code: only typed errors are classified.
+	for _, msg := range []string{`area "not found" already exists`, "template output: unauthorized", "HTTP 500"} {
+		ce := Classify(fmt.Errorf("%s", msg))
+		assert.Equal(t, ExitGeneral, ce.ExitCode, msg)
+		assert.Equal(t, "error", ce.Code, msg)
+	}
+}
+
 func TestClassify_GeneralError(t *testing.T) {
 	ce := Classify(fmt.Errorf("something went wrong"))
 	require.NotNil(t, ce)
@@ -60,3 +120,17 @@ func TestCLIError_Unwrap(t *testing.T) {
 	ce := &CLIError{Err: inner, ExitCode: ExitGeneral, Code: "error"}
 	assert.Equal(t, inner, ce.Unwrap())
 }
+
+func TestClassify_Timeout(t *testing.T) {
+	ce := Classify(fmt.Errorf("request failed: %w", context.DeadlineExceeded))
+	require.NotNil(t, ce)
+	assert.Equal(t, ExitTimeout, ce.ExitCode)
+	assert.Equal(t, "timeout", ce.Code)
+}
+
+func TestClassify_Interrupted(t *testing.T) {
+	ce := Classify(fmt.Errorf("request failed: %w", context.Canceled))
+	require.NotNil(t, ce)
+	assert.Equal(t, ExitInterrupted, ce.ExitCode)
+	assert.Equal(t, "interrupted", ce.Code)
+}
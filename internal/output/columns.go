@@ -0,0 +1,131 @@
+package output
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// column is one table column: a struct field, named by its Go or JSON name, or
+// a JSONPath into the item as -o json would print it.
+type column struct {
+	header string
+	field  string
+	path   *jpPath
+}
+
+// tableSpec is how a row-and-column format chooses its columns, and how it
+// writes them.
+type tableSpec struct {
+	writer  Format   // FormatTable, FormatCSV, FormatTSV or FormatMarkdown
+	columns []string // the command's columns, or the custom columns
+	extra   []string // added by -o wide
+	rows    bool     // a single item is shown as a one-row table, not as key/value pairs
+}
+
+// table returns the column choice for table, wide, custom-columns, csv, tsv
+// and markdown formats, or nil for other formats.
+func (f Format) table(columns []string, cfg *renderConfig) (*tableSpec, error) {
+	switch f {
+	case FormatTable:
+		return &tableSpec{writer: FormatTable, columns: columns}, nil
+	case FormatWide:
+		return &tableSpec{writer: FormatTable, columns: columns, extra: cfg.wide}, nil
+	case FormatCSV, FormatTSV, FormatMarkdown:
+		return &tableSpec{writer: f, columns: columns, rows: true}, nil
+	}
+	specs, ok, err := f.customColumns()
+	if !ok || err != nil {
+		return nil, err
+	}
+	return &tableSpec{writer: FormatTable, columns: specs, rows: true}, nil
+}
+
+// customColumns parses "custom-columns=ID:.entity_id,NAME:.attributes.friendly_name"
+// into column specs. ok is false for other formats.
+func (f Format) customColumns() (specs []string, ok bool, err error) {
+	name, spec, _ := strings.Cut(string(f), "=")
+	if Format(strings.ToLower(name)) != FormatCustomColumns {
+		return nil, false, nil
+	}
+	if spec == "" {
+		return nil, true, fmt.Errorf("%w: custom-columns format needs columns, e.g. -o custom-columns=ID:.entity_id,STATE:.state", ErrTemplate)
+	}
+	for _, part := range splitColumns(spec) {
+		header, path, found := strings.Cut(part, ":")
+		if !found || strings.TrimSpace(header) == "" || strings.TrimSpace(path) == "" {
+			return nil, true, fmt.Errorf("%w: custom-columns %q: expected HEADER:.path", ErrTemplate, part)
+		}
+		path = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(path), "{"), "}")
+		if !strings.HasPrefix(path, ".") && !strings.HasPrefix(path, "[") && !strings.HasPrefix(path, "$") && !strings.HasPrefix(path, "@") {
+			path = "." + path
+		}
+		if _, err := parsePath(path); err != nil {
+			return nil, true, fmt.Errorf("%w: custom-columns %q: %v", ErrTemplate, part, err)
+		}
+		specs = append(specs, strings.TrimSpace(header)+":"+path)
+	}
+	return specs, true, nil
+}
+
+// splitColumns splits a custom-columns spec at commas that are not inside
+// brackets, so that "NAMES:['a','b']" stays one column.
+func splitColumns(spec string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range spec {
+		switch c {
+		case '[', '(':
+			depth++
+		case ']', ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, spec[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, spec[start:])
+}
+
+// parseColumn parses a column spec: a field name such as "EntityID", headed
+// by its JSON name, or "HEADER:.path" such as "NAME:.attributes.friendly_name".
+func parseColumn(t reflect.Type, spec string) (column, error) {
+	if header, expr, ok := strings.Cut(spec, ":"); ok {
+		path, err := parsePath(expr)
+		if err != nil {
+			return column{}, fmt.Errorf("%w: column %s: %v", ErrTemplate, spec, err)
+		}
+		return column{header: header, path: path}, nil
+	}
+	header := spec
+	if t.Kind() == reflect.Struct {
+		// Use the JSON tag so headers use HA-familiar names (e.g.
+		// "entity_id" → "ENTITY_ID", not "EntityID").
+		if f, ok := t.FieldByName(spec); ok {
+			if tag := f.Tag.Get("json"); tag != "" && tag != "-" {
+				header = strings.Split(tag, ",")[0]
+			}
+		}
+	}
+	return column{header: strings.ToUpper(header), field: spec}, nil
+}
+
+// cellValue prints a path column's results: lists of scalars are joined with
+// commas, and a missing value is shown as <none>, as kubectl does.
+func cellValue(vals []interface{}) string {
+	if len(vals) == 1 {
+		if list, ok := vals[0].([]interface{}); ok {
+			vals = list
+		}
+	}
+	if len(vals) == 0 {
+		return "<none>"
+	}
+	parts := make([]string, len(vals))
+	for i, v := range vals {
+		parts[i] = formatValue(v)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,99 @@
+package output_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rnorth/ha-client/internal/client"
+	"github.com/rnorth/ha-client/internal/output"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tableLines(t *testing.T, format output.Format, data interface{}, columns []string, opts ...output.RenderOption) [][]string {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, output.Render(&buf, format, data, columns, opts...))
+	var lines [][]string
+	for _, line := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+		lines = append(lines, strings.Fields(line))
+	}
+	return lines
+}
+
+func TestWideOutput(t *testing.T) {
+	columns := []string{"EntityID", "State"}
+	wide := output.WithWideColumns("UNIT:.attributes.unit_of_measurement", "LastChanged")
+
+	lines := tableLines(t, output.FormatTable, templateStates, columns, wide)
+	assert.Equal(t, []string{"ENTITY_ID", "STATE"}, lines[0], "wide columns only appear with -o wide")
+
+	lines = tableLines(t, output.FormatWide, templateStates, columns, wide)
+	assert.Equal(t, []string{"ENTITY_ID", "STATE", "UNIT", "LAST_CHANGED"}, lines[0])
+	assert.Equal(t, []string{"sensor.living_temp", "21.5", "°C"}, lines[1][:3])
+	assert.Equal(t, []string{"light.desk", "on", "<none>"}, lines[2][:3])
+}
+
+func TestWideOutput_WithoutWideColumns(t *testing.T) {
+	lines := tableLines(t, output.FormatWide, []item{{"light.desk", "on"}}, nil)
+	assert.Equal(t, [][]string{{"NAME", "STATE"}, {"light.desk", "on"}}, lines)
+}
+
+func TestCustomColumns(t *testing.T) {
+	format := output.Format("custom-columns=ID:.entity_id,NAME:.attributes.friendly_name,CLASS:attributes.device_class")
+	lines := tableLines(t, format, templateStates, []string{"EntityID"})
+	assert.Equal(t, [][]string{
+		{"ID", "NAME", "CLASS"},
+		{"sensor.living_temp", "<none>", "temperature"},
+		{"light.desk", "Desk", "<none>"},
+		{"sensor.garage_temp", "<none>", "temperature"},
+	}, lines)
+
+	lines = tableLines(t, format, templateStates[1], nil, output.WithNoHeaders(true))
+	assert.Equal(t, [][]string{{"light.desk", "Desk", "<none>"}}, lines, "a single item is a one-row table")
+}
+
+func TestCustomColumns_Lists(t *testing.T) {
+	entities := []client.EntityEntry{{EntityID: "light.desk", Labels: []string{"office", "critical"}}}
+	lines := tableLines(t, "custom-columns=ID:.entity_id,LABELS:.labels,FIRST:.labels[0]", entities, nil)
+	assert.Equal(t, []string{"light.desk", "office,critical", "office"}, lines[1])
+}
+
+func TestCustomColumns_Errors(t *testing.T) {
+	for _, format := range []output.Format{
+		"custom-columns=",
+		"custom-columns=ID",
+		"custom-columns=ID:.entity_id,:.state",
+		"custom-columns=ID:.entity_id[",
+	} {
+		t.Run(string(format), func(t *testing.T) {
+			err := output.Render(&bytes.Buffer{}, format, templateStates, nil)
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, output.ErrTemplate), err)
+			assert.Error(t, format.Validate())
+		})
+	}
+}
+
+func TestDetectFormat_Tables(t *testing.T) {
+	assert.Equal(t, output.FormatWide, output.DetectFormat("wide", os.Stdout))
+	assert.Equal(t, output.Format("custom-columns=ID:.entity_id"), output.DetectFormat("custom-columns=ID:.entity_id", os.Stdout))
+}
+
+func TestRenderContexts_CustomColumns(t *testing.T) {
+	var buf bytes.Buffer
+	results := []output.ContextResult{
+		{Context: "home", Data: templateStates[:2]},
+		{Context: "cabin", Data: templateStates[2]},
+	}
+	require.NoError(t, output.RenderContexts(&buf, "custom-columns=ID:.entity_id,CLASS:.attributes.device_class", results, nil))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 4)
+	assert.Equal(t, []string{"CONTEXT", "ID", "CLASS"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"home", "light.desk", "<none>"}, strings.Fields(lines[2]))
+	assert.Equal(t, []string{"cabin", "sensor.garage_temp", "temperature"}, strings.Fields(lines[3]))
+}
@@ -0,0 +1,133 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ContextResult is the data one context produced in a multi-context run.
+type ContextResult struct {
+	Context string
+	Data    interface{}
+}
+
+// RenderContexts merges results from several contexts into one listing. Table
+// (and CSV, TSV and Markdown) output gets a leading CONTEXT column; JSON, YAML
+// and NDJSON output is a flat list in which every item carries a "context"
+// field, and templated formats are executed against that list. Slices are
+// flattened, so each element becomes its own row/item.
+func RenderContexts(w io.Writer, format Format, results []ContextResult, columns []string, opts ...RenderOption) error {
+	cfg := &renderConfig{}
+	for _, o := range opts {
+		o(cfg)
+	}
+	type item struct {
+		context string
+		value   reflect.Value
+	}
+	var items []item
+	for _, r := range results {
+		v := reflect.ValueOf(r.Data)
+		if v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.Slice {
+			v = v.Elem()
+		}
+		if v.Kind() == reflect.Slice {
+			for i := 0; i < v.Len(); i++ {
+				items = append(items, item{r.Context, v.Index(i)})
+			}
+			continue
+		}
+		if v.IsValid() {
+			items = append(items, item{r.Context, v})
+		}
+	}
+
+	p, err := format.template()
+	if err != nil {
+		return err
+	}
+	ts, err := format.table(columns, cfg)
+	if err != nil {
+		return err
+	}
+	switch {
+	case format == FormatName:
+		for _, it := range items {
+			if _, err := fmt.Fprintln(w, itemName(indirect(it.value), columns)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case p != nil, format == FormatJSON, format == FormatYAML, format == FormatNDJSON:
+		merged := make([]interface{}, 0, len(items))
+		for _, it := range items {
+			m, err := withContextField(it.context, it.value.Interface())
+			if err != nil {
+				return err
+			}
+			merged = append(merged, m)
+		}
+		if p != nil {
+			return renderTemplate(w, p, merged)
+		}
+		if format == FormatNDJSON {
+			return renderNDJSON(w, merged)
+		}
+		if format == FormatJSON {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(merged)
+		}
+		return yaml.NewEncoder(w).Encode(merged)
+	case ts != nil:
+		if len(items) == 0 {
+			if ts.writer == FormatTable {
+				fmt.Fprintln(w, "(none)")
+			}
+			return nil
+		}
+		var headers []string
+		var cols []column
+		rows := make([][]string, 0, len(items))
+		for _, it := range items {
+			v := indirect(it.value)
+			if v.Kind() != reflect.Struct && !ts.rows {
+				// Maps and scalars have no fixed columns; show them whole.
+				if headers == nil {
+					headers = []string{"VALUE"}
+				}
+				rows = append(rows, []string{it.context, fmt.Sprintf("%v", v.Interface())})
+				continue
+			}
+			if cols == nil {
+				if cols, err = resolveColumns(v.Type(), ts); err != nil {
+					return err
+				}
+				headers = columnHeaders(cols)
+			}
+			rows = append(rows, append([]string{it.context}, extractRow(v, cols)...))
+		}
+		return writeRows(w, ts.writer, append([]string{"CONTEXT"}, headers...), rows, cfg)
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+// withContextField returns v as a JSON object with a "context" field added.
+// Values that are not objects are wrapped as {"context": ..., "value": v}.
+func withContextField(context string, v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if json.Unmarshal(data, &m) != nil || m == nil {
+		return map[string]interface{}{"context": context, "value": v}, nil
+	}
+	m["context"] = context
+	return m, nil
+}
@@ -0,0 +1,54 @@
+package output_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rnorth/ha-client/internal/output"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderContexts_Table(t *testing.T) {
+	var buf bytes.Buffer
+	results := []output.ContextResult{
+		{Context: "home", Data: []item{{"light.desk", "on"}}},
+		{Context: "cabin", Data: []item{{"light.porch", "off"}, {"switch.pump", "on"}}},
+	}
+	require.NoError(t, output.RenderContexts(&buf, output.FormatTable, results, nil))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 4)
+	assert.Equal(t, []string{"CONTEXT", "NAME", "STATE"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"home", "light.desk", "on"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"cabin", "switch.pump", "on"}, strings.Fields(lines[3]))
+}
+
+func TestRenderContexts_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	results := []output.ContextResult{
+		{Context: "home", Data: []item{{"light.desk", "on"}}},
+		{Context: "cabin", Data: item{"light.porch", "off"}},
+		{Context: "lab", Data: "plain"},
+	}
+	require.NoError(t, output.RenderContexts(&buf, output.FormatJSON, results, nil))
+
+	var out []map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &out))
+	require.Len(t, out, 3)
+	assert.Equal(t, map[string]interface{}{"context": "home", "name": "light.desk", "state": "on"}, out[0])
+	assert.Equal(t, "cabin", out[1]["context"])
+	assert.Equal(t, map[string]interface{}{"context": "lab", "value": "plain"}, out[2])
+}
+
+func TestRenderContexts_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, output.RenderContexts(&buf, output.FormatTable, nil, nil))
+	assert.Equal(t, "(none)\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, output.RenderContexts(&buf, output.FormatJSON, nil, nil))
+	assert.Equal(t, "[]\n", buf.String())
+}
@@ -0,0 +1,634 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a parsed kubectl-style JSONPath template: plain text with
+// expressions in braces, e.g. "{.entity_id}: {.state}". Supported inside
+// braces are paths ($, @, .field, ['field'], [0], [-1], [1:3], [*], ..field,
+// [?(@.state == "on")]), quoted literals ("\n") and {range path}...{end}.
+type jsonPath struct {
+	nodes []jpNode
+}
+
+// jpNode is one piece of a template: literal text, a path to print, or a range
+// over a path's results with a body of its own.
+type jpNode struct {
+	text  string
+	path  *jpPath
+	body  []jpNode // for range
+	isRng bool
+}
+
+// jpPath is a sequence of steps applied to the current value (or to the root,
+// for paths starting with $).
+type jpPath struct {
+	fromRoot bool
+	steps    []jpStep
+}
+
+type jpStep func(v interface{}) []interface{}
+
+// maxResults bounds the values a template may produce, so that an expression
+// such as "{[0,0][0,0][0,0]...}" or nested ranges over ".." fail rather than
+// run out of time or memory.
+const maxResults = 1 << 20
+
+var errTooManyResults = fmt.Errorf("expression yields more than %d values", maxResults)
+
+func parseJSONPath(expr string) (*jsonPath, error) {
+	p := &jpParser{src: expr}
+	nodes, end, err := p.parseNodes()
+	if err != nil {
+		return nil, err
+	}
+	if end {
+		return nil, fmt.Errorf("{end} without {range}")
+	}
+	return &jsonPath{nodes: nodes}, nil
+}
+
+type jpParser struct {
+	src string
+	pos int
+}
+
+// parseNodes reads nodes up to the end of the template, or up to an {end}
+// (reported by end), for the body of a range.
+func (p *jpParser) parseNodes() (nodes []jpNode, end bool, err error) {
+	for p.pos < len(p.src) {
+		open := strings.IndexByte(p.src[p.pos:], '{')
+		if open < 0 {
+			nodes = append(nodes, jpNode{text: p.src[p.pos:]})
+			p.pos = len(p.src)
+			break
+		}
+		if open > 0 {
+			nodes = append(nodes, jpNode{text: p.src[p.pos : p.pos+open]})
+		}
+		p.pos += open + 1
+		closing, err := matchingBrace(p.src, p.pos)
+		if err != nil {
+			return nil, false, err
+		}
+		inner := strings.TrimSpace(p.src[p.pos:closing])
+		p.pos = closing + 1
+
+		switch {
+		case inner == "end":
+			return nodes, true, nil
+		case inner == "range" || strings.HasPrefix(inner, "range "):
+			expr := strings.TrimSpace(strings.TrimPrefix(inner, "range"))
+			path, err := parsePath(expr)
+			if err != nil {
+				return nil, false, err
+			}
+			body, end, err := p.parseNodes()
+			if err != nil {
+				return nil, false, err
+			}
+			if !end {
+				return nil, false, fmt.Errorf("{range %s} without {end}", expr)
+			}
+			nodes = append(nodes, jpNode{path: path, body: body, isRng: true})
+		case strings.HasPrefix(inner, `"`) || strings.HasPrefix(inner, "'"):
+			s, err := unquote(inner)
+			if err != nil {
+				return nil, false, err
+			}
+			nodes = append(nodes, jpNode{text: s})
+		default:
+			path, err := parsePath(inner)
+			if err != nil {
+				return nil, false, err
+			}
+			nodes = append(nodes, jpNode{path: path})
+		}
+	}
+	return nodes, false, nil
+}
+
+// matchingBrace returns the index of the "}" closing an expression that starts
+// at from, skipping over quoted strings.
+func matchingBrace(s string, from int) (int, error) {
+	var quote byte
+	for i := from; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{':
+			return 0, fmt.Errorf("unexpected { at offset %d", i)
+		case c == '}':
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unclosed { at offset %d", from-1)
+}
+
+func unquote(s string) (string, error) {
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return s[1 : len(s)-1], nil
+	}
+	u, err := strconv.Unquote(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid string literal %s", s)
+	}
+	return u, nil
+}
+
+// parsePath parses a path such as ".attributes.temperature" or
+// "[?(@.state == 'on')].entity_id".
+func parsePath(s string) (*jpPath, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty expression")
+	}
+	path := &jpPath{}
+	rest := s
+	switch {
+	case strings.HasPrefix(rest, "$"):
+		path.fromRoot = true
+		rest = rest[1:]
+	case strings.HasPrefix(rest, "@"):
+		rest = rest[1:]
+	}
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			path.steps = append(path.steps, descendants)
+			rest = rest[2:]
+			if strings.HasPrefix(rest, ".") {
+				return nil, fmt.Errorf("%s: unexpected %q after ..", s, rest)
+			}
+			if rest != "" && rest[0] != '[' {
+				rest = "." + rest
+			}
+		case rest[0] == '.':
+			name := rest[1:]
+			if i := strings.IndexAny(name, ".["); i >= 0 {
+				name = name[:i]
+			}
+			rest = rest[1+len(name):]
+			switch name {
+			case "":
+				// "." on its own (e.g. "{.}" or ".[*]") is the current value.
+			case "*":
+				path.steps = append(path.steps, wildcard)
+			default:
+				path.steps = append(path.steps, fieldStep([]string{name}))
+			}
+		case rest[0] == '[':
+			end, err := closingBracket(rest)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", s, err)
+			}
+			step, err := parseBracket(strings.TrimSpace(rest[1:end]))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", s, err)
+			}
+			path.steps = append(path.steps, step)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("%s: unexpected %q (paths start with . or [)", s, rest)
+		}
+	}
+	return path, nil
+}
+
+// closingBracket returns the index of the "]" matching the "[" at s[0].
+func closingBracket(s string) (int, error) {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '(':
+			depth++
+		case c == ']' || c == ')':
+			depth--
+			if depth == 0 {
+				if c != ']' {
+					return 0, fmt.Errorf("unbalanced parentheses")
+				}
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unclosed [")
+}
+
+func parseBracket(s string) (jpStep, error) {
+	switch {
+	case s == "*":
+		return wildcard, nil
+	case strings.HasPrefix(s, "?(") && strings.HasSuffix(s, ")"):
+		return parseFilter(strings.TrimSpace(s[2 : len(s)-1]))
+	case strings.HasPrefix(s, "'") || strings.HasPrefix(s, `"`):
+		var names []string
+		for _, part := range strings.Split(s, ",") {
+			name, err := unquote(strings.TrimSpace(part))
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, name)
+		}
+		return fieldStep(names), nil
+	case strings.Contains(s, ":"):
+		return parseSlice(s)
+	}
+	var indexes []int
+	for _, part := range strings.Split(s, ",") {
+		i, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid index [%s]", s)
+		}
+		indexes = append(indexes, i)
+	}
+	return func(v interface{}) []interface{} {
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil
+		}
+		var out []interface{}
+		for _, i := range indexes {
+			if i < 0 {
+				i += len(list)
+			}
+			if i >= 0 && i < len(list) {
+				out = append(out, list[i])
+			}
+		}
+		return out
+	}, nil
+}
+
+// parseSlice parses start:end[:step], each part optional.
+func parseSlice(s string) (jpStep, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("invalid slice [%s]", s)
+	}
+	bounds := make([]*int, 3)
+	for i, part := range parts {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid slice [%s]", s)
+		}
+		bounds[i] = &n
+	}
+	step := 1
+	if bounds[2] != nil {
+		step = *bounds[2]
+	}
+	if step <= 0 {
+		return nil, fmt.Errorf("invalid slice [%s]: step must be positive", s)
+	}
+	return func(v interface{}) []interface{} {
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil
+		}
+		clamp := func(b *int, def int) int {
+			if b == nil {
+				return def
+			}
+			i := *b
+			if i < 0 {
+				i += len(list)
+			}
+			return max(0, min(i, len(list)))
+		}
+		// A step past the end is the same as one to it, and cannot overflow i.
+		step := min(step, len(list))
+		var out []interface{}
+		for i := clamp(bounds[0], 0); i < clamp(bounds[1], len(list)); i += step {
+			out = append(out, list[i])
+		}
+		return out
+	}, nil
+}
+
+// fieldStep looks up keys of an object. Missing keys give no result rather than
+// an error, so that items lacking an attribute are skipped.
+func fieldStep(names []string) jpStep {
+	return func(v interface{}) []interface{} {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		var out []interface{}
+		for _, name := range names {
+			if val, ok := m[name]; ok {
+				out = append(out, val)
+			}
+		}
+		return out
+	}
+}
+
+// wildcard yields every element of a list, or every value of an object in key
+// order.
+func wildcard(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		return v
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := make([]interface{}, 0, len(v))
+		for _, k := range keys {
+			out = append(out, v[k])
+		}
+		return out
+	}
+	return nil
+}
+
+// descendants yields v and everything nested in it, for "..".
+func descendants(v interface{}) []interface{} {
+	out := []interface{}{v}
+	for _, child := range wildcard(v) {
+		out = append(out, descendants(child)...)
+	}
+	return out
+}
+
+var filterOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// parseFilter parses the inside of [?(...)]: "@.path op value", or "@.path"
+// alone to keep items that have the field.
+func parseFilter(s string) (jpStep, error) {
+	op, left, right := "", s, ""
+	if i, o := indexOp(s); i >= 0 {
+		op, left, right = o, strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+len(o):])
+	}
+	lpath, err := parsePath(left)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter (%s): %w", s, err)
+	}
+	var rvalue func(item interface{}) []interface{}
+	switch {
+	case op == "":
+	case strings.HasPrefix(right, "@") || strings.HasPrefix(right, "$"):
+		rpath, err := parsePath(right)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter (%s): %w", s, err)
+		}
+		rvalue = func(item interface{}) []interface{} {
+			vals, _ := rpath.eval(item, item)
+			return vals
+		}
+	default:
+		lit, err := parseLiteral(right)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter (%s): %w", s, err)
+		}
+		rvalue = func(interface{}) []interface{} { return []interface{}{lit} }
+	}
+	return func(v interface{}) []interface{} {
+		var out []interface{}
+		for _, item := range wildcard(v) {
+			// A side that yields too many values is treated as yielding none.
+			lvals, _ := lpath.eval(item, item)
+			if op == "" {
+				if len(lvals) > 0 {
+					out = append(out, item)
+				}
+				continue
+			}
+			if anyCompare(lvals, rvalue(item), op) {
+				out = append(out, item)
+			}
+		}
+		return out
+	}, nil
+}
+
+// indexOp finds the first comparison operator outside quotes and outside
+// brackets, which may hold a nested filter.
+func indexOp(s string) (int, string) {
+	var quote byte
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+			continue
+		case c == '"' || c == '\'':
+			quote = c
+			continue
+		case c == '[' || c == '(':
+			depth++
+			continue
+		case c == ']' || c == ')':
+			depth--
+			continue
+		case depth > 0:
+			continue
+		}
+		for _, op := range filterOps {
+			if strings.HasPrefix(s[i:], op) {
+				return i, op
+			}
+		}
+	}
+	return -1, ""
+}
+
+func parseLiteral(s string) (interface{}, error) {
+	switch s {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if strings.HasPrefix(s, "'") || strings.HasPrefix(s, `"`) {
+		return unquote(s)
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("invalid value %s (quote strings)", s)
+}
+
+func anyCompare(lvals, rvals []interface{}, op string) bool {
+	for _, l := range lvals {
+		for _, r := range rvals {
+			if compare(l, r, op) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compare compares numbers numerically (Home Assistant states are strings, so
+// "21.5" compares as a number too) and anything else as text.
+func compare(l, r interface{}, op string) bool {
+	lf, lok := toFloat(l)
+	rf, rok := toFloat(r)
+	var c int
+	if lok && rok {
+		switch {
+		case lf < rf:
+			c = -1
+		case lf > rf:
+			c = 1
+		}
+	} else {
+		if op != "==" && op != "!=" && (lok || rok) {
+			return false
+		}
+		c = strings.Compare(formatValue(l), formatValue(r))
+		if (l == nil) != (r == nil) {
+			c = 1
+		}
+	}
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func (p *jpPath) eval(root, current interface{}) ([]interface{}, error) {
+	vals := []interface{}{current}
+	if p.fromRoot {
+		vals = []interface{}{root}
+	}
+	for _, step := range p.steps {
+		var next []interface{}
+		for _, v := range vals {
+			next = append(next, step(v)...)
+			if len(next) > maxResults {
+				return nil, errTooManyResults
+			}
+		}
+		vals = next
+	}
+	return vals, nil
+}
+
+// execute writes the template for data, which must be JSON-shaped (maps,
+// slices, strings, float64s, bools and nils).
+func (t *jsonPath) execute(w io.Writer, data interface{}) error {
+	budget := maxResults
+	return executeNodes(w, t.nodes, data, data, &budget)
+}
+
+// executeNodes writes nodes for current. budget is how many more values the
+// template may produce, across every range.
+func executeNodes(w io.Writer, nodes []jpNode, root, current interface{}, budget *int) error {
+	for _, n := range nodes {
+		switch {
+		case n.path == nil:
+			if _, err := io.WriteString(w, n.text); err != nil {
+				return err
+			}
+		case n.isRng:
+			vals, err := spend(n.path, root, current, budget)
+			if err != nil {
+				return err
+			}
+			for _, v := range vals {
+				if err := executeNodes(w, n.body, root, v, budget); err != nil {
+					return err
+				}
+			}
+		default:
+			vals, err := spend(n.path, root, current, budget)
+			if err != nil {
+				return err
+			}
+			parts := make([]string, len(vals))
+			for i, v := range vals {
+				parts[i] = formatValue(v)
+			}
+			if _, err := io.WriteString(w, strings.Join(parts, " ")); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// spend evaluates path and charges its values to budget.
+func spend(path *jpPath, root, current interface{}, budget *int) ([]interface{}, error) {
+	vals, err := path.eval(root, current)
+	if err != nil {
+		return nil, err
+	}
+	if *budget -= len(vals); *budget < 0 {
+		return nil, errTooManyResults
+	}
+	return vals, nil
+}
+
+// formatValue prints scalars bare and objects and lists as compact JSON.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
@@ -0,0 +1,169 @@
+package output_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rnorth/ha-client/internal/output"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// jsonPathDoc is JSON-shaped test data: a list, nested objects and mixed types.
+var jsonPathDoc = map[string]interface{}{
+	"list": []interface{}{0.0, 1.0, 2.0, 3.0, 4.0},
+	"items": []interface{}{
+		map[string]interface{}{"name": "a", "n": 1.0, "on": true, "tags": []interface{}{"x"}},
+		map[string]interface{}{"name": "b", "n": 5.0, "on": false, "limit": 5.0},
+		map[string]interface{}{"name": "c", "n": "10", "child": map[string]interface{}{"name": "d"}},
+	},
+}
+
+func jsonPath(expr string, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	err := output.Render(&buf, output.Format("jsonpath="+expr), data, nil)
+	return buf.String(), err
+}
+
+func TestJSONPath_Evaluate(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		// Indexes
+		{"{.list[0]}", "0"},
+		{"{.list[-1]}", "4"},
+		{"{.list[-5]}", "0"},
+		{"{.list[-6]}", ""},
+		{"{.list[9]}", ""},
+		{"{.list[0,-1]}", "0 4"},
+		{"{.name[0]}", ""},
+
+		// Slices
+		{"{.list[1:3]}", "1 2"},
+		{"{.list[:2]}", "0 1"},
+		{"{.list[3:]}", "3 4"},
+		{"{.list[-2:]}", "3 4"},
+		{"{.list[:-3]}", "0 1"},
+		{"{.list[::2]}", "0 2 4"},
+		{"{.list[1::9223372036854775807]}", "1"},
+		{"{.list[-9223372036854775808:9223372036854775807]}", "0 1 2 3 4"},
+		{"{.list[3:1]}", ""},
+		{"{.list[2:2]}", ""},
+
+		// Fields
+		{"{.items[*].name}", "a b c"},
+		{"{.items[0]['name','n']}", "a 1"},
+		{"{$.items[1].limit}", "5"},
+		{"{.items[*].missing}", ""},
+		{"{.items[0].*}", "1 a true [\"x\"]"},
+
+		// Filters
+		{`{.items[?(@.name == "b")].n}`, "5"},
+		{`{.items[?(@.name != 'b')].name}`, "a c"},
+		{"{.items[?(@.n > 2)].name}", "b c"},
+		{"{.items[?(@.n <= 5)].name}", "a b"},
+		{"{.items[?(@.on == true)].name}", "a"},
+		{"{.items[?(@.on == false)].name}", "b"},
+		{"{.items[?(@.missing == null)].name}", ""},
+		{"{.items[?(@.limit)].name}", "b"},
+		{"{.items[?(@.n == @.limit)].name}", "b"},
+		{"{.items[?(@.n >= 'x')].name}", ""},
+		{`{.items[?(@.tags[?(@ == "x")])].name}`, "a"},
+		{`{.items[?(@.name == "a)]")].n}`, ""},
+
+		// Recursive descent
+		{"{..child.name}", "d"},
+		{"{.items..name}", "a b c d"},
+		{"{..tags[0]}", "x"},
+
+		// Ranges and literals
+		{`{range .items[*]}{.name}={.n}{"\n"}{end}`, "a=1\nb=5\nc=10\n"},
+		{`{range .items[?(@.on)]}{.name}{end}`, "ab"},
+		{"{'lit'}{\"\\t\"}", "lit\t"},
+		{"{.}", `{"items":[{"n":1,"name":"a","on":true,"tags":["x"]},{"limit":5,"n":5,"name":"b","on":false},{"child":{"name":"d"},"n":"10","name":"c"}],"list":[0,1,2,3,4]}`},
+		{"plain text", "plain text"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := jsonPath(tt.expr, jsonPathDoc)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestJSONPath_ParseErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"", "needs a template"},
+		{"{}", "empty expression"},
+		{"{ }", "empty expression"},
+		{"{.a", "unclosed {"},
+		{"{.a{.b}}", "unexpected {"},
+		{"{.a[0}", "unclosed ["},
+		{"{.a[}", "unclosed ["},
+		{"{[?(@.a}", "unclosed ["},
+		{"{[(]}", "unclosed ["},
+		{"{[?(@.a)}", "unclosed ["},
+		{"{.a[x]}", "invalid index"},
+		{"{.a[1:2:3:4]}", "invalid slice"},
+		{"{.a[x:]}", "invalid slice"},
+		{"{.a[::0]}", "step must be positive"},
+		{"{.a[::-1]}", "step must be positive"},
+		{"{.a[99999999999999999999]}", "invalid index"},
+		{"{[?(@.a == on)]}", "quote strings"},
+		{"{[?()]}", "empty expression"},
+		{"{...a}", "after .."},
+		{"{a}", "paths start with"},
+		{"{range .a}", "without {end}"},
+		{"{end}", "without {range}"},
+		{"{'unterminated}", "unclosed {"},
+		{`{"\q"}`, "invalid string literal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := jsonPath(tt.expr, jsonPathDoc)
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, output.ErrTemplate), err)
+			assert.Contains(t, err.Error(), tt.want)
+			assert.Empty(t, got)
+		})
+	}
+}
+
+func TestJSONPath_Limits(t *testing.T) {
+	// A chain of 12 nested lists: small, but each step below multiplies.
+	var chain interface{} = 1.0
+	for i := 0; i < 12; i++ {
+		chain = []interface{}{chain}
+	}
+	for _, expr := range []string{
+		"{" + strings.Repeat("[0,0,0,0]", 12) + "}",
+		strings.Repeat("{range $..}", 6) + "{.}" + strings.Repeat("{end}", 6),
+	} {
+		t.Run(expr, func(t *testing.T) {
+			start := time.Now()
+			got, err := jsonPath(expr, chain)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "more than")
+			assert.Empty(t, got)
+			assert.Less(t, time.Since(start), 5*time.Second)
+		})
+	}
+}
+
+func FuzzJSONPath(f *testing.F) {
+	for _, seed := range []string{"{.a}", "{..a}", "{[1:3:2]}", `{[?(@.a == "x")].b}`, "{range [*]}{.a}{end}"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, expr string) {
+		// Any expression either fails cleanly or renders; none may panic.
+		_, _ = jsonPath(expr, jsonPathDoc)
+	})
+}
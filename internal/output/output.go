@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"reflect"
+	"slices"
 	"strings"
 
 	"golang.org/x/term"
@@ -19,14 +20,48 @@ const (
 	FormatJSON  Format = "json"
 	FormatYAML  Format = "yaml"
 	FormatAuto  Format = "auto"
+	// FormatWide is a table with extra columns (see WithWideColumns).
+	FormatWide Format = "wide"
+	// FormatCustomColumns is a table with the columns given after "=", e.g.
+	// "custom-columns=ID:.entity_id,NAME:.attributes.friendly_name".
+	FormatCustomColumns Format = "custom-columns"
+	// FormatCSV, FormatTSV and FormatMarkdown write the table's columns as
+	// comma- or tab-separated values, or as a GitHub-flavoured Markdown table.
+	FormatCSV      Format = "csv"
+	FormatTSV      Format = "tsv"
+	FormatMarkdown Format = "markdown"
+	// FormatNDJSON writes one JSON object per line.
+	FormatNDJSON Format = "ndjson"
+	// FormatName writes only each item's identifier (its first table column),
+	// one per line, for piping into commands that read IDs from stdin.
+	FormatName Format = "name"
 )
 
 // DetectFormat resolves the output format. If override is set, use it.
 // Otherwise, use table when stdout is a TTY, JSON when piped.
+// Templated formats ("jsonpath=...") are returned as given; see Validate.
 func DetectFormat(override string, stdout *os.File) Format {
+	if _, _, ok := Format(override).templated(); ok {
+		return Format(override)
+	}
+	if _, ok, _ := Format(override).customColumns(); ok {
+		return Format(override)
+	}
 	switch strings.ToLower(override) {
 	case "table":
 		return FormatTable
+	case "wide":
+		return FormatWide
+	case "csv":
+		return FormatCSV
+	case "tsv":
+		return FormatTSV
+	case "ndjson":
+		return FormatNDJSON
+	case "markdown":
+		return FormatMarkdown
+	case "name":
+		return FormatName
 	case "json":
 		return FormatJSON
 	case "yaml":
@@ -42,20 +77,40 @@ func DetectFormat(override string, stdout *os.File) Format {
 type RenderOption func(*renderConfig)
 type renderConfig struct {
 	noHeaders bool
+	wide      []string
 }
 
 func WithNoHeaders(v bool) RenderOption {
 	return func(c *renderConfig) { c.noHeaders = v }
 }
 
+// WithWideColumns adds columns to -o wide tables, after the usual ones. Each is
+// a field name or "HEADER:.path", e.g. "UNIT:.attributes.unit_of_measurement".
+func WithWideColumns(columns ...string) RenderOption {
+	return func(c *renderConfig) { c.wide = append(c.wide, columns...) }
+}
+
 // Render writes data to w in the requested format.
 // data must be a slice of structs or a single struct/map.
-// columns is used only for table format; if nil, all exported fields are used.
+// columns is used only for table formats; if nil, all exported fields are used.
 func Render(w io.Writer, format Format, data interface{}, columns []string, opts ...RenderOption) error {
 	cfg := &renderConfig{}
 	for _, o := range opts {
 		o(cfg)
 	}
+	if p, err := format.template(); err != nil || p != nil {
+		if err != nil {
+			return err
+		}
+		return renderTemplate(w, p, data)
+	}
+	ts, err := format.table(columns, cfg)
+	if err != nil {
+		return err
+	}
+	if ts != nil {
+		return renderTable(w, data, ts, cfg)
+	}
 	switch format {
 	case FormatJSON:
 		enc := json.NewEncoder(w)
@@ -63,55 +118,58 @@ func Render(w io.Writer, format Format, data interface{}, columns []string, opts
 		return enc.Encode(data)
 	case FormatYAML:
 		return yaml.NewEncoder(w).Encode(data)
-	case FormatTable:
-		return renderTable(w, data, columns, cfg)
+	case FormatNDJSON:
+		return renderNDJSON(w, data)
+	case FormatName:
+		return renderNames(w, data, columns)
 	default:
 		return fmt.Errorf("unknown format: %s", format)
 	}
 }
 
 // renderTable prints a kubectl-style columnar table: left-aligned, space-separated,
-// no borders, no cell wrapping. Each row is always exactly one line.
-func renderTable(w io.Writer, data interface{}, columns []string, cfg *renderConfig) error {
+// no borders, no cell wrapping. Each row is always exactly one line. The same
+// columns are used for CSV, TSV and Markdown.
+func renderTable(w io.Writer, data interface{}, ts *tableSpec, cfg *renderConfig) error {
 	v := reflect.ValueOf(data)
 	if v.Kind() == reflect.Ptr {
 		v = v.Elem()
 	}
+	if ts.rows && v.IsValid() && v.Kind() != reflect.Slice {
+		one := reflect.MakeSlice(reflect.SliceOf(v.Type()), 0, 1)
+		v = reflect.Append(one, v)
+	}
 
 	if v.Kind() == reflect.Slice {
-		if v.Len() == 0 {
+		if v.Len() == 0 && ts.writer == FormatTable {
 			fmt.Fprintln(w, "(none)")
 			return nil
 		}
-		elem := v.Index(0)
-		if elem.Kind() == reflect.Ptr {
-			elem = elem.Elem()
+		t := v.Type().Elem()
+		if v.Len() > 0 {
+			t = indirect(v.Index(0)).Type()
+		}
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		cols, err := resolveColumns(t, ts)
+		if err != nil {
+			return err
 		}
-		headers, fields := resolveColumns(elem.Type(), columns)
 
 		// Collect all rows as strings so we can compute column widths.
 		rows := make([][]string, v.Len())
 		for i := 0; i < v.Len(); i++ {
-			row := v.Index(i)
-			if row.Kind() == reflect.Ptr {
-				row = row.Elem()
-			}
-			rows[i] = extractRow(row, fields)
+			rows[i] = extractRow(indirect(v.Index(i)), cols)
 		}
 
-		printColumns(w, headers, rows, cfg.noHeaders)
-		return nil
+		return writeRows(w, ts.writer, columnHeaders(cols), rows, cfg)
 	}
 
 	if v.Kind() == reflect.Struct {
-		t := v.Type()
 		var rows [][]string
-		for i := 0; i < v.NumField(); i++ {
-			f := t.Field(i)
-			if !f.IsExported() {
-				continue
-			}
-			rows = append(rows, []string{f.Name, fmt.Sprintf("%v", v.Field(i).Interface())})
+		for _, f := range fields(v.Type()) {
+			rows = append(rows, []string{f.Name, fmt.Sprintf("%v", v.FieldByIndex(f.Index).Interface())})
 		}
 		printColumns(w, nil, rows, cfg.noHeaders)
 		return nil
@@ -121,6 +179,26 @@ func renderTable(w io.Writer, data interface{}, columns []string, cfg *renderCon
 	return nil
 }
 
+// fields returns the exported fields of struct type t, with the fields of
+// embedded structs in place of the structs themselves, as JSON flattens them.
+func fields(t reflect.Type) []reflect.StructField {
+	var out []reflect.StructField
+	for _, f := range reflect.VisibleFields(t) {
+		if f.IsExported() && !(f.Anonymous && f.Type.Kind() == reflect.Struct) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// indirect follows pointers and interfaces to the value they hold.
+func indirect(v reflect.Value) reflect.Value {
+	for (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v
+}
+
 // printColumns writes a kubectl-style table. headers may be nil (for key/value structs).
 // Column widths are computed from all data so no cell is ever truncated or wrapped.
 func printColumns(w io.Writer, headers []string, rows [][]string, noHeaders bool) {
@@ -165,52 +243,80 @@ func printColumns(w io.Writer, headers []string, rows [][]string, noHeaders bool
 	}
 }
 
-func resolveColumns(t reflect.Type, override []string) (headers []string, fields []string) {
-	if len(override) > 0 {
-		// Overrides are Go field names. Look up the JSON tag for each so headers
-		// use HA-familiar names (e.g. "entity_id" → "ENTITY_ID", not "EntityID").
-		for _, name := range override {
-			header := name
-			for i := 0; i < t.NumField(); i++ {
-				f := t.Field(i)
-				if f.Name == name {
-					if tag := f.Tag.Get("json"); tag != "" && tag != "-" {
-						header = strings.Split(tag, ",")[0]
-					}
-					break
-				}
+// resolveColumns returns the columns of a table of t: the given ones, or all
+// exported fields, followed by any wide columns. Items that are not structs
+// (maps, scalars) are shown whole in a VALUE column unless columns are given.
+func resolveColumns(t reflect.Type, ts *tableSpec) ([]column, error) {
+	var cols []column
+	if len(ts.columns) == 0 {
+		if t.Kind() != reflect.Struct {
+			cols = append(cols, column{header: "VALUE", path: &jpPath{}})
+		}
+		if t.Kind() == reflect.Struct {
+			for _, f := range fields(t) {
+				c, _ := parseColumn(t, f.Name)
+				cols = append(cols, c)
 			}
-			headers = append(headers, strings.ToUpper(header))
-			fields = append(fields, name)
 		}
-		return
 	}
-	for i := 0; i < t.NumField(); i++ {
-		f := t.Field(i)
-		if !f.IsExported() {
-			continue
-		}
-		tag := f.Tag.Get("json")
-		name := f.Name
-		if tag != "" && tag != "-" {
-			name = strings.Split(tag, ",")[0]
+	for _, spec := range slices.Concat(ts.columns, ts.extra) {
+		c, err := parseColumn(t, spec)
+		if err != nil {
+			return nil, err
 		}
-		headers = append(headers, strings.ToUpper(name))
-		fields = append(fields, f.Name)
+		cols = append(cols, c)
 	}
-	return
+	return cols, nil
 }
 
-func extractRow(v reflect.Value, fields []string) []string {
-	row := make([]string, len(fields))
-	t := v.Type()
-	for i, fieldName := range fields {
-		for j := 0; j < t.NumField(); j++ {
-			if t.Field(j).Name == fieldName || strings.Split(t.Field(j).Tag.Get("json"), ",")[0] == fieldName {
-				row[i] = fmt.Sprintf("%v", v.Field(j).Interface())
+func columnHeaders(cols []column) []string {
+	headers := make([]string, len(cols))
+	for i, c := range cols {
+		headers[i] = c.header
+	}
+	return headers
+}
+
+// extractRow formats one item's cells. Path columns are evaluated against the
+// item as -o json would print it, so they can reach into maps such as a
+// state's attributes.
+func extractRow(v reflect.Value, cols []column) []string {
+	row := make([]string, len(cols))
+	var doc interface{}
+	for i, c := range cols {
+		if c.path != nil {
+			if doc == nil {
+				doc, _ = toJSONValue(v.Interface())
+			}
+			vals, err := c.path.eval(doc, doc)
+			if err != nil {
+				row[i] = "<" + err.Error() + ">"
+				continue
+			}
+			row[i] = cellValue(vals)
+			continue
+		}
+		if v.Kind() != reflect.Struct {
+			continue
+		}
+		for _, f := range fields(v.Type()) {
+			if f.Name == c.field || strings.Split(f.Tag.Get("json"), ",")[0] == c.field {
+				row[i] = fieldString(v.FieldByIndex(f.Index))
 				break
 			}
 		}
 	}
 	return row
 }
+
+// fieldString prints a field's value; a nil pointer (e.g. an entity's
+// disabled_by when it is enabled) is blank rather than "<nil>".
+func fieldString(v reflect.Value) string {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
@@ -0,0 +1,117 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// writeRows writes a table's header and rows in the given writer format.
+func writeRows(w io.Writer, writer Format, headers []string, rows [][]string, cfg *renderConfig) error {
+	switch writer {
+	case FormatCSV, FormatTSV:
+		return writeDelimited(w, writer, headers, rows, cfg.noHeaders)
+	case FormatMarkdown:
+		return writeMarkdown(w, headers, rows)
+	}
+	printColumns(w, headers, rows, cfg.noHeaders)
+	return nil
+}
+
+// writeDelimited writes comma- or tab-separated values, quoting cells as RFC
+// 4180 describes when they contain the separator, quotes or line breaks.
+func writeDelimited(w io.Writer, writer Format, headers []string, rows [][]string, noHeaders bool) error {
+	cw := csv.NewWriter(w)
+	if writer == FormatTSV {
+		cw.Comma = '\t'
+	}
+	if !noHeaders {
+		if err := cw.Write(headers); err != nil {
+			return err
+		}
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// writeMarkdown writes a GitHub-flavoured Markdown table. Markdown tables
+// cannot do without a header row, so --no-headers does not apply.
+func writeMarkdown(w io.Writer, headers []string, rows [][]string) error {
+	cell := strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>")
+	var b strings.Builder
+	line := func(cells []string) {
+		b.WriteString("|")
+		for _, c := range cells {
+			b.WriteString(" " + cell.Replace(c) + " |")
+		}
+		b.WriteString("\n")
+	}
+	rule := make([]string, len(headers))
+	for i := range rule {
+		rule[i] = "---"
+	}
+	line(headers)
+	line(rule)
+	for _, row := range rows {
+		line(row)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// renderNames writes the first column of each item, one per line: the entity
+// ID of a state, the ID of an area or device, and so on.
+func renderNames(w io.Writer, data interface{}, columns []string) error {
+	v := indirect(reflect.ValueOf(data))
+	if v.Kind() != reflect.Slice {
+		if !v.IsValid() {
+			return nil
+		}
+		_, err := fmt.Fprintln(w, itemName(v, columns))
+		return err
+	}
+	for i := 0; i < v.Len(); i++ {
+		if _, err := fmt.Fprintln(w, itemName(indirect(v.Index(i)), columns)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// itemName returns an item's first column; items that are not structs are
+// printed whole.
+func itemName(v reflect.Value, columns []string) string {
+	if v.Kind() != reflect.Struct {
+		doc, _ := toJSONValue(v.Interface())
+		return formatValue(doc)
+	}
+	cols, err := resolveColumns(v.Type(), &tableSpec{columns: columns})
+	if err != nil || len(cols) == 0 {
+		return ""
+	}
+	return extractRow(v, cols[:1])[0]
+}
+
+// renderNDJSON writes each element of a slice as one line of JSON, as it goes,
+// or data itself on one line if it is not a slice.
+func renderNDJSON(w io.Writer, data interface{}) error {
+	enc := json.NewEncoder(w)
+	v := reflect.ValueOf(data)
+	if v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.Slice {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice {
+		return enc.Encode(data)
+	}
+	for i := 0; i < v.Len(); i++ {
+		if err := enc.Encode(v.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package output_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rnorth/ha-client/internal/output"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var awkwardItems = []item{
+	{"light.desk", "on"},
+	{`sensor.say "hi"`, "a,b"},
+	{"sensor.multi", "line1\nline2|x"},
+}
+
+func TestCSVOutput(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, output.Render(&buf, output.FormatCSV, awkwardItems, nil))
+	assert.Equal(t, "NAME,STATE\nlight.desk,on\n\"sensor.say \"\"hi\"\"\",\"a,b\"\nsensor.multi,\"line1\nline2|x\"\n", buf.String())
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sensor.multi", "line1\nline2|x"}, records[3])
+}
+
+func TestCSVOutput_ColumnsAndNoHeaders(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, output.Render(&buf, output.FormatCSV, templateStates, []string{"EntityID", "UNIT:.attributes.unit_of_measurement"}, output.WithNoHeaders(true)))
+	assert.Equal(t, "sensor.living_temp,°C\nlight.desk,<none>\nsensor.garage_temp,<none>\n", buf.String())
+}
+
+func TestCSVOutput_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, output.Render(&buf, output.FormatCSV, []item{}, nil))
+	assert.Equal(t, "NAME,STATE\n", buf.String(), "an empty list still has its header row")
+}
+
+func TestCSVOutput_SingleItem(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, output.Render(&buf, output.FormatCSV, item{"light.desk", "on"}, nil))
+	assert.Equal(t, "NAME,STATE\nlight.desk,on\n", buf.String())
+}
+
+func TestTSVOutput(t *testing.T) {
+	var buf bytes.Buffer
+	data := []item{{"light.desk", "on"}, {"sensor.tab", "a\tb"}}
+	require.NoError(t, output.Render(&buf, output.FormatTSV, data, nil))
+	assert.Equal(t, "NAME\tSTATE\nlight.desk\ton\nsensor.tab\t\"a\tb\"\n", buf.String())
+}
+
+func TestNDJSONOutput(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, output.Render(&buf, output.FormatNDJSON, awkwardItems, nil))
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 3)
+	var got item
+	require.NoError(t, json.Unmarshal([]byte(lines[2]), &got))
+	assert.Equal(t, awkwardItems[2], got)
+
+	buf.Reset()
+	require.NoError(t, output.Render(&buf, output.FormatNDJSON, item{"light.desk", "on"}, nil))
+	assert.Equal(t, `{"name":"light.desk","state":"on"}`+"\n", buf.String())
+}
+
+func TestMarkdownOutput(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, output.Render(&buf, output.FormatMarkdown, awkwardItems, nil, output.WithNoHeaders(true)))
+	assert.Equal(t, "| NAME | STATE |\n| --- | --- |\n| light.desk | on |\n| sensor.say \"hi\" | a,b |\n| sensor.multi | line1<br>line2\\|x |\n", buf.String())
+}
+
+func TestDetectFormat_Delimited(t *testing.T) {
+	for _, f := range []output.Format{output.FormatCSV, output.FormatTSV, output.FormatNDJSON, output.FormatMarkdown} {
+		assert.Equal(t, f, output.DetectFormat(string(f), os.Stdout))
+	}
+}
+
+func TestRenderContexts_CSVAndNDJSON(t *testing.T) {
+	results := []output.ContextResult{
+		{Context: "home", Data: []item{{"light.desk", "on"}}},
+		{Context: "cabin", Data: []item{{"light.porch", "off"}}},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, output.RenderContexts(&buf, output.FormatCSV, results, nil))
+	assert.Equal(t, "CONTEXT,NAME,STATE\nhome,light.desk,on\ncabin,light.porch,off\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, output.RenderContexts(&buf, output.FormatNDJSON, results, nil))
+	assert.Equal(t, `{"context":"home","name":"light.desk","state":"on"}`+"\n"+`{"context":"cabin","name":"light.porch","state":"off"}`+"\n", buf.String())
+}
+
+func TestNameOutput(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, output.Render(&buf, output.FormatName, templateStates, []string{"EntityID", "State"}))
+	assert.Equal(t, "sensor.living_temp\nlight.desk\nsensor.garage_temp\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, output.Render(&buf, output.FormatName, item{"light.desk", "on"}, nil))
+	assert.Equal(t, "light.desk\n", buf.String(), "without columns, the first field is the name")
+
+	buf.Reset()
+	results := []output.ContextResult{
+		{Context: "home", Data: []item{{"light.desk", "on"}}},
+		{Context: "cabin", Data: []item{{"light.porch", "off"}}},
+	}
+	require.NoError(t, output.RenderContexts(&buf, output.FormatName, results, nil))
+	assert.Equal(t, "light.desk\nlight.porch\n", buf.String())
+	assert.Equal(t, output.FormatName, output.DetectFormat("name", os.Stdout))
+}
@@ -0,0 +1,122 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// Templated formats carry their expression after "=", e.g.
+// "jsonpath={.state}" or "go-template-file=states.tmpl".
+const (
+	FormatJSONPath       Format = "jsonpath"
+	FormatGoTemplate     Format = "go-template"
+	FormatGoTemplateFile Format = "go-template-file"
+)
+
+// ErrTemplate is returned for a JSONPath or Go template that cannot be parsed
+// or executed.
+var ErrTemplate = errors.New("invalid output template")
+
+// templated splits a templated format into its kind and expression.
+func (f Format) templated() (kind Format, expr string, ok bool) {
+	name, expr, _ := strings.Cut(string(f), "=")
+	switch kind := Format(strings.ToLower(name)); kind {
+	case FormatJSONPath, FormatGoTemplate, FormatGoTemplateFile:
+		return kind, expr, true
+	}
+	return "", "", false
+}
+
+// Validate checks that a templated format's expression, or a custom-columns
+// spec, parses, so that a mistake is reported before any request is made.
+// Other formats are valid.
+func (f Format) Validate() error {
+	if _, err := f.template(); err != nil {
+		return err
+	}
+	_, _, err := f.customColumns()
+	return err
+}
+
+// printer executes a parsed template against JSON-shaped data.
+type printer interface {
+	execute(w io.Writer, data interface{}) error
+}
+
+type goTemplate struct{ t *template.Template }
+
+func (g goTemplate) execute(w io.Writer, data interface{}) error {
+	return g.t.Execute(w, data)
+}
+
+// template parses a templated format; it returns nil for other formats.
+func (f Format) template() (printer, error) {
+	kind, expr, ok := f.templated()
+	if !ok {
+		return nil, nil
+	}
+	if expr == "" {
+		return nil, fmt.Errorf("%w: %s format needs a template, e.g. -o %s=%s", ErrTemplate, kind, kind, templateExample[kind])
+	}
+	name := "output"
+	if kind == FormatGoTemplateFile {
+		data, err := os.ReadFile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrTemplate, err)
+		}
+		name, expr = filepath.Base(expr), string(data)
+	}
+	if kind == FormatJSONPath {
+		p, err := parseJSONPath(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: jsonpath %s: %v", ErrTemplate, expr, err)
+		}
+		return p, nil
+	}
+	t, err := template.New(name).Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTemplate, err)
+	}
+	return goTemplate{t}, nil
+}
+
+var templateExample = map[Format]string{
+	FormatJSONPath:       "'{.state}'",
+	FormatGoTemplate:     "'{{.state}}'",
+	FormatGoTemplateFile: "states.tmpl",
+}
+
+// renderTemplate executes a templated format against data as it would be
+// written by -o json, so that keys are the JSON field names. Nothing is written
+// if the template fails.
+func renderTemplate(w io.Writer, p printer, data interface{}) error {
+	v, err := toJSONValue(data)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := p.execute(&buf, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrTemplate, err)
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// toJSONValue converts data to the maps, slices and scalars it would be as
+// JSON, keyed by JSON field names.
+func toJSONValue(data interface{}) (interface{}, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	err = json.Unmarshal(raw, &v)
+	return v, err
+}
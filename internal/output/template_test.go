@@ -0,0 +1,112 @@
+package output_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rnorth/ha-client/internal/client"
+	"github.com/rnorth/ha-client/internal/output"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var templateStates = []client.State{
+	{EntityID: "sensor.living_temp", State: "21.5", Attributes: map[string]interface{}{"temperature": 21.5, "unit_of_measurement": "°C", "device_class": "temperature"}},
+	{EntityID: "light.desk", State: "on", Attributes: map[string]interface{}{"friendly_name": "Desk", "brightness": 255}},
+	{EntityID: "sensor.garage_temp", State: "4", Attributes: map[string]interface{}{"device_class": "temperature"}},
+}
+
+func renderString(t *testing.T, format output.Format, data interface{}) string {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, output.Render(&buf, format, data, nil))
+	return buf.String()
+}
+
+func TestJSONPath(t *testing.T) {
+	tests := []struct {
+		expr string
+		data interface{}
+		want string
+	}{
+		{"{.attributes.temperature}", templateStates[0], "21.5"},
+		{"{.entity_id}: {.state}", templateStates[1], "light.desk: on"},
+		{"{['entity_id']}", templateStates[1], "light.desk"},
+		{"{$.attributes.friendly_name}", templateStates[1], "Desk"},
+		{"{.attributes.missing}", templateStates[1], ""},
+		{"{[*].entity_id}", templateStates, "sensor.living_temp light.desk sensor.garage_temp"},
+		{"{.[0].entity_id}", templateStates, "sensor.living_temp"},
+		{"{[-1].entity_id}", templateStates, "sensor.garage_temp"},
+		{"{[0:2].state}", templateStates, "21.5 on"},
+		{"{..friendly_name}", templateStates, "Desk"},
+		{`{range .[*]}{.entity_id}{"\n"}{end}`, templateStates, "sensor.living_temp\nlight.desk\nsensor.garage_temp\n"},
+		{`{[?(@.attributes.device_class == "temperature")].entity_id}`, templateStates, "sensor.living_temp sensor.garage_temp"},
+		{`{[?(@.state > 10)].entity_id}`, templateStates, "sensor.living_temp"},
+		{`{[?(@.state != 'on')].entity_id}`, templateStates, "sensor.living_temp sensor.garage_temp"},
+		{`{[?(@.attributes.brightness)].entity_id}`, templateStates, "light.desk"},
+		{"{[1].attributes}", templateStates, `{"brightness":255,"friendly_name":"Desk"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			assert.Equal(t, tt.want, renderString(t, output.Format("jsonpath="+tt.expr), tt.data))
+		})
+	}
+}
+
+func TestGoTemplate(t *testing.T) {
+	out := renderString(t, `go-template={{range .}}{{.entity_id}}{{"\n"}}{{end}}`, templateStates)
+	assert.Equal(t, "sensor.living_temp\nlight.desk\nsensor.garage_temp\n", out)
+
+	out = renderString(t, `go-template={{.attributes.friendly_name}} is {{.state}}`, templateStates[1])
+	assert.Equal(t, "Desk is on", out)
+}
+
+func TestGoTemplateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "states.tmpl")
+	require.NoError(t, os.WriteFile(path, []byte(`{{range .}}{{if eq .state "on"}}{{.entity_id}}{{end}}{{end}}`), 0600))
+
+	assert.Equal(t, "light.desk", renderString(t, output.Format("go-template-file="+path), templateStates))
+}
+
+func TestTemplateErrors(t *testing.T) {
+	for _, format := range []output.Format{
+		"jsonpath={.a",
+		"jsonpath={range .[*]}{.a}",
+		"jsonpath={end}",
+		"jsonpath={.a[x]}",
+		"jsonpath={[?(@.a == on)]}",
+		"jsonpath=",
+		"go-template={{.a",
+		"go-template={{index . 9}}",
+		output.Format("go-template-file=" + filepath.Join(t.TempDir(), "missing.tmpl")),
+	} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			err := output.Render(&buf, format, templateStates, nil)
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, output.ErrTemplate), err)
+			assert.Empty(t, buf.String(), "nothing is written when the template fails")
+		})
+	}
+	assert.Error(t, output.Format("jsonpath={.a").Validate())
+	assert.NoError(t, output.Format("jsonpath={.a}").Validate())
+	assert.NoError(t, output.FormatJSON.Validate())
+}
+
+func TestDetectFormat_Templates(t *testing.T) {
+	assert.Equal(t, output.Format("jsonpath={.State}"), output.DetectFormat("jsonpath={.State}", os.Stdout))
+	assert.Equal(t, output.Format("go-template={{.A}}"), output.DetectFormat("go-template={{.A}}", os.Stdout))
+}
+
+func TestRenderContexts_JSONPath(t *testing.T) {
+	var buf bytes.Buffer
+	results := []output.ContextResult{
+		{Context: "home", Data: []item{{"light.desk", "on"}}},
+		{Context: "cabin", Data: []item{{"light.porch", "off"}}},
+	}
+	require.NoError(t, output.RenderContexts(&buf, `jsonpath={range [*]}{.context}/{.name}{"\n"}{end}`, results, nil))
+	assert.Equal(t, "home/light.desk\ncabin/light.porch\n", buf.String())
+}
@@ -0,0 +1,218 @@
+// Package selector parses and matches the --field-selector and -l/--selector
+// expressions of list commands.
+package selector
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Operators, longest first so that "!=" is not read as "!" and "=".
+var operators = []string{"!=", "!~", "=~", "==", ">=", "<=", "=", "<", ">"}
+
+// Requirement is one comma-separated term of a selector, such as
+// "state!=unavailable" or "attributes.temperature>20".
+//
+//	key=value    equal, or a glob when value contains * or ?
+//	key!=value   not equal (true when the key is missing)
+//	key=~regex   matches the regular expression
+//	key!~regex   does not match it
+//	key<n, key>n, key<=n, key>=n   numeric comparison
+type Requirement struct {
+	Key   string
+	Op    string
+	Value string
+
+	re  *regexp.Regexp
+	num float64
+}
+
+// Selector is a list of requirements, all of which must hold.
+type Selector []Requirement
+
+// Parse parses a selector such as "state=on,attributes.device_class=temperature".
+// A comma inside a value is written as "\,".
+func Parse(s string) (Selector, error) {
+	var sel Selector
+	for _, term := range splitTerms(s) {
+		if term = strings.TrimSpace(term); term == "" {
+			continue
+		}
+		r, err := parseRequirement(term)
+		if err != nil {
+			return nil, err
+		}
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+func splitTerms(s string) []string {
+	var terms []string
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == ',':
+			b.WriteByte(',')
+			i++
+		case s[i] == ',':
+			terms = append(terms, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return append(terms, b.String())
+}
+
+func parseRequirement(term string) (Requirement, error) {
+	for i := 0; i < len(term); i++ {
+		for _, op := range operators {
+			if !strings.HasPrefix(term[i:], op) {
+				continue
+			}
+			r := Requirement{Key: strings.TrimSpace(term[:i]), Op: op, Value: strings.TrimSpace(term[i+len(op):])}
+			if r.Op == "==" {
+				r.Op = "="
+			}
+			if r.Key == "" {
+				return Requirement{}, fmt.Errorf("%q: missing key before %s", term, op)
+			}
+			return r, r.compile()
+		}
+	}
+	return Requirement{}, fmt.Errorf("%q: expected key=value, key!=value, key=~regex, key!~regex, key<n or key>n", term)
+}
+
+func (r *Requirement) compile() error {
+	var err error
+	switch r.Op {
+	case "=", "!=":
+		if strings.ContainsAny(r.Value, "*?") {
+			pattern := regexp.QuoteMeta(r.Value)
+			pattern = strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(pattern)
+			r.re, err = regexp.Compile("^" + pattern + "$")
+		}
+	case "=~", "!~":
+		if r.re, err = regexp.Compile(r.Value); err != nil {
+			return fmt.Errorf("%s%s%s: invalid regular expression: %v", r.Key, r.Op, r.Value, err)
+		}
+	default:
+		if r.num, err = strconv.ParseFloat(r.Value, 64); err != nil {
+			return fmt.Errorf("%s%s%s: %s needs a number", r.Key, r.Op, r.Value, r.Op)
+		}
+	}
+	return err
+}
+
+// Matches reports whether the requirement holds for a key's values. A key
+// may have several values (e.g. labels); = holds if any matches, != if none
+// does.
+func (r Requirement) Matches(values []string) bool {
+	switch r.Op {
+	case "!=", "!~":
+		positive := r
+		positive.Op = map[string]string{"!=": "=", "!~": "=~"}[r.Op]
+		return !positive.Matches(values)
+	}
+	for _, v := range values {
+		if r.matchesOne(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Requirement) matchesOne(v string) bool {
+	switch r.Op {
+	case "=":
+		if r.re != nil {
+			return r.re.MatchString(v)
+		}
+		return v == r.Value
+	case "=~":
+		return r.re.MatchString(v)
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return false
+	}
+	switch r.Op {
+	case "<":
+		return n < r.num
+	case "<=":
+		return n <= r.num
+	case ">":
+		return n > r.num
+	case ">=":
+		return n >= r.num
+	}
+	return false
+}
+
+// Matches reports whether every requirement holds, looking up each key's
+// values with values.
+func (s Selector) Matches(values func(key string) []string) bool {
+	for _, r := range s {
+		if !r.Matches(values(r.Key)) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchesObject matches the selector against v as it would be written as
+// JSON, with keys as dotted paths such as "attributes.device_class".
+func (s Selector) MatchesObject(v interface{}) (bool, error) {
+	if len(s) == 0 {
+		return true, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return false, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return false, err
+	}
+	return s.Matches(func(key string) []string { return lookup(doc, strings.Split(key, ".")) }), nil
+}
+
+// lookup follows a dotted path through objects. Lists along the way are
+// searched element by element, so "labels" yields each label.
+func lookup(v interface{}, path []string) []string {
+	switch v := v.(type) {
+	case []interface{}:
+		var out []string
+		for _, e := range v {
+			out = append(out, lookup(e, path)...)
+		}
+		return out
+	case map[string]interface{}:
+		if len(path) == 0 {
+			return nil
+		}
+		child, ok := v[path[0]]
+		if !ok {
+			return nil
+		}
+		return lookup(child, path[1:])
+	}
+	if len(path) > 0 {
+		return nil
+	}
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{v}
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case bool:
+		return []string{strconv.FormatBool(v)}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package selector_test
+
+import (
+	"testing"
+
+	"github.com/rnorth/ha-client/internal/selector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sensor = map[string]interface{}{
+	"entity_id": "sensor.living_temp",
+	"state":     "21.5",
+	"attributes": map[string]interface{}{
+		"device_class":  "temperature",
+		"friendly_name": "Living room, north",
+		"reachable":     true,
+	},
+	"labels": []string{"climate", "critical"},
+}
+
+func TestMatchesObject(t *testing.T) {
+	for _, tc := range []struct {
+		selector string
+		want     bool
+	}{
+		{"", true},
+		{"state=21.5", true},
+		{"state==21.5", true},
+		{"state!=21.5", false},
+		{"entity_id=sensor.*", true},
+		{"entity_id=sensor.?iving_temp", true},
+		{"entity_id=light.*", false},
+		{"entity_id=~_temp$", true},
+		{"entity_id!~^sensor", false},
+		{"state>20,state<22", true},
+		{"state>=21.5,state<=21.5", true},
+		{"state>22", false},
+		{"attributes.device_class=temperature", true},
+		{"attributes.reachable=true", true},
+		{`attributes.friendly_name=Living room\, north`, true},
+		{"attributes.unit_of_measurement=°C", false},
+		{"attributes.unit_of_measurement!=°C", true},
+		{"entity_id>1", false},
+		{"labels=critical", true},
+		{"labels!=critical", false},
+		{"labels=crit*,state=21.5", true},
+		{" state = 21.5 , entity_id = sensor.living_temp ", true},
+	} {
+		sel, err := selector.Parse(tc.selector)
+		require.NoError(t, err, tc.selector)
+		got, err := sel.MatchesObject(sensor)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, got, tc.selector)
+	}
+}
+
+func TestParse(t *testing.T) {
+	sel, err := selector.Parse("area=kitchen,label!=critical")
+	require.NoError(t, err)
+	require.Len(t, sel, 2)
+	assert.Equal(t, selector.Requirement{Key: "label", Op: "!=", Value: "critical"}, sel[1])
+
+	assert.True(t, sel.Matches(func(key string) []string {
+		return map[string][]string{"area": {"kitchen"}, "label": {"night"}}[key]
+	}))
+	assert.False(t, sel.Matches(func(key string) []string {
+		return map[string][]string{"area": {"kitchen"}, "label": {"night", "critical"}}[key]
+	}))
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, s := range []string{"state", "=on", "state>warm", "entity_id=~("} {
+		_, err := selector.Parse(s)
+		assert.Error(t, err, s)
+	}
+}